@@ -0,0 +1,109 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// BinaryAllowlistEntry permits binaries that are committed on purpose, such as test fixtures or
+// vendored firmware. An entry covers the files matching its path glob, the files with its digest,
+// or when both are given, the files matching both.
+type BinaryAllowlistEntry struct {
+	// Path is a glob matched against the path from the root of the repository, where "*" doesn't
+	// match a slash and "**" matches any number of directories
+	Path string `yaml:"path"`
+	// SHA256 is the hex encoded digest of the allowed file's content
+	SHA256        string `yaml:"sha256"`
+	Justification string `yaml:"justification"`
+	// Expires is the last day the entry applies, as YYYY-MM-DD. Entries without one never expire.
+	Expires string `yaml:"expires"`
+}
+
+// loadBinaryAllowlist reads the allowlist file in the binary-allowlist var, if there is one
+func loadBinaryAllowlist(config *config.Config) (allowlist []BinaryAllowlistEntry, err error) {
+	allowlistPath := config.GetString("binary-allowlist")
+	if allowlistPath == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(allowlistPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read binary-allowlist: %w", err)
+	}
+	if err := yaml.Unmarshal(content, &allowlist); err != nil {
+		return nil, fmt.Errorf("failed to parse binary-allowlist: %w", err)
+	}
+	var problems []error
+	for i := range allowlist {
+		if err := allowlist[i].validate(); err != nil {
+			problems = append(problems, fmt.Errorf("binary-allowlist entry %d: %w", i+1, err))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	return allowlist, nil
+}
+
+func (e *BinaryAllowlistEntry) validate() error {
+	if e.Path == "" && e.SHA256 == "" {
+		return errors.New("a path or sha256 is required")
+	}
+	if strings.TrimSpace(e.Justification) == "" {
+		return errors.New("a justification is required")
+	}
+	if e.Path != "" && globPattern(e.Path) == nil {
+		return fmt.Errorf("invalid path %q", e.Path)
+	}
+	if _, err := time.Parse(time.DateOnly, e.Expires); e.Expires != "" && err != nil {
+		return fmt.Errorf("invalid expires %q, expected YYYY-MM-DD", e.Expires)
+	}
+	return nil
+}
+
+func (e *BinaryAllowlistEntry) covers(binary SuspectedBinary) bool {
+	if e.Path != "" {
+		if pattern := globPattern(e.Path); pattern == nil || !pattern.MatchString(binary.Path) {
+			return false
+		}
+	}
+	return e.SHA256 == "" || strings.EqualFold(e.SHA256, binary.SHA256)
+}
+
+// expired reports whether the entry's last day has passed at now
+func (e *BinaryAllowlistEntry) expired(now time.Time) bool {
+	expires, err := time.Parse(time.DateOnly, e.Expires)
+	return err == nil && !now.Before(expires.AddDate(0, 0, 1))
+}
+
+// applyBinaryAllowlist marks the binaries covered by an entry of the allowlist that hasn't
+// expired as allowed, and those covered only by expired entries with the latest expiry
+func applyBinaryAllowlist(binaries []SuspectedBinary, allowlist []BinaryAllowlistEntry, now time.Time) []SuspectedBinary {
+	judged := make([]SuspectedBinary, 0, len(binaries))
+	for _, binary := range binaries {
+		binary.Allowed, binary.Expired = "", ""
+		for i := range allowlist {
+			entry := &allowlist[i]
+			if !entry.covers(binary) {
+				continue
+			}
+			if !entry.expired(now) {
+				binary.Allowed = entry.Justification
+				break
+			}
+			if entry.Expires > binary.Expired {
+				binary.Expired = entry.Expires
+			}
+		}
+		if binary.Allowed != "" {
+			binary.Expired = ""
+		}
+		judged = append(judged, binary)
+	}
+	return judged
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBinaryAllowlist(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectError string
+		expectLen   int
+	}{
+		{
+			name: "valid entries",
+			content: `
+- path: test/fixtures/**
+  justification: Fixtures for the archive reader
+- sha256: E94466FAAC02D08EFBB3109DBE52D0C13C5A53859E328D50DBEB2E6F0EE89871
+  justification: Vendored firmware
+  expires: 2026-12-31
+`,
+			expectLen: 2,
+		},
+		{name: "missing justification", content: "- path: '*.exe'\n", expectError: "entry 1: a justification is required"},
+		{name: "missing path and digest", content: "- justification: because\n", expectError: "entry 1: a path or sha256 is required"},
+		{name: "invalid expiry", content: "- path: a.exe\n  justification: because\n  expires: next year\n", expectError: "invalid expires"},
+		{name: "malformed yaml", content: "path: [", expectError: "failed to parse binary-allowlist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowlistPath := filepath.Join(t.TempDir(), "allowlist.yml")
+			require.NoError(t, os.WriteFile(allowlistPath, []byte(tt.content), 0o600))
+			cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"binary-allowlist": allowlistPath}}
+
+			allowlist, err := loadBinaryAllowlist(cfg)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, allowlist, tt.expectLen)
+		})
+	}
+
+	t.Run("no allowlist configured", func(t *testing.T) {
+		allowlist, err := loadBinaryAllowlist(&config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{}})
+		require.NoError(t, err)
+		assert.Empty(t, allowlist)
+	})
+}
+
+func TestApplyBinaryAllowlist(t *testing.T) {
+	entries := []BinaryAllowlistEntry{
+		{Path: "test/fixtures/**", Justification: "Fixtures for the archive reader"},
+		{SHA256: "ABC123", Justification: "Vendored firmware", Expires: "2026-10-15"},
+		{Path: "tools/*.exe", SHA256: "def456", Justification: "Signed installer"},
+		{Path: "legacy/*", Justification: "Old build output", Expires: "2026-01-01"},
+		{Path: "legacy/*", Justification: "Removal in progress", Expires: "2026-06-30"},
+	}
+	binaries := []SuspectedBinary{
+		{Path: "test/fixtures/nested/sample.zip", Type: "ZIP archive", SHA256: "000"},
+		{Path: "firmware/blob.bin", Type: "ELF executable", SHA256: "abc123"},
+		{Path: "tools/setup.exe", Type: "PE executable", SHA256: "def456"},
+		{Path: "tools/other.exe", Type: "PE executable", SHA256: "111"},
+		{Path: "legacy/app", Type: "ELF executable", SHA256: "222"},
+	}
+
+	t.Run("before expiry", func(t *testing.T) {
+		judged := applyBinaryAllowlist(binaries, entries, time.Date(2026, 10, 15, 23, 0, 0, 0, time.UTC))
+		assert.Equal(t, "Fixtures for the archive reader", judged[0].Allowed)
+		assert.Equal(t, "Vendored firmware", judged[1].Allowed)
+		assert.Equal(t, "Signed installer", judged[2].Allowed)
+		assert.Empty(t, judged[3].Allowed, "both the path and digest must match")
+		assert.Empty(t, judged[3].Expired)
+		assert.Empty(t, judged[4].Allowed)
+		assert.Equal(t, "2026-06-30", judged[4].Expired, "the latest expiry is reported")
+		assert.Equal(t, "legacy/app (ELF executable, allowlist entry expired on 2026-06-30)", judged[4].String())
+		assert.Equal(t, "tools/setup.exe (PE executable, allowed: Signed installer)", judged[2].String())
+	})
+
+	t.Run("after expiry", func(t *testing.T) {
+		judged := applyBinaryAllowlist(binaries, entries, time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC))
+		assert.Empty(t, judged[1].Allowed)
+		assert.Equal(t, "2026-10-15", judged[1].Expired)
+	})
+}
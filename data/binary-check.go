@@ -0,0 +1,392 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v74/github"
+)
+
+var (
+	// binaryExtensions identify the binaries stored in Git LFS, whose content isn't committed
+	binaryExtensions = map[string]bool{
+		"tar":    true,
+		"gz":     true,
+		"tgz":    true,
+		"zip":    true,
+		"rar":    true,
+		"7z":     true,
+		"bz2":    true,
+		"xz":     true,
+		"lzma":   true,
+		"lz4":    true,
+		"zst":    true,
+		"apk":    true,
+		"crx":    true,
+		"deb":    true,
+		"dex":    true,
+		"dey":    true,
+		"elf":    true,
+		"o":      true,
+		"a":      true,
+		"so":     true,
+		"macho":  true,
+		"iso":    true,
+		"class":  true,
+		"jar":    true,
+		"bundle": true,
+		"dylib":  true,
+		"lib":    true,
+		"msi":    true,
+		"dll":    true,
+		"drv":    true,
+		"efi":    true,
+		"exe":    true,
+		"ocx":    true,
+		"pyc":    true,
+		"pyo":    true,
+		"par":    true,
+		"rpm":    true,
+		"wasm":   true,
+		"whl":    true,
+	}
+
+	// knownFilenames are text files without an extension, which are never read while scanning for binaries.
+	// Extend this with more known filenames as needed
+	knownFilenames = map[string]bool{
+		"README":          true,
+		"LICENSE":         true,
+		"CHANGELOG":       true,
+		"CONTRIBUTING":    true,
+		"CODE_OF_CONDUCT": true,
+		"TODO":            true,
+		"SECURITY":        true,
+		"NOTICE":          true,
+		"CODEOWNERS":      true,
+		".gitignore":      true,
+		".gitattributes":  true,
+		"Makefile":        true,
+		"Dockerfile":      true,
+		"Vagrantfile":     true,
+		"Gemfile":         true,
+		"Procfile":        true,
+		"Brewfile":        true,
+		"MANIFEST":        true,
+		"DCO":             true,
+		"MAINTAINERS":     true,
+		"CNAME":           true,
+	}
+)
+
+// contentExtensions are the extensions of source, documentation and media files. These aren't read
+// while scanning for binaries unless .gitattributes marks them as binary, which keeps the number
+// of files fetched from the forge down.
+var contentExtensions = map[string]bool{
+	"adoc": true, "bash": true, "bat": true, "bmp": true, "c": true, "cc": true, "cfg": true,
+	"cjs": true, "clj": true, "cmake": true, "cmd": true, "conf": true, "cpp": true, "cs": true,
+	"css": true, "csv": true, "cue": true, "dart": true, "diff": true, "ejs": true, "erb": true,
+	"ex": true, "exs": true, "gif": true, "go": true, "gradle": true, "graphql": true, "groovy": true,
+	"h": true, "hcl": true, "hpp": true, "hs": true, "htm": true, "html": true, "ico": true,
+	"ini": true, "ipynb": true, "java": true, "jpeg": true, "jpg": true, "js": true, "json": true,
+	"jsx": true, "kt": true, "kts": true, "less": true, "lock": true, "lua": true, "m": true,
+	"md": true, "mjs": true, "mk": true, "mod": true, "mp3": true, "mp4": true, "nix": true,
+	"otf": true, "patch": true, "pdf": true, "php": true, "pl": true, "png": true, "properties": true,
+	"proto": true, "ps1": true, "py": true, "r": true, "rb": true, "rego": true, "rs": true,
+	"rst": true, "sass": true, "scala": true, "scss": true, "sh": true, "sql": true, "sum": true,
+	"svg": true, "swift": true, "tf": true, "tmpl": true, "toml": true, "tpl": true, "ts": true,
+	"tsx": true, "ttf": true, "txt": true, "vue": true, "webp": true, "woff": true, "woff2": true,
+	"xml": true, "yaml": true, "yml": true, "zig": true, "zsh": true,
+}
+
+const (
+	// binarySniffLength is how much of the start of a file is needed to identify its type
+	binarySniffLength = 512
+	// peHeaderMaxEnd is how far into a file its PE header is looked for
+	peHeaderMaxEnd = 1 << 20
+	// binaryScanConcurrency is how many files are read at once while scanning for binaries
+	binaryScanConcurrency = 8
+	// binaryScanMaxSize is the size of the largest file downloaded while scanning for binaries, for
+	// readers that can't fetch only the start of a file
+	binaryScanMaxSize = 32 << 20
+)
+
+// lfsPointerPrefix starts the pointer files Git LFS commits in place of the files it stores
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1"
+
+// binarySignatures identify binary formats by the bytes found at an offset from the start of a file.
+// Short signatures that text can start with are confirmed by a check of the rest of the header.
+var binarySignatures = []struct {
+	offset int
+	magic  string
+	kind   string
+	check  func(content []byte) bool
+}{
+	{0, "\x7fELF", "ELF executable", nil},
+	{0, "\xfe\xed\xfa\xce", "Mach-O executable", nil},
+	{0, "\xfe\xed\xfa\xcf", "Mach-O executable", nil},
+	{0, "\xce\xfa\xed\xfe", "Mach-O executable", nil},
+	{0, "\xcf\xfa\xed\xfe", "Mach-O executable", nil},
+	{0, "\xca\xfe\xba\xbf", "Mach-O universal binary", nil},
+	{0, "MZ", "PE executable", hasPESignature},
+	{0, "\x00asm", "WebAssembly module", nil},
+	{0, "dex\n", "Dalvik executable", nil},
+	{0, "PK\x03\x04", "ZIP archive", nil},
+	{0, "PK\x05\x06", "ZIP archive", nil},
+	{0, "\x1f\x8b", "gzip archive", nil},
+	{0, "BZh", "bzip2 archive", hasBzip2BlockSize},
+	{0, "\xfd7zXZ\x00", "xz archive", nil},
+	{0, "7z\xbc\xaf\x27\x1c", "7-Zip archive", nil},
+	{0, "Rar!\x1a\x07", "RAR archive", nil},
+	{0, "\x28\xb5\x2f\xfd", "Zstandard archive", nil},
+	{0, "\x04\x22\x4d\x18", "LZ4 archive", nil},
+	{0, "!<arch>\n", "ar archive", nil},
+	{0, "\xed\xab\xee\xdb", "RPM package", nil},
+	{257, "ustar", "tar archive", nil},
+}
+
+// SuspectedBinary is a file whose content identifies it as a binary artifact
+type SuspectedBinary struct {
+	Path string `json:"path"`
+	// Type names the kind of binary, such as "ELF executable"
+	Type string `json:"type"`
+	// SHA256 is the hex encoded digest of the file's content
+	SHA256 string `json:"sha256"`
+	// Allowed is the justification of the binary allowlist entry covering the file, if any
+	Allowed string `json:"-"`
+	// Expired is the expiry date of the allowlist entry that covered the file, when every entry covering it has expired
+	Expired string `json:"-"`
+	// Unread is why a file couldn't be read. Its type is unknown when even its start couldn't be read,
+	// and its digest when only the start could.
+	Unread string `json:"unread,omitempty"`
+}
+
+func (b SuspectedBinary) String() string {
+	switch {
+	case b.Type == "" && b.Allowed != "":
+		return fmt.Sprintf("%s (not read: %s, allowed: %s)", b.Path, b.Unread, b.Allowed)
+	case b.Type == "":
+		return fmt.Sprintf("%s (not read: %s)", b.Path, b.Unread)
+	case b.Allowed != "":
+		return fmt.Sprintf("%s (%s, allowed: %s)", b.Path, b.Type, b.Allowed)
+	case b.Expired != "":
+		return fmt.Sprintf("%s (%s, allowlist entry expired on %s)", b.Path, b.Type, b.Expired)
+	default:
+		return fmt.Sprintf("%s (%s)", b.Path, b.Type)
+	}
+}
+
+// fileReader returns the first limit bytes of the file at a path in the repository, or the whole
+// file when limit is zero or the file is shorter. Readers may return the whole file regardless.
+type fileReader func(filePath string, limit int) ([]byte, error)
+
+// scanForBinaries identifies the binary artifacts among the files at paths from the start of their
+// content. Files are read when their name doesn't show them to be source, documentation or media, or
+// when .gitattributes marks them as binary or stored in Git LFS. Files stored in Git LFS are
+// judged by their extension, as only a pointer to their content is committed. Files are read
+// concurrently, and those that can't be read are listed with the reason, so they can be reviewed.
+func scanForBinaries(paths []string, read fileReader) (suspectedBinaries []SuspectedBinary, err error) {
+	attributes, err := loadGitAttributes(paths, read)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for _, filePath := range paths {
+		binary, lfs := attributes.lookup(filePath)
+		if binary || lfs || !namedAsContent(path.Base(filePath)) {
+			candidates = append(candidates, filePath)
+		}
+	}
+
+	results := make([]*SuspectedBinary, len(candidates))
+	limit := make(chan struct{}, binaryScanConcurrency)
+	var wg sync.WaitGroup
+	for i, filePath := range candidates {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			results[i] = identifyFile(filePath, read)
+		}()
+	}
+	wg.Wait()
+	for _, result := range results {
+		if result != nil {
+			suspectedBinaries = append(suspectedBinaries, *result)
+		}
+	}
+	return suspectedBinaries, nil
+}
+
+// identifyFile reads a file to find whether it is a binary, returning nil when it isn't
+func identifyFile(filePath string, read fileReader) *SuspectedBinary {
+	content, err := read(filePath, binarySniffLength)
+	if err != nil {
+		return &SuspectedBinary{Path: filePath, Unread: err.Error()}
+	}
+	// readers return less than they were asked for only when the file ends first
+	partial := len(content) == binarySniffLength
+	// the PE header of an executable can lie past the start that was read, in which case the file is
+	// read up to its end, within reason
+	if end := peHeaderEnd(content); partial && end > len(content) && end <= peHeaderMaxEnd {
+		if content, err = read(filePath, end); err != nil {
+			return &SuspectedBinary{Path: filePath, Unread: err.Error()}
+		}
+		partial = len(content) == end
+	}
+	kind := identifyBinary(filePath, content)
+	if kind == "" && partial && peHeaderEnd(content) > len(content) {
+		kind = "MZ executable, PE header unconfirmed"
+	}
+	if kind == "" {
+		return nil
+	}
+	// the digest is taken over the whole file, which is read again if only its start was returned
+	if partial {
+		if content, err = read(filePath, 0); err != nil {
+			return &SuspectedBinary{Path: filePath, Type: kind, Unread: err.Error()}
+		}
+	}
+	digest := sha256.Sum256(content)
+	return &SuspectedBinary{Path: filePath, Type: kind, SHA256: hex.EncodeToString(digest[:])}
+}
+
+// peHeaderEnd returns where the PE header that a DOS header points to at e_lfanew ends, or 0 when
+// content doesn't start with a DOS header
+func peHeaderEnd(content []byte) int {
+	if len(content) < 0x40 || !bytes.HasPrefix(content, []byte("MZ")) {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(content[0x3c:0x40])) + 4
+}
+
+// namedAsContent reports whether a file's name shows it to be source, documentation or media
+func namedAsContent(filename string) bool {
+	if knownFilenames[filename] {
+		return true
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	return contentExtensions[ext]
+}
+
+// identifyBinary names the kind of binary in content, or returns "" when it isn't one
+func identifyBinary(filePath string, content []byte) string {
+	if bytes.HasPrefix(content, []byte(lfsPointerPrefix)) {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(filePath), "."))
+		if binaryExtensions[ext] {
+			return fmt.Sprintf("Git LFS object with a .%s extension", ext)
+		}
+		return ""
+	}
+	// Java class files and universal Mach-O binaries share a magic number, followed by the class
+	// file's major version or the number of architectures in the binary
+	if len(content) >= 8 && bytes.HasPrefix(content, []byte("\xca\xfe\xba\xbe")) {
+		if binary.BigEndian.Uint32(content[4:8]) >= 45 {
+			return "Java class file"
+		}
+		return "Mach-O universal binary"
+	}
+	if isPythonBytecode(content) {
+		return "Python bytecode"
+	}
+	for _, signature := range binarySignatures {
+		if len(content) >= signature.offset+len(signature.magic) &&
+			string(content[signature.offset:signature.offset+len(signature.magic)]) == signature.magic &&
+			(signature.check == nil || signature.check(content)) {
+			return signature.kind
+		}
+	}
+	return ""
+}
+
+// hasPESignature confirms a DOS header by the "PE\0\0" signature at the offset it holds in e_lfanew,
+// which separates PE executables from text that starts with "MZ"
+func hasPESignature(content []byte) bool {
+	end := peHeaderEnd(content)
+	return end > 0 && end <= len(content) && string(content[end-4:end]) == "PE\x00\x00"
+}
+
+// hasBzip2BlockSize confirms a bzip2 header by the block size digit that follows "BZh"
+func hasBzip2BlockSize(content []byte) bool {
+	return len(content) > 3 && content[3] >= '1' && content[3] <= '9'
+}
+
+// isPythonBytecode recognises compiled Python files, which start with a version specific number
+// followed by "\r\n". Python 3 uses numbers from 3000 and Python 2 from 62000.
+func isPythonBytecode(content []byte) bool {
+	if len(content) < 4 || content[2] != '\r' || content[3] != '\n' {
+		return false
+	}
+	version := binary.LittleEndian.Uint16(content[:2])
+	return (version >= 3000 && version < 4000) || (version >= 62000 && version < 62300)
+}
+
+// contentsReader reads files through the provider's contents API
+func contentsReader(provider Provider) fileReader {
+	return func(filePath string, _ int) ([]byte, error) {
+		file, _, err := provider.Contents(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if file == nil {
+			return nil, fmt.Errorf("%s is not a file", filePath)
+		}
+		content, err := file.GetContent()
+		return []byte(content), err
+	}
+}
+
+// fetchRepoTree lists every file in the tree at ref, with its path from the root of the tree. The recursive trees API truncates
+// the listings of very large trees, in which case the tree is walked one level at a time instead,
+// listing each subtree recursively where it fits in a single response.
+func fetchRepoTree(ctx context.Context, client *github.Client, owner, repo, ref string) (files []*github.TreeEntry, err error) {
+	return walkRepoTree(ctx, client, owner, repo, ref, "")
+}
+
+func walkRepoTree(ctx context.Context, client *github.Client, owner, repo, sha, prefix string) (files []*github.TreeEntry, err error) {
+	tree, _, err := client.Git.GetTree(ctx, owner, repo, sha, true)
+	if err != nil {
+		return nil, err
+	}
+	if !tree.GetTruncated() {
+		for _, entry := range tree.Entries {
+			if entry.GetType() == "blob" {
+				entry.Path = github.Ptr(prefix + entry.GetPath())
+				files = append(files, entry)
+			}
+		}
+		return files, nil
+	}
+
+	tree, _, err = client.Git.GetTree(ctx, owner, repo, sha, false)
+	if err != nil {
+		return nil, err
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("tree %s has too many entries to list", sha)
+	}
+	for _, entry := range tree.Entries {
+		switch entry.GetType() {
+		case "blob":
+			entry.Path = github.Ptr(prefix + entry.GetPath())
+			files = append(files, entry)
+		case "tree":
+			subtree, err := walkRepoTree(ctx, client, owner, repo, entry.GetSHA(), prefix+entry.GetPath()+"/")
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, subtree...)
+		}
+	}
+	return files, nil
+}
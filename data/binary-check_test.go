@@ -0,0 +1,278 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchRepoTree(t *testing.T) {
+	// trees maps the listing of each tree to its response, keyed by sha and whether it is recursive
+	tests := []struct {
+		name        string
+		trees       map[string]string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name: "complete recursive listing",
+			trees: map[string]string{
+				"main?recursive=1": `{"tree": [
+					{"path": "README.md", "type": "blob"},
+					{"path": "a", "type": "tree", "sha": "a"},
+					{"path": "a/b", "type": "tree", "sha": "b"},
+					{"path": "a/b/c", "type": "tree", "sha": "c"},
+					{"path": "a/b/c/d", "type": "tree", "sha": "d"},
+					{"path": "a/b/c/d/tool.exe", "type": "blob"},
+					{"path": "vendor/lib", "type": "commit"}
+				]}`,
+			},
+			expected: []string{"README.md", "a/b/c/d/tool.exe"},
+		},
+		{
+			name: "truncated listing walks the subtrees",
+			trees: map[string]string{
+				"main?recursive=1":   `{"truncated": true, "tree": [{"path": "README.md", "type": "blob"}]}`,
+				"main":               `{"tree": [{"path": "README.md", "type": "blob"}, {"path": "big", "type": "tree", "sha": "big"}, {"path": "small", "type": "tree", "sha": "small"}]}`,
+				"big?recursive=1":    `{"truncated": true, "tree": []}`,
+				"big":                `{"tree": [{"path": "lib.so", "type": "blob"}, {"path": "nested", "type": "tree", "sha": "nested"}]}`,
+				"nested?recursive=1": `{"tree": [{"path": "deep", "type": "tree", "sha": "deep"}, {"path": "deep/app.dll", "type": "blob"}]}`,
+				"small?recursive=1":  `{"tree": [{"path": "main.go", "type": "blob"}]}`,
+			},
+			expected: []string{"README.md", "big/lib.so", "big/nested/deep/app.dll", "small/main.go"},
+		},
+		{
+			name: "directory too large to list",
+			trees: map[string]string{
+				"main?recursive=1": `{"truncated": true, "tree": []}`,
+				"main":             `{"truncated": true, "tree": []}`,
+			},
+			expectError: true,
+		},
+		{
+			name:        "missing tree",
+			trees:       map[string]string{},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key := r.URL.Path[len("/repos/owner/repo/git/trees/"):]
+				if r.URL.RawQuery != "" {
+					key += "?" + r.URL.RawQuery
+				}
+				response, ok := tt.trees[key]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte(response))
+			}))
+			defer server.Close()
+			client := github.NewClient(server.Client())
+			client.BaseURL, _ = url.Parse(server.URL + "/")
+
+			files, err := fetchRepoTree(context.Background(), client, "owner", "repo", "main")
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var paths []string
+			for _, file := range files {
+				paths = append(paths, file.GetPath())
+			}
+			assert.Equal(t, tt.expected, paths)
+		})
+	}
+}
+
+// peExecutable is the smallest DOS header whose e_lfanew leads to a PE signature
+var peExecutable = "MZ" + strings.Repeat("\x00", 0x3a) + "\x40\x00\x00\x00PE\x00\x00"
+
+func TestIdentifyBinary(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar\x0000")
+	tests := []struct {
+		name     string
+		path     string
+		content  string
+		expected string
+	}{
+		{"elf", "bin/tool", "\x7fELF\x02\x01\x01\x00", "ELF executable"},
+		{"mach-o", "tool", "\xcf\xfa\xed\xfe\x07\x00\x00\x01", "Mach-O executable"},
+		{"universal mach-o", "tool", "\xca\xfe\xba\xbe\x00\x00\x00\x02", "Mach-O universal binary"},
+		{"java class", "Main.class", "\xca\xfe\xba\xbe\x00\x00\x00\x41", "Java class file"},
+		{"renamed pe", "setup.txt", peExecutable, "PE executable"},
+		{"text starting with MZ", "notes", "MZ is short for Mozambique\n" + strings.Repeat(" ", 64), ""},
+		{"dos header without a pe signature", "tool.exe", peExecutable[:0x40] + "NE\x00\x00", ""},
+		{"pe signature past the end of the content", "tool.exe", peExecutable[:0x3c] + "\x00\x02\x00\x00", ""},
+		{"bzip2", "data.bz2", "BZh91AY&SY", "bzip2 archive"},
+		{"text starting with BZh", "notes", "BZh is not an archive\n", ""},
+		{"wasm", "module.wasm", "\x00asm\x01\x00\x00\x00", "WebAssembly module"},
+		{"zip", "lib.jar", "PK\x03\x04\x14\x00", "ZIP archive"},
+		{"gzip", "release.tgz", "\x1f\x8b\x08\x00", "gzip archive"},
+		{"tar", "release.tar", string(tar), "tar archive"},
+		{"python 3 bytecode", "module.pyc", "\xcb\x0d\x0d\x0a\x00\x00\x00\x00", "Python bytecode"},
+		{"python 2 bytecode", "module.pyc", "\x03\xf3\x0d\x0a\x00\x00\x00\x00", "Python bytecode"},
+		{"lfs pointer to an executable", "tools/setup.exe", "version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 12\n", "Git LFS object with a .exe extension"},
+		{"lfs pointer to an image", "docs/logo.bmp", "version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 12\n", ""},
+		{"extensionless script", "configure", "#!/bin/sh\necho configuring\n", ""},
+		{"empty file with a binary extension", "placeholder.exe", "", ""},
+		{"text starting with a carriage return", "notes", "ab\r\nmore notes", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, identifyBinary(tt.path, []byte(tt.content)))
+		})
+	}
+}
+
+func TestScanForBinaries(t *testing.T) {
+	files := map[string]string{
+		".gitattributes":          "*.dat binary\nassets/** filter=lfs diff=lfs merge=lfs -text\n",
+		"README.md":               "# Project\n",
+		"main.go":                 "package main\n",
+		"configure":               "#!/bin/sh\n",
+		"tool":                    "\x7fELF\x02\x01\x01\x00",
+		"firmware.dat":            "\x1f\x8b\x08\x00",
+		"assets/installer.exe":    "version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 12\n",
+		"assets/logo.png":         "version https://git-lfs.github.com/spec/v1\noid sha256:def\nsize 12\n",
+		"vendor/.gitattributes":   "*.dat -binary\n",
+		"vendor/data/archive.dat": "PK\x03\x04",
+	}
+	paths := make([]string, 0, len(files))
+	for filePath := range files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+	var mu sync.Mutex
+	var read []string
+	reader := func(filePath string, _ int) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		read = append(read, filePath)
+		return []byte(files[filePath]), nil
+	}
+
+	suspectedBinaries, err := scanForBinaries(paths, reader)
+	require.NoError(t, err)
+	var found []string
+	for _, binary := range suspectedBinaries {
+		found = append(found, binary.String())
+	}
+	assert.Equal(t, []string{
+		"assets/installer.exe (Git LFS object with a .exe extension)",
+		"firmware.dat (gzip archive)",
+		"tool (ELF executable)",
+		"vendor/data/archive.dat (ZIP archive)",
+	}, found)
+	assert.Equal(t, "e94466faac02d08efbb3109dbe52d0c13c5a53859e328d50dbeb2e6f0ee89871", suspectedBinaries[2].SHA256)
+	assert.NotContains(t, read, "README.md", "documentation is not read")
+	assert.NotContains(t, read, "main.go", "source code is not read")
+	assert.Contains(t, read, "assets/logo.png", "files stored in Git LFS are read")
+
+	t.Run("large binaries are read whole for their digest", func(t *testing.T) {
+		large := append([]byte("\x7fELF"), make([]byte, 2*binarySniffLength)...)
+		var limits []int
+		suspectedBinaries, err := scanForBinaries([]string{"tool"}, func(_ string, limit int) ([]byte, error) {
+			limits = append(limits, limit)
+			if limit > 0 && limit < len(large) {
+				return large[:limit], nil
+			}
+			return large, nil
+		})
+		require.NoError(t, err)
+		digest := sha256.Sum256(large)
+		require.Len(t, suspectedBinaries, 1)
+		assert.Equal(t, hex.EncodeToString(digest[:]), suspectedBinaries[0].SHA256)
+		assert.Equal(t, []int{binarySniffLength, 0}, limits)
+	})
+
+	t.Run("pe headers past the start of a file are read up to", func(t *testing.T) {
+		// a DOS stub long enough to push the PE header past the start that is sniffed
+		stub := []byte(peExecutable[:0x3c] + "\x00\x04\x00\x00")
+		executable := append(append(stub, make([]byte, 0x400-len(stub))...), "PE\x00\x00"...)
+		farAway := append([]byte(peExecutable[:0x3c]+"\x00\x00\x00\x10"), make([]byte, binarySniffLength)...)
+		files := map[string][]byte{"tool.exe": executable, "stub.exe": executable[:0x402], "far.exe": farAway}
+		var limits []int
+		var mu sync.Mutex
+		suspectedBinaries, err := scanForBinaries([]string{"far.exe", "stub.exe", "tool.exe"}, func(filePath string, limit int) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if filePath == "tool.exe" {
+				limits = append(limits, limit)
+			}
+			if content := files[filePath]; limit > 0 && limit < len(content) {
+				return content[:limit], nil
+			}
+			return files[filePath], nil
+		})
+		require.NoError(t, err)
+		var found []string
+		for _, binary := range suspectedBinaries {
+			found = append(found, binary.String())
+		}
+		assert.Equal(t, []string{"far.exe (MZ executable, PE header unconfirmed)", "tool.exe (PE executable)"}, found,
+			"files that end before their PE header aren't executables")
+		assert.Equal(t, []int{binarySniffLength, 0x404, 0}, limits)
+	})
+
+	t.Run("read failures are listed without ending the scan", func(t *testing.T) {
+		suspectedBinaries, err := scanForBinaries([]string{"firmware.dat", "tool"}, func(filePath string, limit int) ([]byte, error) {
+			if filePath == "firmware.dat" {
+				return nil, errors.New("not found")
+			}
+			if limit == 0 {
+				return nil, errors.New("connection reset")
+			}
+			return append([]byte("\x7fELF"), make([]byte, binarySniffLength-4)...), nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []SuspectedBinary{
+			{Path: "firmware.dat", Unread: "not found"},
+			{Path: "tool", Type: "ELF executable", Unread: "connection reset"},
+		}, suspectedBinaries)
+		assert.Equal(t, "firmware.dat (not read: not found)", suspectedBinaries[0].String())
+		assert.Equal(t, "tool (ELF executable)", suspectedBinaries[1].String())
+	})
+
+	t.Run("reads are limited in number at once", func(t *testing.T) {
+		var mu sync.Mutex
+		reading, most := 0, 0
+		paths := make([]string, 4*binaryScanConcurrency)
+		for i := range paths {
+			paths[i] = fmt.Sprintf("tool%d", i)
+		}
+		_, err := scanForBinaries(paths, func(string, int) ([]byte, error) {
+			mu.Lock()
+			reading++
+			most = max(most, reading)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			reading--
+			mu.Unlock()
+			return nil, nil
+		})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, most, binaryScanConcurrency)
+	})
+}
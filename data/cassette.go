@@ -0,0 +1,262 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+)
+
+// cassette records the HTTP exchanges of a run to the file in the cassette var, or replays them
+// from it without any network access, as chosen by the cassette-mode var. Requests are matched on
+// their method, URL and body; credentials are never recorded.
+type cassette struct {
+	path string
+	mode string
+
+	mu sync.Mutex
+	// file is the cassette being recorded, to which each interaction is appended as a line of JSON
+	file         *os.File
+	interactions []interaction
+	// replayed counts the responses served so far for each request, so repeated requests are answered in recorded order
+	replayed map[string]int
+}
+
+type interaction struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body,omitempty"`
+	// BinaryBody holds bodies that aren't valid UTF-8, which can't be kept exactly in a JSON string
+	BinaryBody []byte `json:"binary_body,omitempty"`
+}
+
+func newRecordedResponse(statusCode int, header http.Header, body []byte) recordedResponse {
+	if utf8.Valid(body) {
+		return recordedResponse{StatusCode: statusCode, Header: header, Body: string(body)}
+	}
+	return recordedResponse{StatusCode: statusCode, Header: header, BinaryBody: body}
+}
+
+func (r recordedResponse) body() []byte {
+	if r.BinaryBody != nil {
+		return r.BinaryBody
+	}
+	return []byte(r.Body)
+}
+
+// openCassette prepares the cassette in the config, returning nil when none is configured
+func openCassette(config *config.Config) (*cassette, error) {
+	path := config.GetString("cassette")
+	if path == "" {
+		return nil, nil
+	}
+	c := &cassette{path: path, mode: config.GetString("cassette-mode"), replayed: make(map[string]int)}
+	switch c.mode {
+	case cassetteRecord:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cassette: %w", err)
+		}
+		c.file = file
+		trackCassette(c)
+		return c, nil
+	case cassetteReplay:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		if c.interactions, err = parseCassette(content); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette: %w", err)
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("invalid cassette-mode %q, expected record or replay", c.mode)
+	}
+}
+
+// recordingCassettes are the cassettes recorded in this run, which are closed once the evaluation
+// has finished as the evaluation steps make requests too
+var recordingCassettes struct {
+	sync.Mutex
+	cassettes []*cassette
+}
+
+// CloseCassettes flushes and closes the cassettes recorded in this run, so none is left truncated
+// on exit. It is called after the evaluation has finished.
+func CloseCassettes() error {
+	recordingCassettes.Lock()
+	defer recordingCassettes.Unlock()
+	var errs []error
+	for _, c := range recordingCassettes.cassettes {
+		errs = append(errs, c.close())
+	}
+	recordingCassettes.cassettes = nil
+	return errors.Join(errs...)
+}
+
+// trackCassette adds a cassette to those CloseCassettes closes
+func trackCassette(c *cassette) {
+	recordingCassettes.Lock()
+	defer recordingCassettes.Unlock()
+	recordingCassettes.cassettes = append(recordingCassettes.cassettes, c)
+}
+
+// close syncs the recorded cassette to disk and closes it
+func (c *cassette) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.file.Sync(); err != nil {
+		_ = c.file.Close()
+		return fmt.Errorf("failed to write cassette %s: %w", c.path, err)
+	}
+	if err := c.file.Close(); err != nil {
+		return fmt.Errorf("failed to close cassette %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// replaying reports whether responses come from the cassette rather than the network
+func (c *cassette) replaying() bool {
+	return c != nil && c.mode == cassetteReplay
+}
+
+// wrap returns a transport that records the exchanges made through base, or replays them in its
+// place. Without a cassette base is returned unchanged.
+func (c *cassette) wrap(base http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return base
+	}
+	return &cassetteTransport{cassette: c, base: base}
+}
+
+type cassetteTransport struct {
+	cassette *cassette
+	base     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	recorded := recordedRequest{Method: request.Method, URL: request.URL.String()}
+	if request.Body != nil {
+		body, err := io.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = string(body)
+		request = request.Clone(request.Context())
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if t.cassette.replaying() {
+		return t.cassette.replay(recorded, request)
+	}
+
+	response, err := t.base.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	header := response.Header.Clone()
+	header.Del("Set-Cookie")
+	err = t.cassette.record(interaction{
+		Request:  recorded,
+		Response: newRecordedResponse(response.StatusCode, header, body),
+	})
+	return response, err
+}
+
+func (r recordedRequest) key() string {
+	return r.Method + " " + r.URL + "\n" + r.Body
+}
+
+// record appends an interaction to the cassette as soon as it completes, so requests made by the
+// evaluation steps after loading are captured as well without rewriting what was recorded before.
+// Concurrent requests are written in the order they complete, which doesn't matter when replaying
+// as requests are matched by their content, and repeated requests keep the order they were made in.
+func (c *cassette) record(recorded interaction) error {
+	content, err := json.Marshal(recorded)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.Write(append(content, '\n')); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// parseCassette reads the interactions of a cassette, written one per line
+func parseCassette(content []byte) (interactions []interaction, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for {
+		var recorded interaction
+		if err := decoder.Decode(&recorded); errors.Is(err, io.EOF) {
+			return interactions, nil
+		} else if err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, recorded)
+	}
+}
+
+func (c *cassette) replay(recorded recordedRequest, request *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := recorded.key()
+	seen := 0
+	var match *interaction
+	for i := range c.interactions {
+		if c.interactions[i].Request.key() != key {
+			continue
+		}
+		match = &c.interactions[i]
+		if seen == c.replayed[key] {
+			break
+		}
+		seen++
+	}
+	if match == nil {
+		return nil, errors.New("no response recorded in the cassette for " + recorded.Method + " " + recorded.URL)
+	}
+	// requests repeated more often than recorded are answered with the last recorded response
+	c.replayed[key]++
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", match.Response.StatusCode, http.StatusText(match.Response.StatusCode)),
+		StatusCode:    match.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        match.Response.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(match.Response.body())),
+		ContentLength: int64(len(match.Response.body())),
+		Request:       request,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassette(t *testing.T) {
+	server := githubStandIn(false, false)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	newConfig := func(vars map[string]interface{}) *config.Config {
+		vars["owner"] = "owner"
+		vars["repo"] = "repo"
+		vars["base-url"] = server.URL
+		vars["cassette"] = path
+		return &config.Config{Logger: hclog.NewNullLogger(), Vars: vars}
+	}
+
+	recorded, err := NewLoader(nil)(newConfig(map[string]interface{}{"token": "secret-token", "cassette-mode": "record"}))
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "secret-token")
+
+	// replaying needs neither the network nor credentials
+	server.Close()
+	replayed, err := NewLoader(nil)(newConfig(map[string]interface{}{"cassette-mode": "replay"}))
+	require.NoError(t, err)
+
+	recordedPayload, replayedPayload := recorded.(Payload), replayed.(Payload)
+	assert.Equal(t, recordedPayload.GraphqlRepoData, replayedPayload.GraphqlRepoData)
+	assert.Equal(t, recordedPayload.Unavailable, replayedPayload.Unavailable)
+	assert.Equal(t, recordedPayload.DependencyManifestsCount, replayedPayload.DependencyManifestsCount)
+	assert.Equal(t, recordedPayload.IsCodeRepo, replayedPayload.IsCodeRepo)
+
+	_, err = replayedPayload.MakeApiCall(server.URL+"/api/v3/repos/owner/repo/never-requested", true)
+	assert.ErrorContains(t, err, "no response recorded in the cassette")
+
+	// each request is appended to the cassette as it completes, and repeated requests replay in order
+	appended := filepath.Join(t.TempDir(), "cassette.json")
+	server = githubStandIn(false, false)
+	defer server.Close()
+	tape, err := openCassette(&config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"cassette": appended, "cassette-mode": "record"}})
+	require.NoError(t, err)
+	for i, url := range []string{server.URL + "/b", server.URL + "/a", server.URL + "/b"} {
+		response, err := (&http.Client{Transport: tape.wrap(http.DefaultTransport)}).Get(url)
+		require.NoError(t, err)
+		_ = response.Body.Close()
+		content, err := os.ReadFile(appended)
+		require.NoError(t, err)
+		assert.Len(t, strings.Split(strings.TrimSpace(string(content)), "\n"), i+1)
+	}
+	content, err = os.ReadFile(appended)
+	require.NoError(t, err)
+	interactions, err := parseCassette(content)
+	require.NoError(t, err)
+	require.Len(t, interactions, 3)
+	assert.Equal(t, server.URL+"/b", interactions[0].Request.URL)
+	assert.Equal(t, server.URL+"/a", interactions[1].Request.URL)
+
+	// cassettes are closed once the run finishes
+	require.NoError(t, CloseCassettes())
+	_, err = (&http.Client{Transport: tape.wrap(http.DefaultTransport)}).Get(server.URL + "/a")
+	assert.ErrorContains(t, err, "failed to write cassette")
+}
+
+func TestParseCassette(t *testing.T) {
+	lines := `{"request": {"method": "GET", "url": "https://api.github.com/a"}, "response": {"status_code": 200, "header": {}}}
+{"request": {"method": "GET", "url": "https://api.github.com/b"}, "response": {"status_code": 404, "header": {}}}
+`
+	interactions, err := parseCassette([]byte(lines))
+	require.NoError(t, err)
+	require.Len(t, interactions, 2)
+	assert.Equal(t, 404, interactions[1].Response.StatusCode)
+
+	_, err = parseCassette([]byte("{not json"))
+	assert.Error(t, err)
+}
+
+func TestOpenCassette(t *testing.T) {
+	tests := []struct {
+		name        string
+		vars        map[string]interface{}
+		expectNil   bool
+		expectError bool
+	}{
+		{name: "no cassette", vars: map[string]interface{}{}, expectNil: true},
+		{name: "record", vars: map[string]interface{}{"cassette": filepath.Join(t.TempDir(), "cassette.json"), "cassette-mode": "record"}},
+		{name: "missing mode", vars: map[string]interface{}{"cassette": "cassette.json"}, expectError: true},
+		{name: "replay without a recording", vars: map[string]interface{}{"cassette": filepath.Join(t.TempDir(), "missing.json"), "cassette-mode": "replay"}, expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tape, err := openCassette(&config.Config{Logger: hclog.NewNullLogger(), Vars: tt.vars})
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectNil, tape == nil)
+		})
+	}
+}
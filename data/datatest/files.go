@@ -0,0 +1,89 @@
+// Package datatest provides a data.Provider serving repository files from memory, for tests of
+// evaluation steps that read the repository's files
+package datatest
+
+import (
+	"encoding/base64"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/hashicorp/go-hclog"
+	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
+
+	"github.com/revanite-io/pvtr-github-repo/data"
+)
+
+// UnreadableFile is the content of a file in Files that is listed but fails to be read
+const UnreadableFile = "\x00unreadable"
+
+// Files serves repository files from memory, keyed by their path from the repository root.
+// Everything else the provider supplies is empty.
+type Files map[string]string
+
+func (f Files) Contents(repoPath string) (*github.RepositoryContent, []*github.RepositoryContent, error) {
+	repoPath = strings.Trim(repoPath, "/")
+	if content, ok := f[repoPath]; ok {
+		if content == UnreadableFile {
+			return nil, nil, errors.New("403 resource not accessible")
+		}
+		return &github.RepositoryContent{
+			Type:     github.Ptr("file"),
+			Name:     github.Ptr(path.Base(repoPath)),
+			Path:     github.Ptr(repoPath),
+			Encoding: github.Ptr("base64"),
+			Content:  github.Ptr(base64.StdEncoding.EncodeToString([]byte(content))),
+		}, nil, nil
+	}
+	var dir []*github.RepositoryContent
+	listed := make(map[string]bool)
+	for filePath := range f {
+		rest, ok := filePath, true
+		if repoPath != "" {
+			rest, ok = strings.CutPrefix(filePath, repoPath+"/")
+		}
+		name, _, isDir := strings.Cut(rest, "/")
+		if !ok || listed[name] {
+			continue
+		}
+		listed[name] = true
+		entryType := "file"
+		if isDir {
+			entryType = "dir"
+		}
+		dir = append(dir, &github.RepositoryContent{
+			Type: github.Ptr(entryType),
+			Name: github.Ptr(name),
+			Path: github.Ptr(path.Join(repoPath, name)),
+		})
+	}
+	if len(dir) == 0 && repoPath != "" {
+		return nil, nil, errors.New("not found")
+	}
+	slices.SortFunc(dir, func(a, b *github.RepositoryContent) int { return strings.Compare(a.GetPath(), b.GetPath()) })
+	return nil, dir, nil
+}
+
+func (f Files) Releases() ([]data.ReleaseData, error) { return nil, nil }
+
+func (f Files) WorkflowPermissions() (bool, data.WorkflowPermissions, error) {
+	return true, data.WorkflowPermissions{}, nil
+}
+
+func (f Files) BranchProtection() (data.BranchProtection, error) {
+	return data.BranchProtection{}, nil
+}
+
+func (f Files) SecurityPosture(si.SecurityInsights) (data.SecurityPosture, error) {
+	return nil, nil
+}
+
+func (f Files) RepositoryMetadata() (data.RepositoryMetadata, error) { return nil, nil }
+
+// PayloadWithFiles builds a payload for a repository holding files
+func PayloadWithFiles(files map[string]string) data.Payload {
+	return data.NewPayload(&config.Config{Logger: hclog.NewNullLogger()}, Files(files))
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// gitAttributeRule is a line of a .gitattributes file, reduced to the attributes that matter when
+// scanning for binaries. Each attribute is 1 when the line sets it, -1 when it unsets it and 0 when
+// the line leaves it alone.
+type gitAttributeRule struct {
+	// dir is the directory holding the .gitattributes file, with a trailing slash unless it is the root
+	dir string
+	// basename is set for patterns without a slash, which match a file name at any depth
+	basename bool
+	pattern  *regexp.Regexp
+	binary   int
+	lfs      int
+}
+
+// gitAttributes holds the rules of every .gitattributes file in a tree, shallowest first, so that
+// later rules take precedence as they do in git
+type gitAttributes []gitAttributeRule
+
+// loadGitAttributes reads and parses the .gitattributes files among paths
+func loadGitAttributes(paths []string, read fileReader) (attributes gitAttributes, err error) {
+	var files []string
+	for _, filePath := range paths {
+		if path.Base(filePath) == ".gitattributes" {
+			files = append(files, filePath)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return strings.Count(files[i], "/") < strings.Count(files[j], "/")
+	})
+	for _, filePath := range files {
+		content, err := read(filePath, 0)
+		if err != nil {
+			return nil, err
+		}
+		dir := strings.TrimSuffix(filePath, ".gitattributes")
+		attributes = append(attributes, parseGitAttributes(dir, string(content))...)
+	}
+	return attributes, nil
+}
+
+func parseGitAttributes(dir, content string) (rules []gitAttributeRule) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		// macro definitions start with [attr], and only apply to the attributes they name
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+		rule := gitAttributeRule{dir: dir}
+		for _, attribute := range fields[1:] {
+			switch attribute {
+			case "binary", "-text", "-diff":
+				rule.binary = 1
+			case "text", "diff", "-binary", "!binary":
+				rule.binary = -1
+			case "filter=lfs":
+				rule.lfs = 1
+			case "-filter", "!filter":
+				rule.lfs = -1
+			default:
+				if strings.HasPrefix(attribute, "filter=") {
+					rule.lfs = -1
+				}
+			}
+		}
+		if rule.binary == 0 && rule.lfs == 0 {
+			continue
+		}
+		pattern := fields[0]
+		rule.basename = !strings.Contains(pattern, "/")
+		if rule.pattern = globPattern(strings.TrimPrefix(pattern, "/")); rule.pattern != nil {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// lookup reports whether the file at filePath is marked as binary or stored in Git LFS
+func (attributes gitAttributes) lookup(filePath string) (binary, lfs bool) {
+	for _, rule := range attributes {
+		if !strings.HasPrefix(filePath, rule.dir) {
+			continue
+		}
+		name := strings.TrimPrefix(filePath, rule.dir)
+		if rule.basename {
+			name = path.Base(name)
+		}
+		if !rule.pattern.MatchString(name) {
+			continue
+		}
+		if rule.binary != 0 {
+			binary = rule.binary > 0
+		}
+		if rule.lfs != 0 {
+			lfs = rule.lfs > 0
+		}
+	}
+	return binary, lfs
+}
+
+// globPattern converts a gitattributes pattern into a regular expression, or nil when it is
+// malformed. "*" and "?" don't match a slash, while "**" matches any number of directories.
+func globPattern(pattern string) *regexp.Regexp {
+	var expression strings.Builder
+	expression.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expression.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expression.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expression.WriteString("[^/]")
+		case pattern[i] == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expression.WriteString(regexp.QuoteMeta(pattern[i:]))
+				i = len(pattern)
+				break
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expression.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expression.WriteString("$")
+	compiled, err := regexp.Compile(expression.String())
+	if err != nil {
+		// a malformed pattern matches nothing
+		return nil
+	}
+	return compiled
+}
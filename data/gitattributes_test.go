@@ -0,0 +1,40 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitAttributesLookup(t *testing.T) {
+	attributes := gitAttributes(append(
+		parseGitAttributes("", "# comment\n[attr]bin -diff -merge -text\n*.bin binary\n/firmware/*.img -text\nmodels/**/*.onnx filter=lfs\n*.txt text\n"),
+		parseGitAttributes("third_party/", "*.bin -binary\nblobs/[a-c]?.so filter=lfs\n")...,
+	))
+	tests := []struct {
+		path   string
+		binary bool
+		lfs    bool
+	}{
+		{path: "tool.bin", binary: true},
+		{path: "deep/in/the/tree/tool.bin", binary: true},
+		{path: "firmware/boot.img", binary: true},
+		{path: "other/firmware/boot.img"},
+		{path: "firmware/nested/boot.img"},
+		{path: "models/model.onnx", lfs: true},
+		{path: "models/v2/large/model.onnx", lfs: true},
+		{path: "notes.txt"},
+		{path: "third_party/tool.bin"},
+		{path: "third_party/blobs/a1.so", lfs: true},
+		{path: "third_party/blobs/d1.so"},
+		{path: "blobs/a1.so"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			binary, lfs := attributes.lookup(tt.path)
+			assert.Equal(t, tt.binary, binary)
+			assert.Equal(t, tt.lfs, lfs)
+		})
+	}
+}
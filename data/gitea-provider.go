@@ -0,0 +1,279 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// the default maximum page size of a Gitea or Forgejo instance
+const giteaPageSize = 50
+
+// reasons reported for data the Gitea and Forgejo APIs do not provide
+var giteaUnavailable = map[string]string{
+	WorkflowPermissionsData: "Gitea and Forgejo do not expose the default permissions of the Actions token; manual review required",
+	DependencyGraphData:     "Gitea and Forgejo do not provide a dependency graph; manual review required",
+	StatusChecksData:        "Commit statuses are not evaluated as status checks on Gitea or Forgejo; manual review required",
+}
+
+// Forgejo reads workflows from .forgejo/workflows and Gitea from .gitea/workflows,
+// each falling back to .github/workflows when their own directory is absent
+var giteaWorkflowDirectories = []string{".forgejo/workflows", ".gitea/workflows", ".github/workflows"}
+
+// giteaProvider supplies repository data from the Gitea API, which Forgejo also implements
+type giteaProvider struct {
+	apiBase    string
+	owner      string
+	repo       string
+	token      string
+	config     *config.Config
+	httpClient HttpClient
+	repository giteaRepository
+}
+
+type giteaRepository struct {
+	Name          string `json:"name"`
+	Private       bool   `json:"private"`
+	Internal      bool   `json:"internal"`
+	Archived      bool   `json:"archived"`
+	DefaultBranch string `json:"default_branch"`
+	HasIssues     bool   `json:"has_issues"`
+	HasActions    bool   `json:"has_actions"`
+}
+
+type giteaBranchProtection struct {
+	BranchName               string   `json:"branch_name"`
+	RuleName                 string   `json:"rule_name"`
+	EnablePush               bool     `json:"enable_push"`
+	EnablePushWhitelist      bool     `json:"enable_push_whitelist"`
+	EnableForcePush          bool     `json:"enable_force_push"`
+	EnableForcePushAllowlist bool     `json:"enable_force_push_allowlist"`
+	RequiredApprovals        int      `json:"required_approvals"`
+	DismissStaleApprovals    bool     `json:"dismiss_stale_approvals"`
+	RequireSignedCommits     bool     `json:"require_signed_commits"`
+	EnableStatusCheck        bool     `json:"enable_status_check"`
+	StatusCheckContexts      []string `json:"status_check_contexts"`
+}
+
+type giteaTree struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"` // "blob" for files, "tree" for directories
+	} `json:"tree"`
+	TotalCount int `json:"total_count"`
+}
+
+// loadGiteaPayload builds the payload for the repository at owner/repo on the Gitea or Forgejo
+// instance in the base-url var
+func loadGiteaPayload(config *config.Config, httpClient HttpClient) (Payload, error) {
+	baseURL := config.GetString("base-url")
+	if baseURL == "" {
+		return Payload{}, errors.New("base-url is required to evaluate a repository on Gitea or Forgejo")
+	}
+	provider := &giteaProvider{
+		apiBase:    strings.TrimSuffix(baseURL, "/") + "/api/v1",
+		owner:      config.GetString("owner"),
+		repo:       config.GetString("repo"),
+		token:      config.GetString("token"),
+		config:     config,
+		httpClient: httpClient,
+	}
+	if err := provider.getJSON(provider.repoEndpoint(""), &provider.repository); err != nil {
+		return Payload{}, fmt.Errorf("failed to retrieve repository: %w", err)
+	}
+
+	payload := NewPayload(config, provider)
+	for _, source := range []string{DependencyGraphData, StatusChecksData} {
+		payload.Unavailable[source] = giteaUnavailable[source]
+	}
+	payload.WorkflowDirectories = giteaWorkflowDirectories
+
+	payload.GraphqlRepoData = payload.describeRepository(provider.repository.Name, provider.repository.DefaultBranch, provider.headCommit(), provider.repository.HasIssues)
+
+	if headCommit := payload.Repository.DefaultBranchRef.Target.OID; headCommit != "" {
+		paths, err := provider.treeFiles(headCommit)
+		if err != nil {
+			return Payload{}, fmt.Errorf("failed to scan repository tree: %w", err)
+		}
+		if payload.SuspectedBinaries, err = scanForBinaries(paths, contentsReader(provider)); err != nil {
+			return Payload{}, fmt.Errorf("failed to scan repository for binaries: %w", err)
+		}
+	}
+
+	var languages map[string]int64
+	if err := provider.getJSON(provider.repoEndpoint("/languages"), &languages); err != nil {
+		return Payload{}, fmt.Errorf("failed to retrieve repository languages: %w", err)
+	}
+	payload.IsCodeRepo = len(languages) > 0
+	return payload, nil
+}
+
+// Contents uses the contents API, which returns the same shapes as GitHub's
+func (g *giteaProvider) Contents(repoPath string) (file *github.RepositoryContent, dir []*github.RepositoryContent, err error) {
+	clean := path.Clean("/" + repoPath)[1:]
+	endpoint := g.repoEndpoint("/contents")
+	if clean != "" {
+		endpoint += "/" + escapePath(clean)
+	}
+	endpoint += "?ref=" + url.QueryEscape(g.repository.DefaultBranch)
+
+	var raw json.RawMessage
+	if err := g.getJSON(endpoint, &raw); err != nil {
+		return nil, nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		err = json.Unmarshal(raw, &dir)
+		return nil, dir, err
+	}
+	err = json.Unmarshal(raw, &file)
+	return file, nil, err
+}
+
+func (g *giteaProvider) Releases() ([]ReleaseData, error) {
+	return getAllPages[ReleaseData](g.getJSON, g.repoEndpoint("/releases"), "limit", giteaPageSize)
+}
+
+func (g *giteaProvider) WorkflowPermissions() (bool, WorkflowPermissions, error) {
+	return g.repository.HasActions, WorkflowPermissions{}, errors.New(giteaUnavailable[WorkflowPermissionsData])
+}
+
+// BranchProtection maps the branch protection rule covering the default branch. Protected
+// branches can't be deleted, while unprotected ones can be deleted or force pushed by any writer.
+func (g *giteaProvider) BranchProtection() (protection BranchProtection, err error) {
+	var rules []giteaBranchProtection
+	if err := g.getJSON(g.repoEndpoint("/branch_protections"), &rules); err != nil {
+		return protection, err
+	}
+	patterns := make([]string, len(rules))
+	for i, rule := range rules {
+		patterns[i] = rule.RuleName
+		if patterns[i] == "" {
+			patterns[i] = rule.BranchName
+		}
+	}
+	i := matchBranchPattern(patterns, g.repository.DefaultBranch)
+	if i < 0 {
+		return BranchProtection{AllowsDeletions: true, AllowsForcePushes: true}, nil
+	}
+	rule := rules[i]
+	return BranchProtection{
+		RestrictsPushes:              !rule.EnablePush || rule.EnablePushWhitelist,
+		RequiresApprovingReviews:     rule.RequiredApprovals > 0,
+		RequiredApprovingReviewCount: rule.RequiredApprovals,
+		RequiresLastPushApproval:     rule.DismissStaleApprovals,
+		RequiresCommitSignatures:     rule.RequireSignedCommits,
+		RequiresStatusChecks:         rule.EnableStatusCheck,
+		RequiredStatusChecks:         rule.StatusCheckContexts,
+		AllowsForcePushes:            rule.EnablePush && rule.EnableForcePush && !rule.EnableForcePushAllowlist,
+	}, nil
+}
+
+// SecurityPosture relies on Security Insights claims alone, as Gitea and Forgejo have no built-in secret scanning
+func (g *giteaProvider) SecurityPosture(insights si.SecurityInsights) (SecurityPosture, error) {
+	return buildInsightsSecurityPosture(RestData{Insights: insights}), nil
+}
+
+func (g *giteaProvider) RepositoryMetadata() (RepositoryMetadata, error) {
+	metadata := &GiteaRepositoryMetadata{repository: g.repository}
+	var organization giteaOrganization
+	// users own repositories too, in which case there is no organization to report on
+	if err := g.getJSON(fmt.Sprintf("%s/orgs/%s", g.apiBase, url.PathEscape(g.owner)), &organization); err == nil {
+		metadata.organization = &organization
+	}
+	return metadata, nil
+}
+
+// headCommit returns the SHA of the latest commit on the default branch
+func (g *giteaProvider) headCommit() string {
+	var branch struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	if err := g.getJSON(g.repoEndpoint("/branches/"+escapePath(g.repository.DefaultBranch)), &branch); err != nil {
+		g.config.Logger.Trace(fmt.Sprintf("failed to retrieve default branch: %s", err.Error()))
+	}
+	return branch.Commit.ID
+}
+
+// treeFiles lists the path of every file in the tree at sha, paging through the recursive tree listing
+func (g *giteaProvider) treeFiles(sha string) (paths []string, err error) {
+	seen := 0
+	for page := 1; ; page++ {
+		var tree giteaTree
+		endpoint := g.repoEndpoint(fmt.Sprintf("/git/trees/%s?recursive=true&per_page=%d&page=%d", url.PathEscape(sha), giteaPageSize, page))
+		if err := g.getJSON(endpoint, &tree); err != nil {
+			return nil, err
+		}
+		for _, entry := range tree.Tree {
+			if entry.Type == "blob" {
+				paths = append(paths, entry.Path)
+			}
+		}
+		seen += len(tree.Tree)
+		if len(tree.Tree) == 0 || seen >= tree.TotalCount {
+			return paths, nil
+		}
+	}
+}
+
+func (g *giteaProvider) repoEndpoint(suffix string) string {
+	return fmt.Sprintf("%s/repos/%s/%s%s", g.apiBase, url.PathEscape(g.owner), url.PathEscape(g.repo), suffix)
+}
+
+func (g *giteaProvider) getJSON(endpoint string, target any) error {
+	if g.config != nil && g.config.Logger != nil {
+		g.config.Logger.Trace(fmt.Sprintf("GET %s", endpoint))
+	}
+	responseData, err := makeApiCall(g.httpClient, endpoint, g.token)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(responseData, target)
+}
+
+// escapePath escapes each segment of a slash separated repository path
+func escapePath(repoPath string) string {
+	segments := strings.Split(repoPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+type giteaOrganization struct {
+	Website string `json:"website"`
+}
+
+// GiteaRepositoryMetadata reports repository metadata from a Gitea or Forgejo repository and its owning organization
+type GiteaRepositoryMetadata struct {
+	repository   giteaRepository
+	organization *giteaOrganization
+}
+
+func (r *GiteaRepositoryMetadata) IsActive() bool {
+	return !r.repository.Archived
+}
+
+func (r *GiteaRepositoryMetadata) IsPublic() bool {
+	return !r.repository.Private && !r.repository.Internal
+}
+
+func (r *GiteaRepositoryMetadata) OrganizationBlogURL() *string {
+	if r.organization == nil || r.organization.Website == "" {
+		return nil
+	}
+	return &r.organization.Website
+}
+
+// IsMFARequiredForAdministrativeActions is always nil, as Gitea and Forgejo organizations can't require two-factor authentication
+func (r *GiteaRepositoryMetadata) IsMFARequiredForAdministrativeActions() *bool {
+	return nil
+}
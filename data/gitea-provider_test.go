@@ -0,0 +1,203 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var giteaTestFiles = map[string]string{
+	"README.md":                  "# Project\n",
+	"LICENSE":                    "MIT License\n\nPermission is hereby granted, free of charge, to any person\n",
+	".forgejo/workflows/ci.yml":  "on: push\njobs:\n  test:\n    runs-on: docker\n    steps:\n      - run: echo \"${{ github.event.pull_request.title }}\"\n",
+	".github/workflows/old.yml":  "on: push\njobs:\n  test:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n",
+	"firmware/blob.so":           "\x7fELF\x02\x01\x01",
+	"firmware/deeply/nested.dll": peExecutable,
+}
+
+// newGiteaTestServer stands in for the Gitea/Forgejo v1 API, serving owner/repo
+func newGiteaTestServer(branchProtections string) *httptest.Server {
+	responses := map[string]any{
+		"/api/v1/repos/owner/repo": map[string]any{
+			"name": "repo", "default_branch": "main", "has_issues": true, "has_actions": true,
+		},
+		"/api/v1/repos/owner/repo/branches/main":      map[string]any{"commit": map[string]any{"id": "def456"}},
+		"/api/v1/repos/owner/repo/languages":          map[string]any{"Go": 1024},
+		"/api/v1/repos/owner/repo/branch_protections": json.RawMessage(branchProtections),
+		"/api/v1/repos/owner/repo/releases": []map[string]any{
+			{"id": 1, "name": "v1.0.0", "tag_name": "v1.0.0", "body": "Changelog", "prerelease": false,
+				"assets": []map[string]any{{"name": "repo-v1.0.0.tar.gz", "browser_download_url": "https://example.com/repo-v1.0.0.tar.gz"}}},
+		},
+		"/api/v1/orgs/owner": map[string]any{"website": "https://example.com"},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var response any
+		switch {
+		case r.URL.Path == "/api/v1/repos/owner/repo/git/trees/def456":
+			// the tree is served over two pages to exercise pagination
+			entries := []map[string]string{{"path": "firmware", "type": "tree"}}
+			for name := range giteaTestFiles {
+				entries = append(entries, map[string]string{"path": name, "type": "blob"})
+			}
+			sort.Slice(entries, func(i, j int) bool { return entries[i]["path"] < entries[j]["path"] })
+			total := len(entries)
+			if r.URL.Query().Get("page") == "2" {
+				entries = entries[total/2:]
+			} else {
+				entries = entries[:total/2]
+			}
+			response = map[string]any{"tree": entries, "total_count": total}
+		case strings.HasPrefix(r.URL.Path, "/api/v1/repos/owner/repo/contents"):
+			dirPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/repos/owner/repo/contents"), "/")
+			if content, ok := giteaTestFiles[dirPath]; ok {
+				response = map[string]any{
+					"name": dirPath[strings.LastIndex(dirPath, "/")+1:], "path": dirPath, "type": "file",
+					"encoding": "base64", "content": base64.StdEncoding.EncodeToString([]byte(content)),
+				}
+				break
+			}
+			listing := map[string]map[string]string{}
+			for name := range giteaTestFiles {
+				if dirPath != "" && !strings.HasPrefix(name, dirPath+"/") {
+					continue
+				}
+				rest := strings.TrimPrefix(strings.TrimPrefix(name, dirPath), "/")
+				entry, isDir := rest, strings.Contains(rest, "/")
+				if isDir {
+					entry = rest[:strings.Index(rest, "/")]
+				}
+				entryPath := strings.TrimPrefix(dirPath+"/"+entry, "/")
+				entryType := "file"
+				if isDir {
+					entryType = "dir"
+				}
+				listing[entryPath] = map[string]string{"name": entry, "path": entryPath, "type": entryType}
+			}
+			if len(listing) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var entries []map[string]string
+			for _, entry := range listing {
+				entries = append(entries, entry)
+			}
+			response = entries
+		default:
+			var ok bool
+			if response, ok = responses[r.URL.Path]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func giteaTestConfig(baseURL string) *config.Config {
+	return &config.Config{
+		Logger: hclog.NewNullLogger(),
+		Vars: map[string]interface{}{
+			"owner":    "owner",
+			"repo":     "repo",
+			"token":    "test-token",
+			"forge":    "forgejo",
+			"base-url": baseURL,
+		},
+	}
+}
+
+func TestLoadGiteaPayload(t *testing.T) {
+	server := newGiteaTestServer(`[{"rule_name": "main", "enable_push": true, "enable_push_whitelist": true, "required_approvals": 1, "dismiss_stale_approvals": true}]`)
+	defer server.Close()
+
+	payload, err := loadGiteaPayload(giteaTestConfig(server.URL), server.Client())
+	require.NoError(t, err)
+
+	assert.Equal(t, "repo", payload.Repository.Name)
+	assert.Equal(t, "def456", payload.Repository.DefaultBranchRef.Target.OID)
+	assert.Equal(t, "MIT", payload.Repository.LicenseInfo.SpdxId)
+	assert.True(t, payload.IsCodeRepo)
+	assert.ElementsMatch(t, []SuspectedBinary{
+		{Path: "firmware/blob.so", Type: "ELF executable", SHA256: "ced1af6d51438341a0335cc00e1c2867fb718a537c1173cf210070a6b1cdf40a"},
+		{Path: "firmware/deeply/nested.dll", Type: "PE executable", SHA256: "a62041514d88e5f81ab7810f0a637eda55e0e552e84636fef50665fea71cf31d"},
+	}, payload.SuspectedBinaries)
+
+	assert.Equal(t, BranchProtection{
+		RestrictsPushes:              true,
+		RequiresApprovingReviews:     true,
+		RequiredApprovingReviewCount: 1,
+		RequiresLastPushApproval:     true,
+	}, payload.BranchProtection)
+	assert.True(t, payload.WorkflowsEnabled)
+	assert.Contains(t, payload.Unavailable, WorkflowPermissionsData)
+
+	require.Len(t, payload.Releases, 1)
+	release, found := payload.LatestRelease()
+	assert.True(t, found)
+	assert.Equal(t, "Changelog", release.Description)
+	assert.Equal(t, "repo-v1.0.0.tar.gz", release.Assets[0].Name)
+
+	assert.True(t, payload.RepositoryMetadata.IsPublic())
+	assert.Equal(t, "https://example.com", *payload.RepositoryMetadata.OrganizationBlogURL())
+	assert.Nil(t, payload.RepositoryMetadata.IsMFARequiredForAdministrativeActions())
+
+	workflows, err := payload.GetWorkflowFiles()
+	require.NoError(t, err)
+	require.Len(t, workflows, 1, ".forgejo/workflows takes precedence over .github/workflows")
+	assert.Equal(t, ".forgejo/workflows/ci.yml", workflows[0].GetPath())
+}
+
+func TestGiteaBranchProtection(t *testing.T) {
+	tests := []struct {
+		name              string
+		branchProtections string
+		expected          BranchProtection
+	}{
+		{
+			name:              "unprotected default branch",
+			branchProtections: `[{"rule_name": "release/*", "enable_push": false}]`,
+			expected:          BranchProtection{AllowsDeletions: true, AllowsForcePushes: true},
+		},
+		{
+			name:              "wildcard rule allowing force pushes and requiring status checks",
+			branchProtections: `[{"rule_name": "ma*", "enable_push": true, "enable_force_push": true, "enable_status_check": true, "status_check_contexts": ["ci/test"]}]`,
+			expected:          BranchProtection{AllowsForcePushes: true, RequiresStatusChecks: true, RequiredStatusChecks: []string{"ci/test"}},
+		},
+		{
+			name:              "legacy branch name rule disabling pushes",
+			branchProtections: `[{"branch_name": "main", "enable_push": false, "require_signed_commits": true}]`,
+			expected:          BranchProtection{RestrictsPushes: true, RequiresCommitSignatures: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGiteaTestServer(tt.branchProtections)
+			defer server.Close()
+
+			payload, err := loadGiteaPayload(giteaTestConfig(server.URL), server.Client())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, payload.BranchProtection)
+		})
+	}
+}
+
+func TestLoadGiteaPayload_MissingBaseURL(t *testing.T) {
+	cfg := giteaTestConfig("")
+	_, err := loadGiteaPayload(cfg, http.DefaultClient)
+	assert.Error(t, err)
+}
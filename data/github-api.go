@@ -0,0 +1,59 @@
+package data
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/shurcooL/githubv4"
+)
+
+// githubAPI locates the REST and GraphQL APIs of github.com or a GitHub Enterprise instance
+type githubAPI struct {
+	restBase   string
+	graphqlURL string
+}
+
+// resolveGithubAPI derives the API locations from the base-url var, which is empty for github.com or
+// the web address of a GitHub Enterprise Server (https://github.example.com) or GHE.com (https://example.ghe.com) instance
+func resolveGithubAPI(baseURL string) (githubAPI, error) {
+	if baseURL == "" {
+		return githubAPI{restBase: APIBase, graphqlURL: APIBase + "/graphql"}, nil
+	}
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return githubAPI{}, fmt.Errorf("invalid base-url: %w", err)
+	}
+	if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return githubAPI{}, fmt.Errorf("invalid base-url %q, expected an http(s) address such as https://github.example.com", baseURL)
+	}
+
+	switch {
+	case parsed.Host == "github.com" || parsed.Host == "api.github.com":
+		return githubAPI{restBase: APIBase, graphqlURL: APIBase + "/graphql"}, nil
+	case strings.HasSuffix(parsed.Host, ".ghe.com"):
+		// GHE.com serves its APIs from a dedicated api. subdomain, like github.com
+		apiHost := parsed.Host
+		if !strings.HasPrefix(apiHost, "api.") {
+			apiHost = "api." + apiHost
+		}
+		restBase := fmt.Sprintf("%s://%s", parsed.Scheme, apiHost)
+		return githubAPI{restBase: restBase, graphqlURL: restBase + "/graphql"}, nil
+	default:
+		// GitHub Enterprise Server serves both APIs under /api on the instance's own host
+		root := fmt.Sprintf("%s://%s%s", parsed.Scheme, parsed.Host, strings.TrimSuffix(parsed.Path, "/api/v3"))
+		return githubAPI{restBase: root + "/api/v3", graphqlURL: root + "/api/graphql"}, nil
+	}
+}
+
+// clients returns REST and GraphQL clients for the API, both sending requests through httpClient
+func (a githubAPI) clients(httpClient *http.Client) (rest *github.Client, graphql *githubv4.Client, err error) {
+	rest = github.NewClient(httpClient)
+	rest.BaseURL, err = url.Parse(a.restBase + "/")
+	if err != nil {
+		return nil, nil, err
+	}
+	return rest, githubv4.NewEnterpriseClient(a.graphqlURL, httpClient), nil
+}
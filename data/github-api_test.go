@@ -0,0 +1,102 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/shurcooL/githubv4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveGithubAPI(t *testing.T) {
+	tests := []struct {
+		name            string
+		baseURL         string
+		expectedREST    string
+		expectedGraphql string
+		expectError     bool
+	}{
+		{"default", "", "https://api.github.com", "https://api.github.com/graphql", false},
+		{"github.com web address", "https://github.com/", "https://api.github.com", "https://api.github.com/graphql", false},
+		{"enterprise server", "https://github.example.com", "https://github.example.com/api/v3", "https://github.example.com/api/graphql", false},
+		{"enterprise server rest address", "https://github.example.com/api/v3/", "https://github.example.com/api/v3", "https://github.example.com/api/graphql", false},
+		{"enterprise server under a path", "http://proxy.internal/github", "http://proxy.internal/github/api/v3", "http://proxy.internal/github/api/graphql", false},
+		{"ghe.com", "https://octocorp.ghe.com", "https://api.octocorp.ghe.com", "https://api.octocorp.ghe.com/graphql", false},
+		{"missing scheme", "github.example.com", "", "", true},
+		{"unsupported scheme", "ftp://github.example.com", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, err := resolveGithubAPI(tt.baseURL)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedREST, api.restBase)
+			assert.Equal(t, tt.expectedGraphql, api.graphqlURL)
+		})
+	}
+}
+
+// TestGithubEnterpriseRequests checks that every way of calling the API is sent to the enterprise instance
+func TestGithubEnterpriseRequests(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/api/graphql":
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"repository": map[string]any{"name": "repo"}}})
+		case "/api/v3/repos/owner/repo":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "repo"})
+		default:
+			_, _ = w.Write([]byte("[]"))
+		}
+	}))
+	defer server.Close()
+
+	api, err := resolveGithubAPI(server.URL)
+	require.NoError(t, err)
+	ghClient, client, err := api.clients(server.Client())
+	require.NoError(t, err)
+	cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"owner": "owner", "repo": "repo"}}
+
+	repository, _, err := ghClient.Repositories.Get(context.Background(), "owner", "repo")
+	require.NoError(t, err)
+	assert.Equal(t, "repo", repository.GetName())
+
+	var query struct {
+		Repository struct {
+			Name string
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	err = client.Query(context.Background(), &query, map[string]any{"owner": githubv4.String("owner"), "name": githubv4.String("repo")})
+	require.NoError(t, err)
+	assert.Equal(t, "repo", query.Repository.Name)
+
+	provider := &githubProvider{apiBase: api.restBase, owner: "owner", repo: "repo", config: cfg, httpClient: server.Client()}
+	_, err = provider.Releases()
+	require.NoError(t, err)
+
+	rest := &RestData{owner: "owner", repo: "repo", Config: cfg, HttpClient: server.Client(), apiBase: api.restBase}
+	cfg.Vars["resolve-remote-calls"] = "true"
+	_, _ = rest.GetRemoteFileContent("other/actions", "main", "action.yml")
+
+	assert.Equal(t, []string{
+		"GET /api/v3/repos/owner/repo",
+		"POST /api/graphql",
+		"GET /api/v3/repos/owner/repo/releases",
+		"GET /api/v3/repos/other/actions/contents/action.yml",
+	}, requested)
+}
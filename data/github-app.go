@@ -0,0 +1,178 @@
+package data
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/privateerproj/privateer-sdk/config"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// GitHub rejects app JWTs that are valid for longer than ten minutes
+	appJWTLifetime = 9 * time.Minute
+	// installation tokens are replaced this long before they expire, so a request never carries a stale token
+	installationTokenEarlyExpiry = 5 * time.Minute
+)
+
+// githubTokenSource returns the credentials used for every GitHub API call: an installation token
+// for the GitHub App in the app-id var when one is configured, otherwise the token var
+func githubTokenSource(config *config.Config, api githubAPI, httpClient *http.Client) (oauth2.TokenSource, error) {
+	appID := config.GetString("app-id")
+	if appID == "" {
+		if config.GetString("token") == "" {
+			return nil, errors.New("a token, or a GitHub App via app-id and app-private-key-file, is required to evaluate a repository via the GitHub API")
+		}
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.GetString("token")}), nil
+	}
+
+	keyFile := config.GetString("app-private-key-file")
+	if keyFile == "" {
+		return nil, errors.New("app-private-key-file is required when authenticating as a GitHub App")
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+	key, err := parseAppPrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &appInstallationTokenSource{
+		appID:      appID,
+		key:        key,
+		apiBase:    api.restBase,
+		httpClient: httpClient,
+	}
+	source.installationID = config.GetString("app-installation-id")
+	if source.installationID == "" {
+		source.installationID, err = source.findInstallation(config.GetString("owner"), config.GetString("repo"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return oauth2.ReuseTokenSourceWithExpiry(nil, source, installationTokenEarlyExpiry), nil
+}
+
+// appInstallationTokenSource mints installation access tokens for a GitHub App. It is wrapped
+// in a reusing token source, so a new token is only minted when the previous one nears expiry.
+type appInstallationTokenSource struct {
+	appID          string
+	installationID string
+	key            *rsa.PrivateKey
+	apiBase        string
+	httpClient     *http.Client
+}
+
+func (s *appInstallationTokenSource) Token() (*oauth2.Token, error) {
+	endpoint := fmt.Sprintf("%s/app/installations/%s/access_tokens", s.apiBase, url.PathEscape(s.installationID))
+	var response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := s.appRequest(http.MethodPost, endpoint, &response); err != nil {
+		return nil, fmt.Errorf("failed to create GitHub App installation token: %w", err)
+	}
+	return &oauth2.Token{AccessToken: response.Token, TokenType: "Bearer", Expiry: response.ExpiresAt}, nil
+}
+
+// findInstallation looks up the app's installation on the repository being evaluated
+func (s *appInstallationTokenSource) findInstallation(owner, repo string) (string, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/installation", s.apiBase, url.PathEscape(owner), url.PathEscape(repo))
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := s.appRequest(http.MethodGet, endpoint, &installation); err != nil {
+		return "", fmt.Errorf("failed to find the GitHub App installation for %s/%s, set app-installation-id or install the app: %w", owner, repo, err)
+	}
+	return strconv.FormatInt(installation.ID, 10), nil
+}
+
+// appRequest calls an endpoint authenticated as the app itself rather than as an installation
+func (s *appInstallationTokenSource) appRequest(method, endpoint string, target any) error {
+	jwt, err := signAppJWT(s.appID, s.key, time.Now())
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+jwt)
+	request.Header.Set("Accept", "application/vnd.github+json")
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected response: %s", response.Status)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, target)
+}
+
+// signAppJWT creates the RS256 JSON Web Token that identifies a GitHub App. The issue time is
+// backdated a minute to allow for clock drift between this host and GitHub.
+func signAppJWT(appID string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseAppPrivateKey reads the PEM private key downloaded from the app's settings, which GitHub
+// issues in PKCS#1 form; PKCS#8 is accepted for keys that have been converted
+func parseAppPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,190 @@
+package data
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifyAppJWT checks the signature of a JWT and returns its claims
+func verifyAppJWT(t *testing.T, jwt string, key *rsa.PublicKey) map[string]any {
+	parts := strings.Split(jwt, ".")
+	require.Len(t, parts, 3)
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature))
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal(rawClaims, &claims))
+	return claims
+}
+
+func writeAppKey(t *testing.T, key *rsa.PrivateKey) string {
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	return keyFile
+}
+
+func TestSignAppJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	jwt, err := signAppJWT("12345", key, now)
+	require.NoError(t, err)
+
+	claims := verifyAppJWT(t, jwt, &key.PublicKey)
+	assert.Equal(t, "12345", claims["iss"])
+	assert.Equal(t, float64(now.Add(-time.Minute).Unix()), claims["iat"])
+	assert.Equal(t, float64(now.Add(appJWTLifetime).Unix()), claims["exp"])
+}
+
+func TestParseAppPrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		keyPEM      []byte
+		expectError bool
+	}{
+		{"pkcs1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), false},
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), false},
+		{"not pem", []byte("not a key"), true},
+		{"not rsa", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecPKCS8}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseAppPrivateKey(tt.keyPEM)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, key.Equal(rsaKey))
+		})
+	}
+}
+
+func TestGithubTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile := writeAppKey(t, key)
+
+	var minted atomic.Int32
+	var tokenLifetime atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := verifyAppJWT(t, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &key.PublicKey)
+		assert.Equal(t, "12345", claims["iss"])
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/owner/repo/installation":
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": 42})
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v3/app/installations/42/access_tokens":
+			count := minted.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"token":      fmt.Sprintf("installation-token-%d", count),
+				"expires_at": time.Now().Add(time.Duration(tokenLifetime.Load())).Format(time.RFC3339),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	api, err := resolveGithubAPI(server.URL)
+	require.NoError(t, err)
+
+	newConfig := func(vars map[string]interface{}) *config.Config {
+		vars["owner"] = "owner"
+		vars["repo"] = "repo"
+		return &config.Config{Logger: hclog.NewNullLogger(), Vars: vars}
+	}
+
+	t.Run("personal access token", func(t *testing.T) {
+		source, err := githubTokenSource(newConfig(map[string]interface{}{"token": "pat"}), api, server.Client())
+		require.NoError(t, err)
+		token, err := source.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "pat", token.AccessToken)
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		_, err := githubTokenSource(newConfig(map[string]interface{}{}), api, server.Client())
+		assert.Error(t, err)
+	})
+
+	t.Run("app without a private key", func(t *testing.T) {
+		_, err := githubTokenSource(newConfig(map[string]interface{}{"app-id": "12345"}), api, server.Client())
+		assert.Error(t, err)
+	})
+
+	t.Run("app installation is discovered and its token reused", func(t *testing.T) {
+		minted.Store(0)
+		tokenLifetime.Store(int64(time.Hour))
+		source, err := githubTokenSource(newConfig(map[string]interface{}{
+			"app-id": "12345", "app-private-key-file": keyFile,
+		}), api, server.Client())
+		require.NoError(t, err)
+		for range 3 {
+			token, err := source.Token()
+			require.NoError(t, err)
+			assert.Equal(t, "installation-token-1", token.AccessToken)
+		}
+		assert.Equal(t, int32(1), minted.Load())
+	})
+
+	t.Run("app token is refreshed before it expires", func(t *testing.T) {
+		minted.Store(0)
+		tokenLifetime.Store(int64(time.Minute))
+		source, err := githubTokenSource(newConfig(map[string]interface{}{
+			"app-id": "12345", "app-private-key-file": keyFile, "app-installation-id": "42",
+		}), api, server.Client())
+		require.NoError(t, err)
+		first, err := source.Token()
+		require.NoError(t, err)
+		second, err := source.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "installation-token-1", first.AccessToken)
+		assert.Equal(t, "installation-token-2", second.AccessToken)
+	})
+
+	t.Run("unknown installation", func(t *testing.T) {
+		source, err := githubTokenSource(newConfig(map[string]interface{}{
+			"app-id": "12345", "app-private-key-file": keyFile, "app-installation-id": "7",
+		}), api, server.Client())
+		require.NoError(t, err)
+		_, err = source.Token()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// githubProvider supplies repository data from the GitHub REST and GraphQL APIs
+type githubProvider struct {
+	apiBase    string
+	owner      string
+	repo       string
+	config     *config.Config
+	client     *github.Client
+	httpClient HttpClient
+	graphql    *GraphqlRepoData
+	repository *github.Repository
+	metadata   RepositoryMetadata
+	// metadataErr is the error from loading the repository and its organization, if any
+	metadataErr error
+}
+
+func (g *githubProvider) Contents(path string) (file *github.RepositoryContent, dir []*github.RepositoryContent, err error) {
+	file, dir, _, err = g.client.Repositories.GetContents(context.Background(), g.owner, g.repo, path, nil)
+	return file, dir, err
+}
+
+func (g *githubProvider) Releases() (releases []ReleaseData, err error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/releases", g.apiBase, g.owner, g.repo)
+	responseData, err := g.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(responseData, &releases)
+	return releases, err
+}
+
+func (g *githubProvider) WorkflowPermissions() (enabled bool, permissions WorkflowPermissions, err error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/actions", g.apiBase, g.owner, g.repo)
+	responseData, err := g.get(endpoint)
+	if err != nil {
+		return false, permissions, err
+	}
+	var actionsData struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.Unmarshal(responseData, &actionsData); err != nil {
+		return false, permissions, fmt.Errorf("failed to parse actions data: %v", err)
+	}
+
+	endpoint = fmt.Sprintf("%s/repos/%s/%s/actions/permissions/workflow", g.apiBase, g.owner, g.repo)
+	responseData, err = g.get(endpoint)
+	if err != nil {
+		return actionsData.Enabled, permissions, err
+	}
+	if err := json.Unmarshal(responseData, &permissions); err != nil {
+		return actionsData.Enabled, permissions, fmt.Errorf("failed to parse permissions: %v", err)
+	}
+	return actionsData.Enabled, permissions, nil
+}
+
+func (g *githubProvider) BranchProtection() (BranchProtection, error) {
+	ref := g.graphql.Repository.DefaultBranchRef
+	// the classic protection is still reported when the rulesets can't be read
+	rulesets, err := g.defaultBranchRulesets(ref.Name)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrRulesetsUnavailable, err)
+	}
+	return BranchProtection{
+		RestrictsPushes:              ref.BranchProtectionRule.RestrictsPushes,
+		RequiresApprovingReviews:     ref.BranchProtectionRule.RequiresApprovingReviews,
+		RequiredApprovingReviewCount: ref.RefUpdateRule.RequiredApprovingReviewCount,
+		RequiresLastPushApproval:     ref.BranchProtectionRule.RequireLastPushApproval,
+		RequiresCommitSignatures:     ref.BranchProtectionRule.RequiresCommitSignatures,
+		RequiresStatusChecks:         ref.BranchProtectionRule.RequiresStatusChecks,
+		RequiredStatusChecks:         ref.BranchProtectionRule.RequiredStatusCheckContexts,
+		AllowsDeletions:              ref.RefUpdateRule.AllowsDeletions,
+		AllowsForcePushes:            ref.RefUpdateRule.AllowsForcePushes,
+		BypassActors: classicBypassActors(
+			ref.BranchProtectionRule.RestrictsPushes,
+			ref.BranchProtectionRule.RequiresApprovingReviews,
+			ref.BranchProtectionRule.IsAdminEnforced,
+			ref.BranchProtectionRule.PushAllowances,
+			ref.BranchProtectionRule.BypassPullRequestAllowances,
+		),
+		Rulesets: rulesets,
+	}, err
+}
+
+// classicBypassActors lists who may push directly past a branch protection rule: when it restricts
+// pushes, those it lets push, who when it also requires reviews must be let past that requirement
+// too; and admins, unless the rule is enforced for them
+func classicBypassActors(restrictsPushes, requiresReviews, adminEnforced bool, pushAllowances, pullRequestAllowances branchProtectionAllowances) (actors []BypassActor) {
+	var restrictions []BranchRuleset
+	if restrictsPushes {
+		restrictions = append(restrictions, BranchRuleset{RulesetPolicy: RulesetPolicy{BypassActors: pushAllowances.bypassActors()}})
+	}
+	if requiresReviews {
+		restrictions = append(restrictions, BranchRuleset{RulesetPolicy: RulesetPolicy{BypassActors: pullRequestAllowances.bypassActors()}})
+	}
+	if len(restrictions) == 0 {
+		return nil
+	}
+	if !adminEnforced {
+		actors = append(actors, BypassActor{ActorID: 5, ActorType: "RepositoryRole", BypassMode: BypassModeAlways, Name: builtInRepositoryRoles[5] + " role"})
+	}
+	return append(actors, DirectBypassActors(restrictions)...)
+}
+
+func (g *githubProvider) SecurityPosture(insights si.SecurityInsights) (SecurityPosture, error) {
+	if g.metadataErr != nil {
+		// the security settings come with the repository, so they are unknown rather than disabled
+		return nil, g.metadataErr
+	}
+	return buildSecurityPosture(g.repository, RestData{Insights: insights})
+}
+
+func (g *githubProvider) RepositoryMetadata() (RepositoryMetadata, error) {
+	return g.metadata, g.metadataErr
+}
+
+func (g *githubProvider) get(endpoint string) ([]byte, error) {
+	if g.config != nil && g.config.Logger != nil {
+		g.config.Logger.Trace(fmt.Sprintf("GET %s", endpoint))
+	}
+	// the http client authenticates each request
+	return makeApiCall(g.httpClient, endpoint, "")
+}
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// how many times a rate limited request is retried before its response is returned as is
+	rateLimitMaxRetries = 5
+	// the longest a request waits for a rate limit to reset; longer waits fail instead of stalling the run
+	rateLimitMaxWait = 15 * time.Minute
+	// GitHub asks for at least a minute between retries after a secondary rate limit without a Retry-After header
+	secondaryRateLimitBackoff = time.Minute
+)
+
+// rateLimitTransport sends GitHub API requests through base, waiting out primary and secondary
+// rate limits and retrying the requests that are safe to repeat. It also keeps the run's API budget
+// from the X-RateLimit headers, so it can be summarised in the logs.
+type rateLimitTransport struct {
+	base   http.RoundTripper
+	logger hclog.Logger
+	// sleep waits for d unless ctx is done first, and is replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu        sync.Mutex
+	requests  int
+	retries   int
+	waited    time.Duration
+	resources map[string]rateLimit
+}
+
+// loadedTransports are the transports of the GitHub payloads loaded in this run, whose budgets are
+// logged once the evaluation has finished
+var loadedTransports struct {
+	sync.Mutex
+	transports []*rateLimitTransport
+}
+
+// LogAPIUsage logs the GitHub API budget used by each payload loaded in this run, including the
+// requests made by the evaluation steps, so it is called after the evaluation has finished
+func LogAPIUsage() {
+	loadedTransports.Lock()
+	defer loadedTransports.Unlock()
+	for _, transport := range loadedTransports.transports {
+		transport.logger.Info(transport.summary())
+	}
+	loadedTransports.transports = nil
+}
+
+// trackAPIUsage adds a transport to those whose budgets LogAPIUsage logs
+func trackAPIUsage(transport *rateLimitTransport) {
+	loadedTransports.Lock()
+	defer loadedTransports.Unlock()
+	loadedTransports.transports = append(loadedTransports.transports, transport)
+}
+
+// rateLimit is the latest quota reported for one of GitHub's rate limit resources, such as core or graphql
+type rateLimit struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+func newRateLimitTransport(base http.RoundTripper, logger hclog.Logger) *rateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitTransport{
+		base:      base,
+		logger:    logger,
+		sleep:     sleepContext,
+		resources: make(map[string]rateLimit),
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := t.base.RoundTrip(request)
+		t.record(response, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+		limited, wait := rateLimited(response, attempt)
+		if !limited {
+			return response, nil
+		}
+		if attempt == rateLimitMaxRetries || wait > rateLimitMaxWait || !retryable(request) {
+			t.logger.Warn(fmt.Sprintf("GitHub rate limit reached for %s %s, not retrying", request.Method, request.URL.Path))
+			return response, nil
+		}
+
+		_ = response.Body.Close()
+		if request.Body != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request = request.Clone(request.Context())
+			request.Body = body
+		}
+		t.logger.Warn(fmt.Sprintf("GitHub rate limit reached for %s %s, retrying in %s", request.Method, request.URL.Path, wait.Round(time.Second)))
+		if err := t.sleep(request.Context(), wait); err != nil {
+			return nil, err
+		}
+		t.mu.Lock()
+		t.waited += wait
+		t.mu.Unlock()
+	}
+}
+
+// record counts a request and keeps the quota reported in its response headers
+func (t *rateLimitTransport) record(response *http.Response, retry bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests++
+	if retry {
+		t.retries++
+	}
+	if response == nil || response.Header.Get("X-RateLimit-Limit") == "" {
+		return
+	}
+	resource := response.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	limit, _ := strconv.Atoi(response.Header.Get("X-RateLimit-Limit"))
+	remaining, _ := strconv.Atoi(response.Header.Get("X-RateLimit-Remaining"))
+	reset, _ := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64)
+	t.resources[resource] = rateLimit{limit: limit, remaining: remaining, reset: time.Unix(reset, 0)}
+}
+
+// summary describes the API budget used so far, for the run's logs
+func (t *rateLimitTransport) summary() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	summary := fmt.Sprintf("GitHub API budget: %d requests, %d retried after rate limits, %s spent waiting",
+		t.requests, t.retries, t.waited.Round(time.Second))
+	names := make([]string, 0, len(t.resources))
+	for name := range t.resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		quota := t.resources[name]
+		summary += fmt.Sprintf("; %s %d/%d remaining, resets %s", name, quota.remaining, quota.limit, quota.reset.Format(time.RFC3339))
+	}
+	return summary
+}
+
+// rateLimited reports whether GitHub refused a response because of a rate limit, and how long to wait
+// before retrying. Retry-After is honoured first, then the primary limit's reset time, falling back to
+// an exponential backoff for secondary limits. Jitter spreads out retries from concurrent requests.
+func rateLimited(response *http.Response, attempt int) (limited bool, wait time.Duration) {
+	if response.StatusCode != http.StatusForbidden && response.StatusCode != http.StatusTooManyRequests {
+		return false, 0
+	}
+	header := response.Header
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		return true, withJitter(time.Duration(seconds) * time.Second)
+	}
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return true, withJitter(max(time.Until(time.Unix(reset, 0)), time.Second))
+		}
+	}
+	if response.StatusCode == http.StatusForbidden && !mentionsRateLimit(response) {
+		// an ordinary permissions error
+		return false, 0
+	}
+	return true, withJitter(secondaryRateLimitBackoff << attempt)
+}
+
+// mentionsRateLimit checks the message of a 403 response, leaving the body readable for the caller
+func mentionsRateLimit(response *http.Response) bool {
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return err == nil && strings.Contains(strings.ToLower(string(body)), "rate limit")
+}
+
+// retryable is true for requests that can be repeated safely: reads, and GraphQL queries, which are posted
+func retryable(request *http.Request) bool {
+	if request.Body != nil && request.GetBody == nil {
+		return false
+	}
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return strings.HasSuffix(request.URL.Path, "/graphql")
+	}
+	return false
+}
+
+// withJitter adds up to a quarter again to d
+func withJitter(d time.Duration) time.Duration {
+	return d + rand.N(d/4+1)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
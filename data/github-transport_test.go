@@ -0,0 +1,234 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(30*time.Second).Unix(), 10)
+	tests := []struct {
+		name string
+		// limited writes the rate limited response sent before the request succeeds
+		limited       func(w http.ResponseWriter)
+		failures      int32
+		method        string
+		expectStatus  int
+		expectCalls   int32
+		expectMinWait time.Duration
+		expectMaxWait time.Duration
+	}{
+		{
+			name: "429 with retry-after",
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "3")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			failures:      2,
+			method:        http.MethodGet,
+			expectStatus:  http.StatusOK,
+			expectCalls:   3,
+			expectMinWait: 6 * time.Second,
+			expectMaxWait: 8 * time.Second,
+		},
+		{
+			name: "primary rate limit waits for the reset",
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Limit", "5000")
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				w.WriteHeader(http.StatusForbidden)
+			},
+			failures:      1,
+			method:        http.MethodGet,
+			expectStatus:  http.StatusOK,
+			expectCalls:   2,
+			expectMinWait: 25 * time.Second,
+			expectMaxWait: 40 * time.Second,
+		},
+		{
+			name: "secondary rate limit backs off",
+			limited: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message": "You have exceeded a secondary rate limit."}`))
+			},
+			failures:      2,
+			method:        http.MethodGet,
+			expectStatus:  http.StatusOK,
+			expectCalls:   3,
+			expectMinWait: 3 * time.Minute,
+			expectMaxWait: 4 * time.Minute,
+		},
+		{
+			name: "graphql queries are retried",
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			failures:     1,
+			method:       http.MethodPost,
+			expectStatus: http.StatusOK,
+			expectCalls:  2,
+		},
+		{
+			name: "permission errors are not retried",
+			limited: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+			},
+			failures:     1,
+			method:       http.MethodGet,
+			expectStatus: http.StatusForbidden,
+			expectCalls:  1,
+		},
+		{
+			name: "gives up after the maximum retries",
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			failures:     rateLimitMaxRetries + 5,
+			method:       http.MethodGet,
+			expectStatus: http.StatusTooManyRequests,
+			expectCalls:  rateLimitMaxRetries + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					tt.limited(w)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("X-RateLimit-Limit", "5000")
+				w.Header().Set("X-RateLimit-Remaining", "4999")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				_, _ = w.Write(body)
+			}))
+			defer server.Close()
+
+			transport := newRateLimitTransport(server.Client().Transport, hclog.NewNullLogger())
+			var waited time.Duration
+			transport.sleep = func(_ context.Context, d time.Duration) error {
+				waited += d
+				return nil
+			}
+
+			request, err := http.NewRequest(tt.method, server.URL+"/graphql", strings.NewReader(`{"query": "{viewer{login}}"}`))
+			require.NoError(t, err)
+			response, err := (&http.Client{Transport: transport}).Do(request)
+			require.NoError(t, err)
+			defer func() {
+				_ = response.Body.Close()
+			}()
+
+			assert.Equal(t, tt.expectStatus, response.StatusCode)
+			assert.Equal(t, tt.expectCalls, calls.Load())
+			if tt.expectStatus == http.StatusOK {
+				body, err := io.ReadAll(response.Body)
+				require.NoError(t, err)
+				assert.Equal(t, `{"query": "{viewer{login}}"}`, string(body), "the request body is resent on retry")
+			}
+			if tt.expectMaxWait > 0 {
+				assert.GreaterOrEqual(t, waited, tt.expectMinWait)
+				assert.LessOrEqual(t, waited, tt.expectMaxWait)
+			}
+		})
+	}
+}
+
+func TestRateLimitTransport_PostIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	transport := newRateLimitTransport(server.Client().Transport, hclog.NewNullLogger())
+	transport.sleep = func(context.Context, time.Duration) error { return nil }
+
+	response, err := (&http.Client{Transport: transport}).Post(server.URL+"/app/installations/1/access_tokens", "application/json", nil)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRateLimitTransport_Summary(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		w.Header().Set("X-RateLimit-Resource", r.URL.Query().Get("resource"))
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4990")
+	}))
+	defer server.Close()
+	transport := newRateLimitTransport(server.Client().Transport, hclog.NewNullLogger())
+	transport.sleep = func(context.Context, time.Duration) error { return nil }
+	client := &http.Client{Transport: transport}
+
+	for _, resource := range []string{"core", "graphql"} {
+		response, err := client.Get(server.URL + "/?resource=" + resource)
+		require.NoError(t, err)
+		_ = response.Body.Close()
+	}
+
+	summary := transport.summary()
+	assert.True(t, strings.HasPrefix(summary, "GitHub API budget: 3 requests, 1 retried after rate limits"), summary)
+	assert.Contains(t, summary, "core 4990/5000 remaining")
+	assert.Contains(t, summary, "graphql 4990/5000 remaining")
+}
+
+func TestLogAPIUsage(t *testing.T) {
+	var logs bytes.Buffer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	transport := newRateLimitTransport(server.Client().Transport, hclog.New(&hclog.LoggerOptions{Output: &logs}))
+	trackAPIUsage(transport)
+
+	response, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Empty(t, logs.String(), "the budget should only be logged once the evaluation has finished")
+
+	LogAPIUsage()
+	assert.Contains(t, logs.String(), "GitHub API budget: 1 requests")
+	logs.Reset()
+	LogAPIUsage()
+	assert.Empty(t, logs.String(), "each budget should be logged once")
+}
+
+func TestMakeApiCall_RateLimitExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := makeApiCall(server.Client(), server.URL, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "API rate limit exhausted until")
+}
@@ -0,0 +1,412 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+const (
+	defaultGitlabURL = "https://gitlab.com"
+	gitlabPageSize   = 100
+	// access levels as reported by the GitLab API
+	gitlabNoAccess         = 0
+	gitlabMaintainerAccess = 40
+)
+
+// reasons reported for data the GitLab API does not provide in a form the checks can use
+var gitlabUnavailable = map[string]string{
+	DependencyGraphData: "GitLab does not expose a dependency graph through its REST API; manual review required",
+	StatusChecksData:    "GitLab pipelines are not evaluated as status checks; manual review required",
+}
+
+// gitlabProvider supplies repository data from the GitLab REST API (v4)
+type gitlabProvider struct {
+	apiBase    string
+	project    gitlabProject
+	token      string
+	config     *config.Config
+	httpClient HttpClient
+}
+
+type gitlabProject struct {
+	ID                                 int    `json:"id"`
+	Name                               string `json:"name"`
+	PathWithNamespace                  string `json:"path_with_namespace"`
+	DefaultBranch                      string `json:"default_branch"`
+	Visibility                         string `json:"visibility"`
+	Archived                           bool   `json:"archived"`
+	IssuesEnabled                      bool   `json:"issues_enabled"`
+	BuildsAccessLevel                  string `json:"builds_access_level"`
+	OnlyAllowMergeIfPipelineSucceeds   bool   `json:"only_allow_merge_if_pipeline_succeeds"`
+	CIPushRepositoryForJobTokenAllowed bool   `json:"ci_push_repository_for_job_token_allowed"`
+	PreReceiveSecretDetectionEnabled   bool   `json:"pre_receive_secret_detection_enabled"`
+	Namespace                          struct {
+		ID   int    `json:"id"`
+		Kind string `json:"kind"`
+	} `json:"namespace"`
+}
+
+type gitlabTreeEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "blob" for files, "tree" for directories, "commit" for submodules
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+}
+
+type gitlabFile struct {
+	FileName string `json:"file_name"`
+	FilePath string `json:"file_path"`
+	Size     int    `json:"size"`
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+}
+
+type gitlabRelease struct {
+	Name            string `json:"name"`
+	TagName         string `json:"tag_name"`
+	Description     string `json:"description"`
+	UpcomingRelease bool   `json:"upcoming_release"`
+	Assets          struct {
+		Links []struct {
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+	Links struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+}
+
+type gitlabProtectedBranch struct {
+	Name             string `json:"name"`
+	AllowForcePush   bool   `json:"allow_force_push"`
+	PushAccessLevels []struct {
+		AccessLevel int `json:"access_level"`
+	} `json:"push_access_levels"`
+}
+
+type gitlabApprovalRule struct {
+	ApprovalsRequired             int  `json:"approvals_required"`
+	AppliesToAllProtectedBranches bool `json:"applies_to_all_protected_branches"`
+	ProtectedBranches             []struct {
+		Name string `json:"name"`
+	} `json:"protected_branches"`
+}
+
+// loadGitlabPayload builds the payload for the project at owner/repo on the GitLab instance in the base-url var,
+// defaulting to gitlab.com. Nested groups may be given in owner, e.g. "group/subgroup".
+func loadGitlabPayload(config *config.Config, httpClient HttpClient) (Payload, error) {
+	baseURL := config.GetString("base-url")
+	if baseURL == "" {
+		baseURL = defaultGitlabURL
+	}
+	provider := &gitlabProvider{
+		apiBase:    strings.TrimSuffix(baseURL, "/") + "/api/v4",
+		token:      config.GetString("token"),
+		config:     config,
+		httpClient: httpClient,
+	}
+	projectPath := url.PathEscape(config.GetString("owner") + "/" + config.GetString("repo"))
+	if err := provider.getJSON(fmt.Sprintf("%s/projects/%s", provider.apiBase, projectPath), &provider.project); err != nil {
+		return Payload{}, fmt.Errorf("failed to retrieve GitLab project: %w", err)
+	}
+
+	payload := NewPayload(config, provider)
+	for source, reason := range gitlabUnavailable {
+		payload.Unavailable[source] = reason
+	}
+
+	payload.GraphqlRepoData = payload.describeRepository(provider.project.Name, provider.project.DefaultBranch, provider.headCommit(), provider.project.IssuesEnabled)
+
+	entries, err := provider.tree("", true)
+	if err != nil {
+		return Payload{}, fmt.Errorf("failed to scan GitLab repository tree: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type == "blob" {
+			paths = append(paths, entry.Path)
+		}
+	}
+	if payload.SuspectedBinaries, err = scanForBinaries(paths, contentsReader(provider)); err != nil {
+		return Payload{}, fmt.Errorf("failed to scan GitLab repository for binaries: %w", err)
+	}
+
+	var languages map[string]float64
+	if err := provider.getJSON(provider.projectEndpoint("languages"), &languages); err != nil {
+		return Payload{}, fmt.Errorf("failed to retrieve GitLab project languages: %w", err)
+	}
+	payload.IsCodeRepo = len(languages) > 0
+	return payload, nil
+}
+
+func (g *gitlabProvider) Contents(repoPath string) (file *github.RepositoryContent, dir []*github.RepositoryContent, err error) {
+	clean := path.Clean("/" + repoPath)[1:]
+	var fileErr error
+	if clean != "" {
+		var gitlabFile gitlabFile
+		fileErr = g.getJSON(g.projectEndpoint("repository/files/%s?ref=%s", url.PathEscape(clean), url.QueryEscape(g.project.DefaultBranch)), &gitlabFile)
+		if fileErr == nil {
+			return &github.RepositoryContent{
+				Type:     github.Ptr("file"),
+				Name:     github.Ptr(gitlabFile.FileName),
+				Path:     github.Ptr(gitlabFile.FilePath),
+				Size:     github.Ptr(gitlabFile.Size),
+				Encoding: github.Ptr(gitlabFile.Encoding),
+				Content:  github.Ptr(gitlabFile.Content),
+			}, nil, nil
+		}
+	}
+
+	// not a file, so try listing it as a directory
+	entries, err := g.tree(clean, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fileErr != nil && len(entries) == 0 {
+		return nil, nil, fileErr
+	}
+	dir = []*github.RepositoryContent{}
+	for _, entry := range entries {
+		dir = append(dir, &github.RepositoryContent{
+			Type: github.Ptr(gitlabContentType(entry)),
+			Name: github.Ptr(entry.Name),
+			Path: github.Ptr(entry.Path),
+		})
+	}
+	return nil, dir, nil
+}
+
+// Releases reports each GitLab release; links attached to a release are its assets
+func (g *gitlabProvider) Releases() (releases []ReleaseData, err error) {
+	gitlabReleases, err := getGitlabPages[gitlabRelease](g, g.projectEndpoint("releases"))
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range gitlabReleases {
+		releaseData := ReleaseData{
+			Name:        release.Name,
+			TagName:     release.TagName,
+			URL:         release.Links.Self,
+			Description: release.Description,
+			Prerelease:  release.UpcomingRelease,
+		}
+		for _, link := range release.Assets.Links {
+			downloadURL := link.DirectAssetURL
+			if downloadURL == "" {
+				downloadURL = link.URL
+			}
+			releaseData.Assets = append(releaseData.Assets, ReleaseAsset{Name: link.Name, DownloadURL: downloadURL})
+		}
+		releases = append(releases, releaseData)
+	}
+	return releases, nil
+}
+
+// WorkflowPermissions maps the CI/CD job token settings: the job token is read only
+// unless it has been allowed to push to the repository, and it can never approve merge requests
+func (g *gitlabProvider) WorkflowPermissions() (bool, WorkflowPermissions, error) {
+	permissions := WorkflowPermissions{DefaultPermissions: "read"}
+	if g.project.CIPushRepositoryForJobTokenAllowed {
+		permissions.DefaultPermissions = "write"
+	}
+	return g.project.BuildsAccessLevel != "disabled", permissions, nil
+}
+
+// BranchProtection maps the protected branch rule covering the default branch and the
+// merge request approval rules that apply to it
+func (g *gitlabProvider) BranchProtection() (protection BranchProtection, err error) {
+	branches, err := getGitlabPages[gitlabProtectedBranch](g, g.projectEndpoint("protected_branches"))
+	if err != nil {
+		return protection, err
+	}
+	protection.RequiresStatusChecks = g.project.OnlyAllowMergeIfPipelineSucceeds
+
+	rule, found := matchProtectedBranch(branches, g.project.DefaultBranch)
+	if !found {
+		protection.AllowsDeletions = true
+		protection.AllowsForcePushes = true
+		return protection, nil
+	}
+	// protected branches can't be deleted with a push
+	protection.AllowsForcePushes = rule.AllowForcePush
+	protection.RestrictsPushes = len(rule.PushAccessLevels) > 0
+	for _, level := range rule.PushAccessLevels {
+		if level.AccessLevel != gitlabNoAccess && level.AccessLevel < gitlabMaintainerAccess {
+			protection.RestrictsPushes = false
+		}
+	}
+
+	// approval rules and settings are only available on paid tiers, which other tiers answer with
+	// 404 Not Found; without them no approvals are required. Any other failure, such as a token
+	// without permission to read them, leaves the approvals unknown.
+	rules, err := getGitlabPages[gitlabApprovalRule](g, g.projectEndpoint("approval_rules"))
+	if isNotFound(err) {
+		g.config.Logger.Trace(fmt.Sprintf("merge request approval rules unavailable: %s", err.Error()))
+		return protection, nil
+	}
+	if err != nil {
+		return protection, fmt.Errorf("failed to read merge request approval rules: %w", err)
+	}
+	for _, rule := range rules {
+		if appliesToBranch(rule, g.project.DefaultBranch) && rule.ApprovalsRequired > protection.RequiredApprovingReviewCount {
+			protection.RequiredApprovingReviewCount = rule.ApprovalsRequired
+		}
+	}
+	protection.RequiresApprovingReviews = protection.RequiredApprovingReviewCount > 0
+
+	var settings struct {
+		ResetApprovalsOnPush bool `json:"reset_approvals_on_push"`
+	}
+	if err := g.getJSON(g.projectEndpoint("approvals"), &settings); isNotFound(err) {
+		g.config.Logger.Trace(fmt.Sprintf("merge request approval settings unavailable: %s", err.Error()))
+		return protection, nil
+	} else if err != nil {
+		return protection, fmt.Errorf("failed to read merge request approval settings: %w", err)
+	}
+	protection.RequiresLastPushApproval = settings.ResetApprovalsOnPush
+	return protection, nil
+}
+
+// SecurityPosture credits secret push protection, the Secret-Detection CI template, or Security Insights claims
+func (g *gitlabProvider) SecurityPosture(insights si.SecurityInsights) (SecurityPosture, error) {
+	insightsClaimsSecretsTooling := insightsClaimsSecretsTooling(insights)
+	pipelineScansSecrets := false
+	if file, _, err := g.Contents(".gitlab-ci.yml"); err == nil {
+		content, _ := file.GetContent()
+		pipelineScansSecrets = strings.Contains(content, "Secret-Detection")
+	}
+	return &RepoSecurityPosture{
+		restData:              RestData{Insights: insights},
+		preventsSecretPushing: g.project.PreReceiveSecretDetectionEnabled || insightsClaimsSecretsTooling,
+		scansForSecrets:       pipelineScansSecrets || g.project.PreReceiveSecretDetectionEnabled || insightsClaimsSecretsTooling,
+	}, nil
+}
+
+func (g *gitlabProvider) RepositoryMetadata() (RepositoryMetadata, error) {
+	metadata := &GitlabRepositoryMetadata{project: g.project}
+	if g.project.Namespace.Kind == "group" {
+		var group gitlabGroup
+		if err := g.getJSON(fmt.Sprintf("%s/groups/%d", g.apiBase, g.project.Namespace.ID), &group); err == nil {
+			metadata.group = &group
+		}
+	}
+	return metadata, nil
+}
+
+// headCommit returns the SHA of the latest commit on the default branch
+func (g *gitlabProvider) headCommit() string {
+	var branch struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	if err := g.getJSON(g.projectEndpoint("repository/branches/%s", url.PathEscape(g.project.DefaultBranch)), &branch); err != nil {
+		g.config.Logger.Trace(fmt.Sprintf("failed to retrieve default branch: %s", err.Error()))
+	}
+	return branch.Commit.ID
+}
+
+// tree lists the entries under repoPath in the default branch, optionally including all subdirectories
+func (g *gitlabProvider) tree(repoPath string, recursive bool) ([]gitlabTreeEntry, error) {
+	endpoint := g.projectEndpoint("repository/tree?ref=%s&recursive=%t", url.QueryEscape(g.project.DefaultBranch), recursive)
+	if repoPath != "" {
+		endpoint += "&path=" + url.QueryEscape(repoPath)
+	}
+	return getGitlabPages[gitlabTreeEntry](g, endpoint)
+}
+
+func (g *gitlabProvider) projectEndpoint(format string, args ...any) string {
+	return fmt.Sprintf("%s/projects/%d/", g.apiBase, g.project.ID) + fmt.Sprintf(format, args...)
+}
+
+func (g *gitlabProvider) getJSON(endpoint string, target any) error {
+	if g.config != nil && g.config.Logger != nil {
+		g.config.Logger.Trace(fmt.Sprintf("GET %s", endpoint))
+	}
+	responseData, err := makeApiCall(g.httpClient, endpoint, g.token)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(responseData, target)
+}
+
+// getGitlabPages returns every item from a paginated GitLab endpoint
+func getGitlabPages[T any](g *gitlabProvider, endpoint string) ([]T, error) {
+	return getAllPages[T](g.getJSON, endpoint, "per_page", gitlabPageSize)
+}
+
+func gitlabContentType(entry gitlabTreeEntry) string {
+	switch {
+	case entry.Type == "tree":
+		return "dir"
+	case entry.Type == "commit":
+		return "submodule"
+	case entry.Mode == "120000":
+		return "symlink"
+	default:
+		return "file"
+	}
+}
+
+// matchProtectedBranch finds the rule protecting branch, preferring an exact name over a wildcard
+func matchProtectedBranch(rules []gitlabProtectedBranch, branch string) (gitlabProtectedBranch, bool) {
+	patterns := make([]string, len(rules))
+	for i, rule := range rules {
+		patterns[i] = rule.Name
+	}
+	if i := matchBranchPattern(patterns, branch); i >= 0 {
+		return rules[i], true
+	}
+	return gitlabProtectedBranch{}, false
+}
+
+func appliesToBranch(rule gitlabApprovalRule, branch string) bool {
+	if rule.AppliesToAllProtectedBranches || len(rule.ProtectedBranches) == 0 {
+		return true
+	}
+	for _, protected := range rule.ProtectedBranches {
+		if protected.Name == branch {
+			return true
+		}
+	}
+	return false
+}
+
+type gitlabGroup struct {
+	RequireTwoFactorAuthentication *bool `json:"require_two_factor_authentication"`
+}
+
+// GitlabRepositoryMetadata reports repository metadata from a GitLab project and its parent group
+type GitlabRepositoryMetadata struct {
+	project gitlabProject
+	group   *gitlabGroup
+}
+
+func (r *GitlabRepositoryMetadata) IsActive() bool {
+	return !r.project.Archived
+}
+
+func (r *GitlabRepositoryMetadata) IsPublic() bool {
+	return r.project.Visibility == "public"
+}
+
+// OrganizationBlogURL is always nil, as GitLab groups have no website field
+func (r *GitlabRepositoryMetadata) OrganizationBlogURL() *string {
+	return nil
+}
+
+func (r *GitlabRepositoryMetadata) IsMFARequiredForAdministrativeActions() *bool {
+	if r.group == nil {
+		return nil
+	}
+	return r.group.RequireTwoFactorAuthentication
+}
@@ -0,0 +1,250 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var gitlabTestFiles = map[string]string{
+	"README.md":       "# Project\n\n## Support\n\nOpen an issue.\n",
+	"LICENSE":         "                                 Apache License\n                           Version 2.0, January 2004\n",
+	"CONTRIBUTING.md": "Open a merge request.\n",
+	".gitlab-ci.yml":  "include:\n  - template: Jobs/Secret-Detection.gitlab-ci.yml\n",
+	"bin/tool.exe":    peExecutable,
+}
+
+// newGitlabTestServer stands in for the GitLab v4 API, serving project 7 at group/project
+func newGitlabTestServer(t *testing.T, protectedBranches string) *httptest.Server {
+	rootTree := []gitlabTreeEntry{{Name: "bin", Type: "tree", Path: "bin"}}
+	for name := range gitlabTestFiles {
+		if strings.Contains(name, "/") {
+			continue
+		}
+		rootTree = append(rootTree, gitlabTreeEntry{Name: name, Type: "blob", Path: name})
+	}
+	binTree := []gitlabTreeEntry{{Name: "tool.exe", Type: "blob", Path: "bin/tool.exe"}}
+
+	responses := map[string]any{
+		"/api/v4/projects/group%2Fproject": map[string]any{
+			"id": 7, "name": "project", "default_branch": "main", "visibility": "public",
+			"issues_enabled": true, "builds_access_level": "enabled",
+			"only_allow_merge_if_pipeline_succeeds": true,
+			"namespace":                             map[string]any{"id": 3, "kind": "group"},
+		},
+		"/api/v4/groups/3": map[string]any{"require_two_factor_authentication": true},
+		"/api/v4/projects/7/repository/branches/main": map[string]any{"commit": map[string]any{"id": "abc123"}},
+		"/api/v4/projects/7/languages":                map[string]any{"Go": 100.0},
+		"/api/v4/projects/7/protected_branches":       json.RawMessage(protectedBranches),
+		"/api/v4/projects/7/approval_rules": []map[string]any{
+			{"approvals_required": 2, "applies_to_all_protected_branches": true},
+		},
+		"/api/v4/projects/7/approvals": map[string]any{"reset_approvals_on_push": true},
+		"/api/v4/projects/7/releases": []map[string]any{{
+			"name": "v1.0.0", "tag_name": "v1.0.0", "description": "## Changelog",
+			"assets": map[string]any{"links": []map[string]any{
+				{"name": "project_1.0.0_linux_amd64.tar.gz", "url": "https://example.com/a", "direct_asset_url": "https://example.com/direct"},
+			}},
+			"_links": map[string]any{"self": "https://gitlab.example.com/group/project/-/releases/v1.0.0"},
+		}},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requestPath := r.URL.EscapedPath()
+		var response any
+		switch {
+		case requestPath == "/api/v4/projects/7/repository/tree":
+			switch {
+			case r.URL.Query().Get("recursive") == "true":
+				response = append(rootTree, binTree...)
+			case r.URL.Query().Get("path") == "bin":
+				response = binTree
+			case r.URL.Query().Get("path") == "":
+				response = rootTree
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		case strings.HasPrefix(requestPath, "/api/v4/projects/7/repository/files/"):
+			name := strings.ReplaceAll(strings.TrimPrefix(requestPath, "/api/v4/projects/7/repository/files/"), "%2F", "/")
+			content, ok := gitlabTestFiles[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			response = gitlabFile{FileName: name, FilePath: name, Size: len(content), Encoding: "base64", Content: base64.StdEncoding.EncodeToString([]byte(content))}
+		default:
+			var ok bool
+			if response, ok = responses[requestPath]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func gitlabTestConfig(baseURL string) *config.Config {
+	return &config.Config{
+		Logger: hclog.NewNullLogger(),
+		Vars: map[string]interface{}{
+			"owner":    "group",
+			"repo":     "project",
+			"token":    "test-token",
+			"forge":    "gitlab",
+			"base-url": baseURL,
+		},
+	}
+}
+
+func TestLoadGitlabPayload(t *testing.T) {
+	server := newGitlabTestServer(t, `[{"name": "main", "allow_force_push": false, "push_access_levels": [{"access_level": 40}]}]`)
+	defer server.Close()
+
+	payload, err := loadGitlabPayload(gitlabTestConfig(server.URL), server.Client())
+	require.NoError(t, err)
+
+	assert.Equal(t, "project", payload.Repository.Name)
+	assert.Equal(t, "main", payload.Repository.DefaultBranchRef.Name)
+	assert.Equal(t, "abc123", payload.Repository.DefaultBranchRef.Target.OID)
+	assert.True(t, payload.Repository.HasIssuesEnabled)
+	assert.Equal(t, "Apache-2.0", payload.Repository.LicenseInfo.SpdxId)
+	assert.Equal(t, "Open a merge request.\n", payload.Repository.ContributingGuidelines.Body)
+	assert.True(t, payload.HasSupportMarkdown())
+	assert.True(t, payload.IsCodeRepo)
+	assert.Equal(t, []SuspectedBinary{{Path: "bin/tool.exe", Type: "PE executable", SHA256: "a62041514d88e5f81ab7810f0a637eda55e0e552e84636fef50665fea71cf31d"}}, payload.SuspectedBinaries)
+
+	assert.Equal(t, BranchProtection{
+		RestrictsPushes:              true,
+		RequiresApprovingReviews:     true,
+		RequiredApprovingReviewCount: 2,
+		RequiresLastPushApproval:     true,
+		RequiresStatusChecks:         true,
+	}, payload.BranchProtection)
+	assert.True(t, payload.WorkflowsEnabled)
+	assert.Equal(t, "read", payload.WorkflowPermissions.DefaultPermissions)
+
+	require.Len(t, payload.Releases, 1)
+	assert.Equal(t, "## Changelog", payload.Releases[0].Description)
+	assert.Equal(t, []ReleaseAsset{{Name: "project_1.0.0_linux_amd64.tar.gz", DownloadURL: "https://example.com/direct"}}, payload.Releases[0].Assets)
+
+	assert.True(t, payload.RepositoryMetadata.IsPublic())
+	assert.True(t, *payload.RepositoryMetadata.IsMFARequiredForAdministrativeActions())
+	assert.True(t, payload.SecurityPosture.ScansForSecrets())
+	assert.False(t, payload.SecurityPosture.PreventsPushingSecrets())
+
+	assert.Contains(t, payload.Unavailable, StatusChecksData)
+	assert.NotContains(t, payload.Unavailable, BranchProtectionData)
+
+	binaries, err := payload.GetDirectoryContent("bin")
+	require.NoError(t, err)
+	require.Len(t, binaries, 1)
+	assert.Equal(t, "bin/tool.exe", binaries[0].GetPath())
+}
+
+func TestGitlabBranchProtection(t *testing.T) {
+	tests := []struct {
+		name              string
+		protectedBranches string
+		expected          BranchProtection
+	}{
+		{
+			name:              "unprotected default branch",
+			protectedBranches: `[]`,
+			expected:          BranchProtection{AllowsDeletions: true, AllowsForcePushes: true, RequiresStatusChecks: true},
+		},
+		{
+			name:              "developers may push through a wildcard rule",
+			protectedBranches: `[{"name": "ma*", "allow_force_push": true, "push_access_levels": [{"access_level": 30}]}]`,
+			expected: BranchProtection{
+				AllowsForcePushes: true, RequiresStatusChecks: true,
+				RequiresApprovingReviews: true, RequiredApprovingReviewCount: 2, RequiresLastPushApproval: true,
+			},
+		},
+		{
+			name:              "no one may push",
+			protectedBranches: `[{"name": "main", "push_access_levels": [{"access_level": 0}]}]`,
+			expected: BranchProtection{
+				RestrictsPushes: true, RequiresStatusChecks: true,
+				RequiresApprovingReviews: true, RequiredApprovingReviewCount: 2, RequiresLastPushApproval: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGitlabTestServer(t, tt.protectedBranches)
+			defer server.Close()
+
+			payload, err := loadGitlabPayload(gitlabTestConfig(server.URL), server.Client())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, payload.BranchProtection)
+		})
+	}
+}
+
+func TestGitlabBranchProtection_ApprovalsUnreadable(t *testing.T) {
+	tests := []struct {
+		name            string
+		endpoint        string
+		status          int
+		wantApprovals   int
+		wantUnavailable bool
+	}{
+		{name: "tier without approval rules", endpoint: "/api/v4/projects/7/approval_rules", status: http.StatusNotFound},
+		{name: "approval rules forbidden", endpoint: "/api/v4/projects/7/approval_rules", status: http.StatusForbidden, wantUnavailable: true},
+		{name: "approval settings failing", endpoint: "/api/v4/projects/7/approvals", status: http.StatusBadGateway, wantApprovals: 2, wantUnavailable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newGitlabTestServer(t, `[{"name": "main", "push_access_levels": [{"access_level": 40}]}]`)
+			defer backend.Close()
+			target, err := url.Parse(backend.URL)
+			require.NoError(t, err)
+			proxy := httputil.NewSingleHostReverseProxy(target)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == tt.endpoint {
+					w.WriteHeader(tt.status)
+					return
+				}
+				proxy.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+
+			payload, err := loadGitlabPayload(gitlabTestConfig(server.URL), server.Client())
+			require.NoError(t, err)
+			assert.True(t, payload.BranchProtection.RestrictsPushes)
+			assert.Equal(t, tt.wantApprovals, payload.BranchProtection.RequiredApprovingReviewCount)
+			if tt.wantUnavailable {
+				assert.Contains(t, payload.Unavailable[BranchProtectionData], "failed to read merge request approval")
+			} else {
+				assert.NotContains(t, payload.Unavailable, BranchProtectionData)
+			}
+		})
+	}
+}
+
+func TestLoadGitlabPayload_Unauthorized(t *testing.T) {
+	server := newGitlabTestServer(t, `[]`)
+	defer server.Close()
+
+	cfg := gitlabTestConfig(server.URL)
+	cfg.Vars["token"] = "wrong-token"
+	_, err := loadGitlabPayload(cfg, server.Client())
+	assert.Error(t, err)
+}
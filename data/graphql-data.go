@@ -32,6 +32,11 @@ type GraphqlRepoData struct {
 				RequiresStatusChecks        bool
 				RequireLastPushApproval     bool
 				RequiredStatusCheckContexts []string
+				IsAdminEnforced             bool
+				// PushAllowances lists who may push when the rule restricts pushes
+				PushAllowances branchProtectionAllowances `graphql:"pushAllowances(first: 100)"`
+				// BypassPullRequestAllowances lists who may push without a pull request when the rule requires reviews
+				BypassPullRequestAllowances branchProtectionAllowances `graphql:"bypassPullRequestAllowances(first: 100)"`
 			}
 
 			Target struct {
@@ -72,9 +77,6 @@ type GraphqlRepoData struct {
 			SpdxId string
 			Url    string
 		}
-		LatestRelease struct {
-			Description string
-		}
 		ContributingGuidelines struct {
 			Body string
 		}
@@ -92,3 +94,41 @@ type GraphqlRepoData struct {
 		} `graphql:"releases(first: 1, orderBy: {field: CREATED_AT, direction: DESC})"`
 	} `graphql:"repository(owner: $owner, name: $name)"`
 }
+
+// branchProtectionAllowances lists the teams, users and apps a branch protection rule exempts from one of its restrictions
+type branchProtectionAllowances struct {
+	Nodes []branchProtectionAllowance
+}
+
+// branchProtectionAllowance is one of the teams, users or apps in branchProtectionAllowances
+type branchProtectionAllowance struct {
+	Actor struct {
+		Team struct {
+			DatabaseID   int64 `graphql:"databaseId"`
+			CombinedSlug string
+		} `graphql:"... on Team"`
+		User struct {
+			DatabaseID int64 `graphql:"databaseId"`
+			Login      string
+		} `graphql:"... on User"`
+		App struct {
+			DatabaseID int64 `graphql:"databaseId"`
+			Slug       string
+		} `graphql:"... on App"`
+	}
+}
+
+// bypassActors describes the allowances as bypass actors, identified as rulesets identify the same actors
+func (a branchProtectionAllowances) bypassActors() (actors []BypassActor) {
+	for _, node := range a.Nodes {
+		switch actor := node.Actor; {
+		case actor.Team.DatabaseID != 0:
+			actors = append(actors, BypassActor{ActorID: actor.Team.DatabaseID, ActorType: "Team", BypassMode: BypassModeAlways, Name: "team " + actor.Team.CombinedSlug})
+		case actor.User.DatabaseID != 0:
+			actors = append(actors, BypassActor{ActorID: actor.User.DatabaseID, ActorType: "User", BypassMode: BypassModeAlways, Name: "user " + actor.User.Login})
+		case actor.App.DatabaseID != 0:
+			actors = append(actors, BypassActor{ActorID: actor.App.DatabaseID, ActorType: "Integration", BypassMode: BypassModeAlways, Name: "app " + actor.App.Slug})
+		}
+	}
+	return actors
+}
@@ -25,14 +25,14 @@ type Dependency struct {
 	Requirements string
 }
 
-func countDependencyManifests(client *githubv4.Client, cfg *config.Config) (int, error) {
+func countDependencyManifests(ctx context.Context, client *githubv4.Client, cfg *config.Config) (int, error) {
 	var query DependencyManifestsPage
 	variables := map[string]any{
 		"owner": githubv4.String(cfg.GetString("owner")),
 		"name":  githubv4.String(cfg.GetString("repo")),
 	}
 
-	err := client.Query(context.Background(), &query, variables)
+	err := client.Query(ctx, &query, variables)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,193 @@
+package data
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// cacheTransport keeps GET responses on disk and revalidates them with If-None-Match and
+// If-Modified-Since, so unchanged data is not downloaded again on the next run. GitHub doesn't
+// count 304 responses against the primary rate limit.
+type cacheTransport struct {
+	base http.RoundTripper
+	dir  string
+	// ttl is how long a stored response is used without revalidating it
+	ttl time.Duration
+	// identity separates the responses seen by different credentials, as they may see different data
+	identity string
+	now      func() time.Time
+}
+
+// cachedResponse is a response as stored in the cache directory
+type cachedResponse struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+// cachedTransport wraps base in a response cache when the cache-dir var is set. Stored responses are
+// reused without revalidation for the cache-ttl var (a duration such as 1h), which defaults to zero.
+func cachedTransport(config *config.Config, base http.RoundTripper, identity string) (http.RoundTripper, error) {
+	dir := config.GetString("cache-dir")
+	if dir == "" {
+		return base, nil
+	}
+	var ttl time.Duration
+	if value := config.GetString("cache-ttl"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid cache-ttl: %w", err)
+		}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache-dir: %w", err)
+	}
+	return &cacheTransport{base: base, dir: dir, ttl: ttl, identity: identity, now: time.Now}, nil
+}
+
+// credentialIdentity names the credentials in use without revealing them. A GitHub App is identified
+// by the app and owner rather than its installation token, which changes every hour.
+func credentialIdentity(config *config.Config) string {
+	if appID := config.GetString("app-id"); appID != "" {
+		return "app:" + appID + ":" + config.GetString("owner")
+	}
+	if token := config.GetString("token"); token != "" {
+		digest := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(digest[:])
+	}
+	return ""
+}
+
+func (t *cacheTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Method != http.MethodGet || request.Header.Get("Range") != "" {
+		return t.base.RoundTrip(request)
+	}
+	path := t.path(request)
+	stored, _ := t.load(path)
+	if stored != nil && stored.URL == request.URL.String() && t.now().Sub(stored.StoredAt) < t.ttl {
+		return stored.response(request), nil
+	}
+
+	conditional := request
+	if stored != nil {
+		conditional = request.Clone(request.Context())
+		if etag := stored.Header.Get("ETag"); etag != "" {
+			conditional.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := stored.Header.Get("Last-Modified"); lastModified != "" {
+			conditional.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	response, err := t.base.RoundTrip(conditional)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotModified && stored != nil {
+		_ = response.Body.Close()
+		// the 304 carries the current rate limit headers, which later requests rely on
+		for name, values := range response.Header {
+			stored.Header[name] = values
+		}
+		stored.StoredAt = t.now()
+		t.store(path, stored)
+		return stored.response(request), nil
+	}
+	if response.StatusCode != http.StatusOK || (response.Header.Get("ETag") == "" && response.Header.Get("Last-Modified") == "" && t.ttl == 0) {
+		return response, nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	t.store(path, &cachedResponse{
+		URL:        request.URL.String(),
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       body,
+		StoredAt:   t.now(),
+	})
+	return response, nil
+}
+
+// path locates the stored response for a request, keyed by its URL and the credentials making it,
+// which are taken from the request when the transport has no identity of its own
+func (t *cacheTransport) path(request *http.Request) string {
+	identity := t.identity
+	if identity == "" {
+		identity = request.Header.Get("Authorization")
+	}
+	digest := sha256.Sum256([]byte(identity + "\n" + request.Header.Get("Accept") + "\n" + request.URL.String()))
+	return filepath.Join(t.dir, hex.EncodeToString(digest[:])+".json")
+}
+
+func (t *cacheTransport) load(path string) (*cachedResponse, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var stored cachedResponse
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// store writes a response through a temporary file, so concurrent requests never read a partial entry.
+// The cache is an optimisation, so failures to write it are ignored.
+func (t *cacheTransport) store(path string, stored *cachedResponse) {
+	content, err := json.Marshal(stored)
+	if err != nil {
+		return
+	}
+	temporary, err := os.CreateTemp(t.dir, "entry-*")
+	if err != nil {
+		return
+	}
+	_, writeErr := temporary.Write(content)
+	closeErr := temporary.Close()
+	if writeErr != nil || closeErr != nil || os.Rename(temporary.Name(), path) != nil {
+		_ = os.Remove(temporary.Name())
+	}
+}
+
+func (c *cachedResponse) response(request *http.Request) *http.Response {
+	header := c.Header.Clone()
+	header.Set("X-From-Cache", "1")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.StatusCode, http.StatusText(c.StatusCode)),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       request,
+	}
+}
+
+// cacheClient returns an http client for a forge API or other download, caching its responses when
+// enabled and recording or replaying them when there is a cassette
+func cacheClient(config *config.Config, identity string, tape *cassette) (*http.Client, error) {
+	transport, err := cachedTransport(config, http.DefaultTransport, identity)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: tape.wrap(transport)}, nil
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheTransport(t *testing.T) {
+	var requests, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"tag_name": "v1.0.0"}]`))
+	}))
+	defer server.Close()
+
+	newClient := func(ttl, identity string, dir string) *http.Client {
+		cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"cache-dir": dir, "cache-ttl": ttl}}
+		transport, err := cachedTransport(cfg, server.Client().Transport, identity)
+		require.NoError(t, err)
+		return &http.Client{Transport: transport}
+	}
+	get := func(client *http.Client) string {
+		response, err := client.Get(server.URL + "/repos/owner/repo/releases")
+		require.NoError(t, err)
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("revalidates with the stored ETag", func(t *testing.T) {
+		requests.Store(0)
+		notModified.Store(0)
+		dir := t.TempDir()
+		assert.Equal(t, `[{"tag_name": "v1.0.0"}]`, get(newClient("", "token:a", dir)))
+		// a later run reuses the directory
+		assert.Equal(t, `[{"tag_name": "v1.0.0"}]`, get(newClient("", "token:a", dir)))
+		assert.Equal(t, int32(2), requests.Load())
+		assert.Equal(t, int32(1), notModified.Load())
+	})
+
+	t.Run("fresh responses are served without a request", func(t *testing.T) {
+		requests.Store(0)
+		client := newClient("1h", "token:a", t.TempDir())
+		get(client)
+		get(client)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("credentials do not share responses", func(t *testing.T) {
+		requests.Store(0)
+		notModified.Store(0)
+		dir := t.TempDir()
+		get(newClient("", "token:a", dir))
+		get(newClient("", "token:b", dir))
+		assert.Equal(t, int32(2), requests.Load())
+		assert.Equal(t, int32(0), notModified.Load())
+	})
+
+	t.Run("invalid ttl", func(t *testing.T) {
+		cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"cache-dir": t.TempDir(), "cache-ttl": "a day"}}
+		_, err := cachedTransport(cfg, http.DefaultTransport, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("disabled without a cache directory", func(t *testing.T) {
+		cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{}}
+		transport, err := cachedTransport(cfg, http.DefaultTransport, "")
+		require.NoError(t, err)
+		assert.Equal(t, http.DefaultTransport, transport)
+	})
+}
+
+func TestCacheTransport_RefreshesStaleEntries(t *testing.T) {
+	var version atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(etag))
+	}))
+	defer server.Close()
+	now := time.Unix(1700000000, 0)
+	transport := &cacheTransport{base: server.Client().Transport, dir: t.TempDir(), ttl: time.Minute, now: func() time.Time { return now }}
+	client := &http.Client{Transport: transport}
+	get := func() string {
+		response, err := client.Get(server.URL)
+		require.NoError(t, err)
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, `"v0"`, get())
+	version.Store(1)
+	assert.Equal(t, `"v0"`, get(), "served from the cache within the ttl")
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, `"v1"`, get(), "revalidated once the ttl has passed")
+}
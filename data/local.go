@@ -0,0 +1,317 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// reasons reported for data that only a forge can provide
+var localUnavailable = map[string]string{
+	BranchProtectionData:    "Branch protection is configured on the forge and cannot be determined from a local checkout; manual review required",
+	WorkflowPermissionsData: "Workflow token permissions are configured on the forge and cannot be determined from a local checkout; manual review required",
+	RepositorySettingsData:  "Repository settings are configured on the forge and cannot be determined from a local checkout; manual review required",
+	SecurityPostureData:     "Secret scanning settings are configured on the forge and cannot be determined from a local checkout; manual review required",
+	DependencyGraphData:     "The dependency graph is provided by the forge and is not available for a local checkout; manual review required",
+	StatusChecksData:        "Status checks are reported by the forge and cannot be determined from a local checkout; manual review required",
+	ReleaseNotesData:        "Release notes are stored on the forge and are not available for a local checkout; manual review required",
+}
+
+// programming language file extensions used to decide whether a local checkout contains code
+var codeExtensions = map[string]bool{
+	".c": true, ".cc": true, ".cpp": true, ".cs": true, ".go": true, ".h": true, ".hpp": true,
+	".java": true, ".js": true, ".jsx": true, ".kt": true, ".m": true, ".php": true, ".pl": true,
+	".py": true, ".rb": true, ".rs": true, ".scala": true, ".sh": true, ".swift": true, ".ts": true,
+	".tsx": true, ".zig": true,
+}
+
+// localProvider serves repository data from a working copy on disk. Anything
+// that is configured on the forge rather than committed to the repository is
+// reported as unavailable.
+type localProvider struct {
+	root   string
+	gitDir string
+}
+
+func (l *localProvider) Contents(repoPath string) (file *github.RepositoryContent, dir []*github.RepositoryContent, err error) {
+	clean := path.Clean("/" + repoPath)[1:]
+	fullPath, err := l.resolve(clean)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		raw, err := os.ReadFile(fullPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &github.RepositoryContent{
+			Type:     github.Ptr("file"),
+			Name:     github.Ptr(path.Base(clean)),
+			Path:     github.Ptr(clean),
+			Size:     github.Ptr(int(info.Size())),
+			Encoding: github.Ptr("base64"),
+			Content:  github.Ptr(base64.StdEncoding.EncodeToString(raw)),
+		}, nil, nil
+	}
+
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		entryType := "file"
+		if entry.IsDir() {
+			entryType = "dir"
+		} else if entry.Type()&fs.ModeSymlink != 0 {
+			entryType = "symlink"
+		}
+		dir = append(dir, &github.RepositoryContent{
+			Type: github.Ptr(entryType),
+			Name: github.Ptr(entry.Name()),
+			Path: github.Ptr(path.Join(clean, entry.Name())),
+		})
+	}
+	return nil, dir, nil
+}
+
+// resolve follows the symlinks in a path of the working copy, refusing those that lead outside of it,
+// so that a link committed to the repository can't expose other files on the machine
+func (l *localProvider) resolve(repoPath string) (string, error) {
+	root, err := filepath.EvalSymlinks(l.root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(repoPath)))
+	if err != nil {
+		return "", err
+	}
+	relative, err := filepath.Rel(root, resolved)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s links outside of the repository", repoPath)
+	}
+	return resolved, nil
+}
+
+// Releases reports each git tag as a release, as tags are the only release record kept in the repository
+func (l *localProvider) Releases() (releases []ReleaseData, err error) {
+	if l.gitDir == "" {
+		return nil, fmt.Errorf("no git metadata found in %s", l.root)
+	}
+	for _, tag := range readGitTags(l.gitDir) {
+		releases = append(releases, ReleaseData{Name: tag, TagName: tag})
+	}
+	return releases, nil
+}
+
+func (l *localProvider) WorkflowPermissions() (bool, WorkflowPermissions, error) {
+	return false, WorkflowPermissions{}, errors.New(localUnavailable[WorkflowPermissionsData])
+}
+
+func (l *localProvider) BranchProtection() (BranchProtection, error) {
+	return BranchProtection{}, errors.New(localUnavailable[BranchProtectionData])
+}
+
+func (l *localProvider) SecurityPosture(_ si.SecurityInsights) (SecurityPosture, error) {
+	return nil, errors.New(localUnavailable[SecurityPostureData])
+}
+
+func (l *localProvider) RepositoryMetadata() (RepositoryMetadata, error) {
+	return &unknownRepositoryMetadata{}, errors.New(localUnavailable[RepositorySettingsData])
+}
+
+// loadLocalPayload builds the payload from a repository checked out at root, without any calls
+// to the GitHub API. Data that only a forge can supply is listed in Payload.Unavailable.
+func loadLocalPayload(config *config.Config, root string) (Payload, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return Payload{}, fmt.Errorf("failed to read local repository: %w", err)
+	}
+	if !info.IsDir() {
+		return Payload{}, fmt.Errorf("local repository path is not a directory: %s", root)
+	}
+
+	provider := &localProvider{root: root}
+	provider.gitDir, err = resolveGitDir(root)
+	if err != nil {
+		config.Logger.Error(fmt.Sprintf("failed to locate git metadata, tags and HEAD will not be evaluated: %s", err.Error()))
+	}
+
+	payload := NewPayload(config, provider)
+	for _, source := range []string{DependencyGraphData, StatusChecksData, ReleaseNotesData} {
+		payload.Unavailable[source] = localUnavailable[source]
+	}
+
+	name := payload.repo
+	if name == "" {
+		name = filepath.Base(root)
+	}
+	var defaultBranch, headCommit string
+	if provider.gitDir != "" {
+		defaultBranch, headCommit = readGitHead(provider.gitDir)
+	}
+	payload.GraphqlRepoData = payload.describeRepository(name, defaultBranch, headCommit, false)
+
+	payload.SuspectedBinaries, payload.IsCodeRepo, err = scanLocalTree(root)
+	if err != nil {
+		return Payload{}, fmt.Errorf("failed to scan local repository: %w", err)
+	}
+	return payload, nil
+}
+
+// scanLocalTree walks the whole working copy, returning suspected binaries and whether any source code was found
+func scanLocalTree(root string) (suspectedBinaries []SuspectedBinary, isCodeRepo bool, err error) {
+	var paths []string
+	err = filepath.WalkDir(root, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, fullPath)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(relPath))
+		if codeExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			isCodeRepo = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	suspectedBinaries, err = scanForBinaries(paths, func(filePath string, limit int) ([]byte, error) {
+		file, err := os.Open(filepath.Join(root, filepath.FromSlash(filePath)))
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		if limit == 0 {
+			return io.ReadAll(file)
+		}
+		return io.ReadAll(io.LimitReader(file, int64(limit)))
+	})
+	return suspectedBinaries, isCodeRepo, err
+}
+
+// resolveGitDir returns the git metadata directory for a working copy, following
+// the "gitdir:" indirection used by worktrees and submodules
+func resolveGitDir(root string) (string, error) {
+	dotGit := filepath.Join(root, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return dotGit, nil
+	}
+	raw, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", err
+	}
+	target, found := strings.CutPrefix(strings.TrimSpace(string(raw)), "gitdir:")
+	if !found {
+		return "", fmt.Errorf("unrecognized .git file in %s", root)
+	}
+	target = strings.TrimSpace(target)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	return target, nil
+}
+
+// readGitHead returns the checked out branch name and commit, or an empty branch for a detached HEAD
+func readGitHead(gitDir string) (branch string, oid string) {
+	raw, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", ""
+	}
+	head := strings.TrimSpace(string(raw))
+	ref, found := strings.CutPrefix(head, "ref: ")
+	if !found {
+		return "", head
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), readGitRefs(gitDir)[ref]
+}
+
+// readGitTags returns the names of all tags in the repository, sorted by name
+func readGitTags(gitDir string) (tags []string) {
+	for ref := range readGitRefs(gitDir) {
+		if tag, found := strings.CutPrefix(ref, "refs/tags/"); found {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// readGitRefs reads loose and packed refs, with loose refs taking precedence
+func readGitRefs(gitDir string) map[string]string {
+	refs := make(map[string]string)
+
+	// worktrees keep shared refs in the common directory
+	commonDir := gitDir
+	if raw, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(raw))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	if raw, err := os.ReadFile(filepath.Join(commonDir, "packed-refs")); err == nil {
+		for _, line := range strings.Split(string(raw), "\n") {
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+				continue
+			}
+			oid, ref, found := strings.Cut(line, " ")
+			if found {
+				refs[ref] = oid
+			}
+		}
+	}
+
+	refsDir := filepath.Join(commonDir, "refs")
+	_ = filepath.WalkDir(refsDir, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		raw, err := os.ReadFile(fullPath)
+		if err != nil {
+			return nil
+		}
+		relPath, err := filepath.Rel(commonDir, fullPath)
+		if err != nil {
+			return nil
+		}
+		refs[filepath.ToSlash(relPath)] = strings.TrimSpace(string(raw))
+		return nil
+	})
+	return refs
+}
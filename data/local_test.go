@@ -0,0 +1,158 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecurityInsights = `header:
+  schema-version: 2.0.0
+  last-updated: '2025-01-01'
+  last-reviewed: '2025-01-01'
+  url: https://example.com/security-insights.yml
+repository:
+  url: https://example.com/repo
+  status: active
+  accepts-change-request: true
+  accepts-automated-change-request: true
+  core-team:
+    - name: Jane Doe
+      primary: true
+  license:
+    url: https://example.com/LICENSE
+    expression: MIT
+  security:
+    assessments:
+      self:
+        comment: none
+`
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0o755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0o644))
+	}
+}
+
+func TestLoadLocalPayload(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"README.md":                     "# Project\n\n## Support\n\nAsk in discussions.\n",
+		"LICENSE":                       "MIT License\n\nPermission is hereby granted, free of charge, to any person\n",
+		"CONTRIBUTING.md":               "Send a pull request.\n",
+		"main.go":                       "package main\n",
+		"bin/tool.exe":                  peExecutable,
+		".github/workflows/ci.yml":      "on: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n",
+		"security-insights.yml":         testSecurityInsights,
+		".git/HEAD":                     "ref: refs/heads/main\n",
+		".git/refs/heads/main":          "1111111111111111111111111111111111111111\n",
+		".git/refs/tags/v1.1.0":         "2222222222222222222222222222222222222222\n",
+		".git/packed-refs":              "# pack-refs with: peeled fully-peeled sorted\n3333333333333333333333333333333333333333 refs/tags/v1.0.0\n^4444444444444444444444444444444444444444\n",
+		".git/objects/pack/ignored.bin": "not part of the tree",
+	})
+
+	cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"owner": "test-owner", "repo": "test-repo"}}
+	payload, err := loadLocalPayload(cfg, root)
+	require.NoError(t, err)
+
+	assert.Equal(t, "test-repo", payload.Repository.Name)
+	assert.Equal(t, "main", payload.Repository.DefaultBranchRef.Name)
+	assert.Equal(t, "1111111111111111111111111111111111111111", payload.Repository.DefaultBranchRef.Target.OID)
+	assert.Equal(t, []ReleaseData{{Name: "v1.0.0", TagName: "v1.0.0"}, {Name: "v1.1.0", TagName: "v1.1.0"}}, payload.Releases)
+	assert.Equal(t, "LICENSE", payload.Repository.LicenseInfo.Url)
+	assert.Equal(t, "MIT", payload.Repository.LicenseInfo.SpdxId)
+	assert.Equal(t, "Send a pull request.\n", payload.Repository.ContributingGuidelines.Body)
+	assert.Equal(t, "https://example.com/security-insights.yml", payload.Insights.Header.URL)
+	assert.True(t, payload.IsCodeRepo)
+	assert.True(t, payload.HasSupportMarkdown())
+	assert.Equal(t, []SuspectedBinary{{Path: "bin/tool.exe", Type: "PE executable", SHA256: "a62041514d88e5f81ab7810f0a637eda55e0e552e84636fef50665fea71cf31d"}}, payload.SuspectedBinaries)
+	assert.Contains(t, payload.Unavailable, BranchProtectionData)
+	assert.Contains(t, payload.Unavailable, WorkflowPermissionsData)
+	assert.Contains(t, payload.Unavailable, RepositorySettingsData)
+	assert.Nil(t, payload.RepositoryMetadata.IsMFARequiredForAdministrativeActions())
+
+	workflows, err := payload.GetDirectoryContent(".github/workflows")
+	require.NoError(t, err)
+	require.Len(t, workflows, 1)
+	assert.Equal(t, ".github/workflows/ci.yml", workflows[0].GetPath())
+	content, err := workflows[0].GetContent()
+	require.NoError(t, err)
+	assert.Contains(t, content, "runs-on: ubuntu-latest")
+
+	binaries, err := payload.GetSuspectedBinaries()
+	assert.NoError(t, err)
+	assert.Equal(t, []SuspectedBinary{{Path: "bin/tool.exe", Type: "PE executable", SHA256: "a62041514d88e5f81ab7810f0a637eda55e0e552e84636fef50665fea71cf31d"}}, binaries)
+}
+
+func TestLoadLocalPayload_InvalidPath(t *testing.T) {
+	_, err := loadLocalPayload(&config.Config{Logger: hclog.NewNullLogger()}, filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestLocalProviderContents(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"docs/guide.md": "guide",
+		".git/HEAD":     "ref: refs/heads/main\n",
+	})
+	provider := &localProvider{root: root}
+
+	_, dir, err := provider.Contents("")
+	require.NoError(t, err)
+	require.Len(t, dir, 1, ".git should not be listed")
+	assert.Equal(t, "dir", dir[0].GetType())
+	assert.Equal(t, "docs", dir[0].GetPath())
+
+	file, _, err := provider.Contents("docs/guide.md")
+	require.NoError(t, err)
+	content, err := file.GetContent()
+	require.NoError(t, err)
+	assert.Equal(t, "guide", content)
+
+	_, _, err = provider.Contents("../outside")
+	assert.Error(t, err, "paths should not escape the repository root")
+}
+
+func TestLocalProviderContentsSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	writeTestFiles(t, outside, map[string]string{"secret.txt": "secret"})
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"docs/guide.md": "guide"})
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret.txt")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "linked")))
+	require.NoError(t, os.Symlink("docs/guide.md", filepath.Join(root, "GUIDE.md")))
+	provider := &localProvider{root: root}
+
+	_, _, err := provider.Contents("secret.txt")
+	assert.ErrorContains(t, err, "secret.txt links outside of the repository")
+	_, _, err = provider.Contents("linked/secret.txt")
+	assert.ErrorContains(t, err, "linked/secret.txt links outside of the repository")
+	_, _, err = provider.Contents("linked")
+	assert.Error(t, err, "directories outside the repository should not be listed")
+
+	file, _, err := provider.Contents("GUIDE.md")
+	require.NoError(t, err, "links within the repository should be followed")
+	content, err := file.GetContent()
+	require.NoError(t, err)
+	assert.Equal(t, "guide", content)
+}
+
+func TestResolveGitDir(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		".git": "gitdir: ../main/.git/worktrees/feature\n",
+	})
+	gitDir, err := resolveGitDir(root)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "..", "main", ".git", "worktrees", "feature"), gitDir)
+
+	_, err = resolveGitDir(t.TempDir())
+	assert.Error(t, err)
+}
@@ -2,7 +2,12 @@ package data
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/v74/github"
 	"github.com/privateerproj/privateer-sdk/config"
@@ -10,98 +15,306 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// Names of the data sources that may be missing from a Payload, used as keys in Payload.Unavailable
+const (
+	BranchProtectionData     = "branch protection"
+	WorkflowPermissionsData  = "workflow permissions"
+	RepositorySettingsData   = "repository settings"
+	OrganizationSettingsData = "organization settings"
+	SecurityPostureData      = "security posture"
+	DependencyGraphData      = "dependency graph"
+	StatusChecksData         = "status checks"
+	ReleaseNotesData         = "release notes"
+	ReleasesData             = "releases"
+	RulesetsData             = "rulesets"
+)
+
 type Payload struct {
+	// GraphqlRepoData describes the repository as the GitHub GraphQL API does. Other data sources fill
+	// the fields steps read from it with describeRepository, and it is never nil once loaded.
 	*GraphqlRepoData
 	*RestData
 	Config                   *config.Config
-	SuspectedBinaries        []string
+	BranchProtection         BranchProtection
+	SuspectedBinaries        []SuspectedBinary
 	RepositoryMetadata       RepositoryMetadata
 	DependencyManifestsCount int
 	IsCodeRepo               bool
 	SecurityPosture          SecurityPosture
-	client                   *githubv4.Client
+	// Unavailable maps data sources that could not be loaded to the reason why,
+	// so that steps depending on them can request a manual review instead of guessing
+	Unavailable map[string]string
+	// BinaryAllowlist lists the binaries committed on purpose, from the binary-allowlist var
+	BinaryAllowlist []BinaryAllowlistEntry
+	// ReleaseAssetTemplates are the naming schemes of release assets, from the release-asset-templates var
+	ReleaseAssetTemplates []ReleaseAssetTemplate
 }
 
-func Loader(config *config.Config) (payload any, err error) {
-	graphql, client, err := getGraphqlRepoData(config)
-	if err != nil {
-		return nil, err
+// NewLoader returns the loader of an evaluation suite. It builds the payload for the repository in the
+// config, then reports which requirements will need a manual review because data their steps depend on
+// could not be loaded. dataSources maps requirement IDs to the Unavailable keys of those data sources.
+func NewLoader(dataSources map[string][]string) func(*config.Config) (any, error) {
+	return func(config *config.Config) (any, error) {
+		return load(config, dataSources)
 	}
+}
 
-	ghClient := github.NewClient(oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: config.GetString("token")},
-	)))
-
-	repo, repositoryMetadata, err := loadRepositoryMetadata(ghClient, config.GetString("owner"), config.GetString("repo"))
+func load(config *config.Config, dataSources map[string][]string) (payload any, err error) {
+	snapshot, snapshotMode := config.GetString("snapshot"), config.GetString("snapshot-mode")
+	if snapshot != "" && snapshotMode != snapshotExport && snapshotMode != snapshotEvaluate {
+		return nil, fmt.Errorf("invalid snapshot-mode %q, expected export or evaluate", snapshotMode)
+	}
+	allowlist, err := loadBinaryAllowlist(config)
 	if err != nil {
 		return nil, err
 	}
-
-	dependencyManifestsCount, err := countDependencyManifests(client, config)
+	templates, err := loadReleaseAssetTemplates(config)
 	if err != nil {
 		return nil, err
 	}
+	if snapshot != "" && snapshotMode == snapshotEvaluate {
+		loaded, err := loadSnapshotPayload(config, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		loaded.BinaryAllowlist = allowlist
+		loaded.ReleaseAssetTemplates = templates
+		if err := reportDegradedSources(config, loaded.DegradedSources(dataSources)); err != nil {
+			return nil, err
+		}
+		return any(loaded), nil
+	}
 
-	rest, err := getRestData(ghClient, config)
+	tape, err := openCassette(config)
 	if err != nil {
 		return nil, err
 	}
-
-	isCodeRepo, err := rest.IsCodeRepo()
+	loaded, err := loadPayload(config, tape)
 	if err != nil {
 		return nil, err
 	}
-
-	securityPosture, err := buildSecurityPosture(repo, *rest)
-	if err != nil {
+	loaded.BinaryAllowlist = allowlist
+	loaded.ReleaseAssetTemplates = templates
+	// downloads from outside the forge, such as the SPDX license list, are cached and recorded too
+	if loaded.HttpClient, err = cacheClient(config, "", tape); err != nil {
 		return nil, err
 	}
+	if snapshot != "" {
+		if err := exportSnapshot(&loaded, snapshot); err != nil {
+			return nil, err
+		}
+	}
+	if err := reportDegradedSources(config, loaded.DegradedSources(dataSources)); err != nil {
+		return nil, err
+	}
+	return any(loaded), nil
+}
 
-	return any(Payload{
-		GraphqlRepoData:          graphql,
-		RestData:                 rest,
-		Config:                   config,
-		RepositoryMetadata:       repositoryMetadata,
-		DependencyManifestsCount: dependencyManifestsCount,
-		IsCodeRepo:               isCodeRepo,
-		client:                   client,
-		SecurityPosture:          securityPosture,
-	}), nil
+func loadPayload(config *config.Config, tape *cassette) (Payload, error) {
+	if config.GetString("local-path") != "" {
+		return loadLocalPayload(config, config.GetString("local-path"))
+	}
+	switch forge := config.GetString("forge"); forge {
+	case "", "github":
+		return loadGithubPayload(config, tape)
+	case "gitlab", "gitea", "forgejo":
+		httpClient, err := cacheClient(config, credentialIdentity(config), tape)
+		if err != nil {
+			return Payload{}, err
+		}
+		if forge == "gitlab" {
+			return loadGitlabPayload(config, httpClient)
+		}
+		return loadGiteaPayload(config, httpClient)
+	default:
+		return Payload{}, fmt.Errorf("unsupported forge %q, expected github, gitlab, gitea or forgejo", forge)
+	}
 }
 
-func getGraphqlRepoData(config *config.Config) (data *GraphqlRepoData, client *githubv4.Client, err error) {
-	src := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: config.GetString("token")},
+func loadGithubPayload(config *config.Config, tape *cassette) (Payload, error) {
+	api, err := resolveGithubAPI(config.GetString("base-url"))
+	if err != nil {
+		return Payload{}, err
+	}
+	transport := newRateLimitTransport(http.DefaultTransport, config.Logger)
+	trackAPIUsage(transport)
+	cached, err := cachedTransport(config, transport, credentialIdentity(config))
+	if err != nil {
+		return Payload{}, err
+	}
+	// REST, GraphQL and raw API calls share one client, so app installation tokens are refreshed,
+	// responses are cached and recorded, and rate limits are waited out in one place
+	httpClient := &http.Client{Transport: tape.wrap(cached)}
+	if !tape.replaying() {
+		// a replayed run needs no credentials, as it never reaches GitHub
+		tokenSource, err := githubTokenSource(config, api, &http.Client{Transport: transport})
+		if err != nil {
+			return Payload{}, err
+		}
+		httpClient.Transport = &oauth2.Transport{Source: tokenSource, Base: httpClient.Transport}
+	}
+	ghClient, client, err := api.clients(httpClient)
+	if err != nil {
+		return Payload{}, err
+	}
+
+	owner, repo := config.GetString("owner"), config.GetString("repo")
+
+	// the independent fetches run concurrently. The repository query and languages are needed to
+	// evaluate anything, so if either fails the remaining fetches are cancelled; other failures
+	// are recorded against their data source
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		wg                       sync.WaitGroup
+		graphql                  *GraphqlRepoData
+		graphqlErr               error
+		repository               *github.Repository
+		repositoryMetadata       RepositoryMetadata
+		metadataErr              error
+		dependencyManifestsCount int
+		dependencyErr            error
+		isCodeRepo               bool
+		languagesErr             error
 	)
-	httpClient := oauth2.NewClient(context.Background(), src)
-	client = githubv4.NewClient(httpClient)
+	wg.Go(func() {
+		if graphql, graphqlErr = getGraphqlRepoData(ctx, config, client); graphqlErr != nil {
+			cancel()
+		}
+	})
+	wg.Go(func() {
+		repository, repositoryMetadata, metadataErr = loadRepositoryMetadata(ctx, ghClient, owner, repo)
+	})
+	wg.Go(func() {
+		dependencyManifestsCount, dependencyErr = countDependencyManifests(ctx, client, config)
+	})
+	wg.Go(func() {
+		if isCodeRepo, languagesErr = hasLanguages(ctx, ghClient, owner, repo); languagesErr != nil {
+			cancel()
+		}
+	})
+	wg.Wait()
+	if graphqlErr != nil || languagesErr != nil {
+		return Payload{}, errors.Join(graphqlErr, languagesErr)
+	}
+
+	// learn what the credentials can't read while the data sources are loaded, so missing
+	// permissions aren't mistaken for missing settings
+	var unreadable map[string]string
+	wg.Go(func() {
+		unreadable = githubPreflight(ctx, config, httpClient, api.restBase, graphql.Repository.DefaultBranchRef.Name)
+	})
+	data := NewPayload(config, &githubProvider{
+		apiBase:     api.restBase,
+		owner:       owner,
+		repo:        repo,
+		config:      config,
+		client:      ghClient,
+		httpClient:  httpClient,
+		graphql:     graphql,
+		repository:  repository,
+		metadata:    repositoryMetadata,
+		metadataErr: metadataErr,
+	})
+	wg.Wait()
+
+	data.GraphqlRepoData = graphql
+	data.DependencyManifestsCount = dependencyManifestsCount
+	data.IsCodeRepo = isCodeRepo
+	data.ghClient = ghClient
+	data.apiBase = api.restBase
+	data.authClient = httpClient
+	if dependencyErr != nil {
+		data.Unavailable[DependencyGraphData] = fmt.Sprintf("Failed to read the dependency graph: %s; manual review required", dependencyErr.Error())
+	}
+	for source, reason := range unreadable {
+		if _, ok := data.Unavailable[source]; !ok {
+			data.Unavailable[source] = reason
+		}
+	}
+
+	return data, nil
+}
 
+func getGraphqlRepoData(ctx context.Context, config *config.Config, client *githubv4.Client) (data *GraphqlRepoData, err error) {
 	variables := map[string]any{
 		"owner": githubv4.String(config.GetString("owner")),
 		"name":  githubv4.String(config.GetString("repo")),
 	}
 
-	err = client.Query(context.Background(), &data, variables)
+	err = client.Query(ctx, &data, variables)
 	if err != nil {
 		config.Logger.Error(fmt.Sprintf("Error querying GitHub GraphQL API: %s", err.Error()))
 	}
-	return data, client, err
+	return data, err
+}
+
+// GetSuspectedBinaries scans the default branch for binary artifacts, identifying them by their
+// content, and marks those covered by the binary allowlist as allowed
+func (p *Payload) GetSuspectedBinaries() (suspectedBinaries []SuspectedBinary, err error) {
+	if suspectedBinaries, err = p.scanTreeForBinaries(); err != nil {
+		return nil, err
+	}
+	return applyBinaryAllowlist(suspectedBinaries, p.BinaryAllowlist, time.Now()), nil
+}
+
+func (p *Payload) scanTreeForBinaries() (suspectedBinaries []SuspectedBinary, err error) {
+	if p.binaryScanErr != nil {
+		return nil, p.binaryScanErr
+	}
+	if p.ghClient == nil {
+		// data sources without API access scan their tree while loading
+		return p.SuspectedBinaries, nil
+	}
+	suspectedBinaries, err = p.scanGithubTreeForBinaries()
+	p.snapshot.recordBinaryScan(suspectedBinaries, err)
+	return suspectedBinaries, err
 }
 
-func getRestData(ghClient *github.Client, config *config.Config) (data *RestData, err error) {
-	r := &RestData{
-		ghClient: ghClient,
-		Config:   config,
+func (p *Payload) scanGithubTreeForBinaries() (suspectedBinaries []SuspectedBinary, err error) {
+	ref := p.Repository.DefaultBranchRef.Target.OID
+	if ref == "" {
+		ref = p.Repository.DefaultBranchRef.Name
+	}
+	ctx := context.Background()
+	files, err := fetchRepoTree(ctx, p.ghClient, p.owner, p.repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(files))
+	blobs := make(map[string]*github.TreeEntry, len(files))
+	for _, file := range files {
+		paths = append(paths, file.GetPath())
+		blobs[file.GetPath()] = file
 	}
-	err = r.Setup()
-	return r, err
+	return scanForBinaries(paths, func(filePath string, limit int) ([]byte, error) {
+		if limit > 0 {
+			return p.readBlobStart(ctx, blobs[filePath].GetSHA(), limit)
+		}
+		// blobs are downloaded whole for their digest, so very large ones are left for review rather than fetched
+		if size := blobs[filePath].GetSize(); size > binaryScanMaxSize {
+			return nil, fmt.Errorf("%d MiB is over the %d MiB read limit", size>>20, binaryScanMaxSize>>20)
+		}
+		content, _, err := p.ghClient.Git.GetBlobRaw(ctx, p.owner, p.repo, blobs[filePath].GetSHA())
+		return content, err
+	})
 }
 
-func (p *Payload) GetSuspectedBinaries() (suspectedBinaries []string, err error) {
-	tree, err := fetchGraphqlRepoTree(p.Config, p.client, p.Repository.DefaultBranchRef.Name)
+// readBlobStart fetches the first limit bytes of a blob's raw content with a ranged request. Should
+// the range be ignored, the rest of the response is left unread.
+func (p *Payload) readBlobStart(ctx context.Context, sha string, limit int) ([]byte, error) {
+	request, err := p.ghClient.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/git/blobs/%s", p.owner, p.repo, sha), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/vnd.github.v3.raw")
+	request.Header.Set("Range", fmt.Sprintf("bytes=0-%d", limit-1))
+	response, err := p.ghClient.BareDo(ctx, request)
 	if err != nil {
 		return nil, err
 	}
-	binaryFileNames := checkTreeForBinaries(tree)
-	return binaryFileNames, nil
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	return io.ReadAll(io.LimitReader(response.Body, int64(limit)))
 }
@@ -0,0 +1,147 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// standInWorkflow calls a reusable workflow and a composite action in the repository, which calls another
+const standInWorkflow = "on: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - uses: ./.github/actions/setup\n" +
+	"  release:\n    uses: ./.github/workflows/release.yml\n"
+
+const standInAction = "runs:\n  using: composite\n  steps:\n    - uses: './.github/actions/cache'\n"
+
+// githubStandIn serves just enough of the GitHub API to load a payload for owner/repo
+func githubStandIn(failDependencyGraph, failRepositoryQuery bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/graphql":
+			body, _ := io.ReadAll(r.Body)
+			dependencyQuery := strings.Contains(string(body), "dependencyGraphManifests")
+			if (dependencyQuery && failDependencyGraph) || (!dependencyQuery && failRepositoryQuery) {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			repository := map[string]any{"name": "repo", "defaultBranchRef": map[string]any{"name": "main"}}
+			if dependencyQuery {
+				repository = map[string]any{"dependencyGraphManifests": map[string]any{"totalCount": 2}}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"repository": repository}})
+		case "/api/v3/repos/owner/repo":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "repo"})
+		case "/api/v3/repos/owner/repo/languages":
+			_ = json.NewEncoder(w).Encode(map[string]any{"Go": 1000})
+		case "/api/v3/repos/owner/repo/actions", "/api/v3/repos/owner/repo/actions/permissions/workflow":
+			_, _ = w.Write([]byte("{}"))
+		case "/api/v3/orgs/owner":
+			w.WriteHeader(http.StatusNotFound)
+		case "/api/v3/repos/owner/repo/contents/":
+			_, _ = w.Write([]byte(`[{"type": "dir", "name": ".github", "path": ".github"}]`))
+		case "/api/v3/repos/owner/repo/contents/.github":
+			_, _ = w.Write([]byte(`[{"type": "dir", "name": "workflows", "path": ".github/workflows"}]`))
+		case "/api/v3/repos/owner/repo/contents/.github/workflows":
+			_, _ = w.Write([]byte(`[{"type": "file", "name": "ci.yml", "path": ".github/workflows/ci.yml"}]`))
+		case "/api/v3/repos/owner/repo/contents/.github/workflows/ci.yml":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"type": "file", "name": "ci.yml", "path": ".github/workflows/ci.yml", "encoding": "base64",
+				"content": base64.StdEncoding.EncodeToString([]byte(standInWorkflow)),
+			})
+		case "/api/v3/repos/owner/repo/contents/.github/workflows/release.yml":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"type": "file", "name": "release.yml", "path": ".github/workflows/release.yml", "encoding": "base64",
+				"content": base64.StdEncoding.EncodeToString([]byte("on: workflow_call\n")),
+			})
+		case "/api/v3/repos/owner/repo/contents/.github/actions/setup/action.yml":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"type": "file", "name": "action.yml", "path": ".github/actions/setup/action.yml", "encoding": "base64",
+				"content": base64.StdEncoding.EncodeToString([]byte(standInAction)),
+			})
+		case "/api/v3/repos/owner/repo/contents/.github/actions/cache/action.yaml":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"type": "file", "name": "action.yaml", "path": ".github/actions/cache/action.yaml", "encoding": "base64",
+				"content": base64.StdEncoding.EncodeToString([]byte("runs:\n  using: composite\n  steps: []\n")),
+			})
+		case "/api/v3/repos/owner/repo/contents/.github/actions/cache/action.yml":
+			w.WriteHeader(http.StatusNotFound)
+		case "/api/v3/repos/owner/repo/git/trees/main":
+			_, _ = w.Write([]byte(`{"sha": "main", "tree": [{"path": "bin", "type": "tree"}, {"path": "bin/tool.exe", "type": "blob", "sha": "tool"}, {"path": "bin/huge.dat", "type": "blob", "sha": "huge", "size": 41943040}, {"path": "build/Dockerfile", "type": "blob", "sha": "dockerfile"}, {"path": "vendor/lib/Makefile", "type": "blob", "sha": "makefile"}]}`))
+		case "/api/v3/repos/owner/repo/contents/build/Dockerfile":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"type": "file", "name": "Dockerfile", "path": "build/Dockerfile", "encoding": "base64",
+				"content": base64.StdEncoding.EncodeToString([]byte("FROM node\nRUN npm ci\n")),
+			})
+		case "/api/v3/repos/owner/repo/releases":
+			download := "http://" + r.Host + "/downloads/v1.0.0/"
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"tag_name": "v1.0.0", "assets": []map[string]any{
+				{"name": "tool", "browser_download_url": download + "tool"},
+				{"name": "checksums.txt", "browser_download_url": download + "checksums.txt"},
+			}}})
+		case "/downloads/v1.0.0/checksums.txt":
+			_, _ = w.Write([]byte("ced1af6d51438341a0335cc00e1c2867fb718a537c1173cf210070a6b1cdf40a  tool\n"))
+		case "/api/v3/repos/owner/repo/git/blobs/huge":
+			// only the start of the blob can be read
+			if r.Header.Get("Range") == "" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(append([]byte("\x1f\x8b\x08\x00"), make([]byte, binarySniffLength-4)...))
+		case "/api/v3/repos/owner/repo/git/blobs/tool":
+			_, _ = w.Write([]byte("\x7fELF\x02\x01\x01"))
+		case "/api/v3/repos/owner/repo/rules/branches/main":
+			_, _ = w.Write([]byte(`[{"type": "required_status_checks"}]`))
+		default:
+			_, _ = w.Write([]byte("[]"))
+		}
+	}))
+}
+
+func TestLoadGithubPayload(t *testing.T) {
+	tests := []struct {
+		name                string
+		failDependencyGraph bool
+		failRepositoryQuery bool
+		expectError         bool
+		expectUnavailable   []string
+	}{
+		{name: "all data sources load"},
+		{name: "dependency graph failure is recorded", failDependencyGraph: true, expectUnavailable: []string{DependencyGraphData}},
+		{name: "repository query failure aborts loading", failRepositoryQuery: true, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := githubStandIn(tt.failDependencyGraph, tt.failRepositoryQuery)
+			defer server.Close()
+			cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{
+				"owner": "owner", "repo": "repo", "token": "token", "base-url": server.URL,
+			}}
+
+			payload, err := loadGithubPayload(cfg, nil)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "repo", payload.Repository.Name)
+			assert.True(t, payload.IsCodeRepo)
+			for _, source := range tt.expectUnavailable {
+				assert.Contains(t, payload.Unavailable, source)
+			}
+			if !tt.failDependencyGraph {
+				assert.Equal(t, 2, payload.DependencyManifestsCount)
+				assert.NotContains(t, payload.Unavailable, DependencyGraphData)
+			}
+		})
+	}
+}
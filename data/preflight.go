@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// DegradedSource is a data source that could not be loaded, with the requirements that will need a manual review as a result
+type DegradedSource struct {
+	Source       string   `json:"source"`
+	Reason       string   `json:"reason"`
+	Requirements []string `json:"requirements"`
+}
+
+// DegradedSources lists the unavailable data sources in name order, with the requirements that declare
+// a dependency on each. dataSources maps requirement IDs to the Unavailable keys their steps depend on.
+func (p *Payload) DegradedSources(dataSources map[string][]string) (sources []DegradedSource) {
+	for source, reason := range p.Unavailable {
+		var requirements []string
+		for requirement, dependencies := range dataSources {
+			if slices.Contains(dependencies, source) {
+				requirements = append(requirements, requirement)
+			}
+		}
+		sort.Strings(requirements)
+		sources = append(sources, DegradedSource{
+			Source:       source,
+			Reason:       reason,
+			Requirements: requirements,
+		})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Source < sources[j].Source })
+	return sources
+}
+
+// reportDegradedSources logs which requirements will need a manual review, before any steps run, and
+// writes the report to the file in the preflight-report var when it is set
+func reportDegradedSources(config *config.Config, sources []DegradedSource) error {
+	if len(sources) == 0 {
+		config.Logger.Info("Preflight: all data sources are available")
+	}
+	for _, source := range sources {
+		requirements := "no requirements"
+		if len(source.Requirements) > 0 {
+			requirements = strings.Join(source.Requirements, ", ")
+		}
+		config.Logger.Warn(fmt.Sprintf("Preflight: %s unavailable, %s will need review: %s", source.Source, requirements, source.Reason))
+	}
+
+	path := config.GetString("preflight-report")
+	if path == "" {
+		return nil
+	}
+	report := struct {
+		Unavailable []DegradedSource `json:"unavailable"`
+	}{Unavailable: sources}
+	if report.Unavailable == nil {
+		report.Unavailable = []DegradedSource{}
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write preflight report: %w", err)
+	}
+	return nil
+}
+
+// preflightCheck is a GitHub endpoint that a data source depends on
+type preflightCheck struct {
+	source string
+	// endpoint is relative to the API base, with {owner}, {repo} and {branch} placeholders
+	endpoint string
+	// permission describes the access needed, for responses that don't list the accepted permissions
+	permission string
+	// readable reports whether a response shows the credentials can read the data, defaulting to a 200 status
+	readable func(status int, body []byte) bool
+}
+
+var githubPreflightChecks = []preflightCheck{
+	{
+		source:     OrganizationSettingsData,
+		endpoint:   "/orgs/{owner}",
+		permission: "the admin:org scope, or organization Administration read permission",
+		readable:   showsTwoFactorRequirement,
+	},
+	{
+		source:     BranchProtectionData,
+		endpoint:   "/repos/{owner}/{repo}/branches/{branch}/protection",
+		permission: "the repo scope, or Administration read permission",
+		readable:   showsBranchProtection,
+	},
+	{
+		source:     WorkflowPermissionsData,
+		endpoint:   "/repos/{owner}/{repo}/actions/permissions/workflow",
+		permission: "the repo scope, or Administration read permission",
+	},
+	{
+		source:     StatusChecksData,
+		endpoint:   "/repos/{owner}/{repo}/rules/branches/{branch}",
+		permission: "the repo scope, or Metadata read permission",
+	},
+	{
+		source:     SecurityPostureData,
+		endpoint:   "/repos/{owner}/{repo}",
+		permission: "admin rights on the repository",
+		readable:   showsSecurityAndAnalysis,
+	},
+}
+
+// githubPreflight checks that the credentials can read each endpoint the GitHub data sources depend on,
+// returning the reason for each source they can't read. The OAuth scopes of a classic token are logged;
+// fine-grained tokens and GitHub Apps don't report theirs, so only endpoint access is checked for them.
+func githubPreflight(ctx context.Context, config *config.Config, httpClient HttpClient, apiBase, branch string) map[string]string {
+	placeholders := strings.NewReplacer(
+		"{owner}", url.PathEscape(config.GetString("owner")),
+		"{repo}", url.PathEscape(config.GetString("repo")),
+		"{branch}", url.PathEscape(branch),
+	)
+	unreadable := make(map[string]string)
+	scopesLogged := false
+	for _, check := range githubPreflightChecks {
+		response, body, err := preflightRequest(ctx, httpClient, apiBase+placeholders.Replace(check.endpoint))
+		if err != nil {
+			unreadable[check.source] = fmt.Sprintf("Preflight request for %s failed: %s; manual review required", check.source, err.Error())
+			continue
+		}
+		if scopes, ok := response.Header["X-Oauth-Scopes"]; ok && !scopesLogged {
+			config.Logger.Info(fmt.Sprintf("Preflight: token scopes are %q", strings.Join(scopes, ", ")))
+			scopesLogged = true
+		}
+		readable := check.readable
+		if readable == nil {
+			readable = func(status int, _ []byte) bool { return status == http.StatusOK }
+		}
+		if readable(response.StatusCode, body) {
+			continue
+		}
+		status := ""
+		if response.StatusCode != http.StatusOK {
+			status = fmt.Sprintf(" (%s)", response.Status)
+		}
+		unreadable[check.source] = fmt.Sprintf("The credentials can't read the %s%s, which needs %s; manual review required",
+			check.source, status, acceptedPermissions(response.Header, check.permission))
+	}
+	return unreadable
+}
+
+func preflightRequest(ctx context.Context, httpClient HttpClient, endpoint string) (response *http.Response, body []byte, err error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	response, err = httpClient.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	body, err = io.ReadAll(response.Body)
+	return response, body, err
+}
+
+// acceptedPermissions names the access GitHub accepts for an endpoint, as listed in its response
+// headers for classic and fine-grained tokens, falling back to fallback
+func acceptedPermissions(header http.Header, fallback string) string {
+	if _, classic := header["X-Oauth-Scopes"]; classic && header.Get("X-Accepted-Oauth-Scopes") != "" {
+		return "one of the scopes " + header.Get("X-Accepted-Oauth-Scopes")
+	}
+	if permissions := header.Get("X-Accepted-Github-Permissions"); permissions != "" {
+		return "the permissions " + permissions
+	}
+	return fallback
+}
+
+// showsTwoFactorRequirement is true when the owner is a user, which has no organization settings,
+// or an organization whose two-factor requirement is visible to the credentials
+func showsTwoFactorRequirement(status int, body []byte) bool {
+	if status == http.StatusNotFound {
+		return true
+	}
+	var organization struct {
+		TwoFactorRequirementEnabled *bool `json:"two_factor_requirement_enabled"`
+	}
+	return status == http.StatusOK && json.Unmarshal(body, &organization) == nil && organization.TwoFactorRequirementEnabled != nil
+}
+
+// showsBranchProtection is true when the branch's protection can be read, including learning that it has none
+func showsBranchProtection(status int, body []byte) bool {
+	if status == http.StatusOK {
+		return true
+	}
+	var response struct {
+		Message string `json:"message"`
+	}
+	return status == http.StatusNotFound && json.Unmarshal(body, &response) == nil && response.Message == "Branch not protected"
+}
+
+// showsSecurityAndAnalysis is true when the repository's security settings are included, which requires admin rights
+func showsSecurityAndAnalysis(status int, body []byte) bool {
+	var repository struct {
+		SecurityAndAnalysis json.RawMessage `json:"security_and_analysis"`
+	}
+	return status == http.StatusOK && json.Unmarshal(body, &repository) == nil && len(repository.SecurityAndAnalysis) > 0 && string(repository.SecurityAndAnalysis) != "null"
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGithubPreflight(t *testing.T) {
+	tests := []struct {
+		name       string
+		responses  map[string]string
+		forbidden  []string
+		unreadable []string
+	}{
+		{
+			name: "admin token",
+			responses: map[string]string{
+				"/orgs/owner": `{"two_factor_requirement_enabled": true}`,
+				"/repos/owner/repo/branches/main/protection": `{}`,
+				"/repos/owner/repo":                          `{"security_and_analysis": {"secret_scanning": {"status": "enabled"}}}`,
+			},
+		},
+		{
+			name: "read only token",
+			responses: map[string]string{
+				"/orgs/owner":       `{"login": "owner"}`,
+				"/repos/owner/repo": `{"name": "repo"}`,
+			},
+			forbidden:  []string{"/repos/owner/repo/branches/main/protection", "/repos/owner/repo/actions/permissions/workflow"},
+			unreadable: []string{BranchProtectionData, OrganizationSettingsData, SecurityPostureData, WorkflowPermissionsData},
+		},
+		{
+			name: "user owned repository with an unprotected branch",
+			responses: map[string]string{
+				"/repos/owner/repo": `{"security_and_analysis": {}}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for _, path := range tt.forbidden {
+					if r.URL.Path == path {
+						w.Header().Set("X-Accepted-GitHub-Permissions", "administration=read")
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+				}
+				switch body, ok := tt.responses[r.URL.Path]; {
+				case ok:
+					_, _ = w.Write([]byte(body))
+				case r.URL.Path == "/repos/owner/repo/branches/main/protection":
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"message": "Branch not protected"}`))
+				case r.URL.Path == "/orgs/owner":
+					w.WriteHeader(http.StatusNotFound)
+				default:
+					_, _ = w.Write([]byte("[]"))
+				}
+			}))
+			defer server.Close()
+			cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"owner": "owner", "repo": "repo"}}
+
+			unreadable := githubPreflight(context.Background(), cfg, server.Client(), server.URL, "main")
+
+			var sources []string
+			for source := range unreadable {
+				sources = append(sources, source)
+			}
+			assert.ElementsMatch(t, tt.unreadable, sources)
+			if reason, ok := unreadable[WorkflowPermissionsData]; ok {
+				assert.Contains(t, reason, "administration=read")
+			}
+		})
+	}
+}
+
+func TestDegradedSources(t *testing.T) {
+	dataSources := map[string][]string{
+		"OSPS-AC-01.01": {RepositorySettingsData, OrganizationSettingsData},
+		"OSPS-AC-04.02": {WorkflowPermissionsData},
+		"OSPS-AC-04.01": {WorkflowPermissionsData},
+		"OSPS-QA-02.01": {DependencyGraphData},
+	}
+	payload := Payload{Unavailable: map[string]string{
+		WorkflowPermissionsData:  "no access",
+		OrganizationSettingsData: "no admin:org",
+		SecurityPostureData:      "not an admin",
+	}}
+
+	assert.Equal(t, []DegradedSource{
+		{Source: OrganizationSettingsData, Reason: "no admin:org", Requirements: []string{"OSPS-AC-01.01"}},
+		{Source: SecurityPostureData, Reason: "not an admin"},
+		{Source: WorkflowPermissionsData, Reason: "no access", Requirements: []string{"OSPS-AC-04.01", "OSPS-AC-04.02"}},
+	}, payload.DegradedSources(dataSources))
+}
+
+func TestReportDegradedSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preflight.json")
+	config := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"preflight-report": path}}
+
+	require.NoError(t, reportDegradedSources(config, []DegradedSource{
+		{Source: WorkflowPermissionsData, Reason: "no access", Requirements: []string{"OSPS-AC-04.01"}},
+	}))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"unavailable": [{"source": "workflow permissions", "reason": "no access", "requirements": ["OSPS-AC-04.01"]}]}`, string(content))
+
+	require.NoError(t, reportDegradedSources(config, nil))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"unavailable": []}`, string(content))
+}
@@ -0,0 +1,181 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// Provider supplies the repository data that evaluation steps depend on.
+// GitHub is the default implementation; other forges, local checkouts and
+// test doubles implement the same interface so the steps don't need to change.
+//
+// A method returns an error when its data cannot be supplied; the error text
+// is recorded in Payload.Unavailable as the reason shown to the reviewer, and
+// any partial data returned alongside the error is still used.
+type Provider interface {
+	// Contents returns the file, or the directory listing, found at path in the default branch
+	Contents(path string) (file *github.RepositoryContent, dir []*github.RepositoryContent, err error)
+	// Releases lists the repository's releases, newest first
+	Releases() ([]ReleaseData, error)
+	// WorkflowPermissions reports whether CI/CD workflows are enabled and the permissions they receive by default
+	WorkflowPermissions() (enabled bool, permissions WorkflowPermissions, err error)
+	// BranchProtection reports the protections enforced on the primary branch. When only the rulesets
+	// can't be read, the rest of the protection is returned with an error wrapping ErrRulesetsUnavailable.
+	BranchProtection() (BranchProtection, error)
+	// SecurityPosture reports how secrets are handled, taking any Security Insights claims into account
+	SecurityPosture(insights si.SecurityInsights) (SecurityPosture, error)
+	// RepositoryMetadata reports general facts about the repository and its owner
+	RepositoryMetadata() (RepositoryMetadata, error)
+}
+
+// ErrRulesetsUnavailable is returned with the rest of a branch's protection when its rulesets can't be read
+var ErrRulesetsUnavailable = errors.New("the rulesets targeting the branch are unavailable")
+
+// BranchProtection describes the protections enforced on a branch, independent of the forge that enforces them
+type BranchProtection struct {
+	RestrictsPushes              bool
+	RequiresApprovingReviews     bool
+	RequiredApprovingReviewCount int
+	RequiresLastPushApproval     bool
+	RequiresCommitSignatures     bool
+	RequiresStatusChecks         bool
+	RequiredStatusChecks         []string
+	AllowsDeletions              bool
+	AllowsForcePushes            bool
+	// BypassActors lists who may push directly past the branch protection rule, from its push and
+	// pull request bypass allowances and, unless the rule is enforced for them, admins
+	BypassActors []BypassActor
+	// Rulesets lists the active and evaluate mode rulesets targeting the branch, on forges that have them.
+	// Their rules apply on top of the protections above.
+	Rulesets []BranchRuleset
+}
+
+// NewPayload builds a payload from the data supplied by provider. Data the provider
+// cannot supply is listed in Payload.Unavailable rather than failing the whole run.
+// Independent data sources are requested concurrently, so providers must be safe for concurrent use.
+func NewPayload(config *config.Config, provider Provider) Payload {
+	rest := &RestData{
+		owner:    config.GetString("owner"),
+		repo:     config.GetString("repo"),
+		token:    config.GetString("token"),
+		Config:   config,
+		provider: provider,
+	}
+	var (
+		wg                  sync.WaitGroup
+		branchProtection    BranchProtection
+		branchProtectionErr error
+		metadata            RepositoryMetadata
+		metadataErr         error
+	)
+	unavailable := make(map[string]string)
+	wg.Go(func() {
+		rest.loadProviderData(unavailable)
+	})
+	wg.Go(func() {
+		branchProtection, branchProtectionErr = provider.BranchProtection()
+	})
+	wg.Go(func() {
+		metadata, metadataErr = provider.RepositoryMetadata()
+	})
+	wg.Wait()
+
+	if errors.Is(branchProtectionErr, ErrRulesetsUnavailable) {
+		unavailable[RulesetsData] = fmt.Sprintf("%s; manual review required", branchProtectionErr.Error())
+	} else if branchProtectionErr != nil {
+		unavailable[BranchProtectionData] = branchProtectionErr.Error()
+	}
+	if metadataErr != nil {
+		unavailable[RepositorySettingsData] = metadataErr.Error()
+	}
+	if metadata == nil {
+		metadata = &unknownRepositoryMetadata{}
+	}
+
+	// the security posture takes the Security Insights file into account, so it is read last
+	securityPosture, err := provider.SecurityPosture(rest.Insights)
+	if err != nil {
+		unavailable[SecurityPostureData] = err.Error()
+		securityPosture = buildInsightsSecurityPosture(*rest)
+	}
+
+	return Payload{
+		RestData:           rest,
+		Config:             config,
+		BranchProtection:   branchProtection,
+		RepositoryMetadata: metadata,
+		SecurityPosture:    securityPosture,
+		Unavailable:        unavailable,
+	}
+}
+
+// loadProviderData concurrently fills the file-backed data, releases and workflow permissions,
+// recording anything the provider could not supply
+func (r *RestData) loadProviderData(unavailable map[string]string) {
+	var (
+		wg                     sync.WaitGroup
+		workflowPermissionsErr error
+		releasesErr            error
+	)
+	wg.Go(func() {
+		r.getRepoContents()
+		r.loadSecurityInsights()
+	})
+	wg.Go(func() {
+		r.WorkflowsEnabled, r.WorkflowPermissions, workflowPermissionsErr = r.provider.WorkflowPermissions()
+	})
+	wg.Go(func() {
+		r.Releases, releasesErr = r.provider.Releases()
+	})
+	wg.Wait()
+
+	if workflowPermissionsErr != nil {
+		r.Config.Logger.Trace(fmt.Sprintf("workflow permissions unavailable: %s", workflowPermissionsErr.Error()))
+		unavailable[WorkflowPermissionsData] = workflowPermissionsErr.Error()
+	}
+	if releasesErr != nil {
+		r.Config.Logger.Trace(fmt.Sprintf("releases unavailable: %s", releasesErr.Error()))
+		unavailable[ReleasesData] = fmt.Sprintf("Failed to list releases: %s; manual review required", releasesErr.Error())
+	}
+}
+
+// getAllPages follows offset pagination on a forge API, requesting pages of pageSize items
+// until one comes back short
+func getAllPages[T any](getJSON func(endpoint string, target any) error, endpoint string, pageSizeParam string, pageSize int) (items []T, err error) {
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+	for page := 1; ; page++ {
+		var pageItems []T
+		if err := getJSON(fmt.Sprintf("%s%s%s=%d&page=%d", endpoint, separator, pageSizeParam, pageSize, page), &pageItems); err != nil {
+			return nil, err
+		}
+		items = append(items, pageItems...)
+		if len(pageItems) < pageSize {
+			return items, nil
+		}
+	}
+}
+
+// matchBranchPattern returns the index of the pattern matching branch, preferring an exact name
+// over a wildcard, or -1 when none match
+func matchBranchPattern(patterns []string, branch string) int {
+	wildcard := -1
+	for i, pattern := range patterns {
+		if pattern == branch {
+			return i
+		}
+		if matched, _ := path.Match(pattern, branch); matched && wildcard == -1 {
+			wildcard = i
+		}
+	}
+	return wildcard
+}
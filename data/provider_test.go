@@ -0,0 +1,113 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/hashicorp/go-hclog"
+	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	releases            []ReleaseData
+	releasesErr         error
+	branchProtection    BranchProtection
+	branchProtectionErr error
+	workflowsErr        error
+	metadataErr         error
+	postureErr          error
+}
+
+func (f *fakeProvider) Contents(path string) (*github.RepositoryContent, []*github.RepositoryContent, error) {
+	if path == "" {
+		return nil, []*github.RepositoryContent{}, nil
+	}
+	return nil, nil, errors.New("not found")
+}
+
+func (f *fakeProvider) Releases() ([]ReleaseData, error) {
+	return f.releases, f.releasesErr
+}
+
+func (f *fakeProvider) WorkflowPermissions() (bool, WorkflowPermissions, error) {
+	return f.workflowsErr == nil, WorkflowPermissions{DefaultPermissions: "read"}, f.workflowsErr
+}
+
+func (f *fakeProvider) BranchProtection() (BranchProtection, error) {
+	return f.branchProtection, f.branchProtectionErr
+}
+
+func (f *fakeProvider) SecurityPosture(_ si.SecurityInsights) (SecurityPosture, error) {
+	return nil, f.postureErr
+}
+
+func (f *fakeProvider) RepositoryMetadata() (RepositoryMetadata, error) {
+	return nil, f.metadataErr
+}
+
+func TestNewPayload(t *testing.T) {
+	tests := []struct {
+		name              string
+		provider          *fakeProvider
+		expectUnavailable []string
+	}{
+		{
+			name: "all data supplied",
+			provider: &fakeProvider{
+				releases:         []ReleaseData{{TagName: "v1.0.0"}},
+				branchProtection: BranchProtection{RestrictsPushes: true},
+			},
+		},
+		{
+			name: "forge settings unavailable",
+			provider: &fakeProvider{
+				branchProtectionErr: errors.New("no branch protection"),
+				workflowsErr:        errors.New("no workflow permissions"),
+				metadataErr:         errors.New("no metadata"),
+				postureErr:          errors.New("no posture"),
+				releasesErr:         errors.New("no releases"),
+			},
+			expectUnavailable: []string{BranchProtectionData, WorkflowPermissionsData, RepositorySettingsData, SecurityPostureData, ReleasesData},
+		},
+		{
+			name: "rulesets unavailable",
+			provider: &fakeProvider{
+				branchProtection:    BranchProtection{RestrictsPushes: true},
+				branchProtectionErr: fmt.Errorf("%w: 502 Bad Gateway", ErrRulesetsUnavailable),
+			},
+			expectUnavailable: []string{RulesetsData},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := NewPayload(&config.Config{Logger: hclog.NewNullLogger()}, tt.provider)
+
+			assert.Len(t, payload.Unavailable, len(tt.expectUnavailable))
+			for _, source := range tt.expectUnavailable {
+				assert.Contains(t, payload.Unavailable, source)
+			}
+			assert.Equal(t, tt.provider.releases, payload.Releases)
+			assert.Equal(t, tt.provider.branchProtection, payload.BranchProtection)
+			assert.NotNil(t, payload.RepositoryMetadata, "missing metadata should fall back to an unknown value")
+		})
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	rest := &RestData{Releases: []ReleaseData{
+		{TagName: "v2.0.0-rc1", Prerelease: true},
+		{TagName: "v2.0.0-draft", Draft: true},
+		{TagName: "v1.0.0"},
+	}}
+	release, found := rest.LatestRelease()
+	assert.True(t, found)
+	assert.Equal(t, "v1.0.0", release.TagName)
+
+	_, found = (&RestData{}).LatestRelease()
+	assert.False(t, found)
+}
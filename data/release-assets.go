@@ -0,0 +1,109 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// releaseAssetFields are the fields a release asset template can use, with the goreleaser names
+// they are also known by
+var releaseAssetFields = map[string]string{
+	"name": "name", "projectname": "name", "version": "version", "tag": "tag", "os": "os", "arch": "arch",
+}
+
+var templateField = regexp.MustCompile(`\{\{\s*\.?([A-Za-z]+)\s*}}`)
+
+// checksumManifest matches the names of release assets that list the digests of the others
+var checksumManifest = regexp.MustCompile(`(?i)(^|[._-])(checksums?|sha(1|256|512)?sums?)([._-][^/]*)?$`)
+
+// IsChecksumManifest reports whether a release asset lists the digests of the assets of its
+// release, such as checksums.txt or SHA256SUMS
+func IsChecksumManifest(name string) bool {
+	return checksumManifest.MatchString(name)
+}
+
+// ReleaseAssetTemplate is a naming scheme for release assets, such as {{name}}_{{version}}_{{os}}_{{arch}},
+// whose fields are filled from the project and release. Any file extension may follow it.
+type ReleaseAssetTemplate struct {
+	Template string
+	// parts alternate between literal text and the field that follows it
+	parts []string
+}
+
+// ParseReleaseAssetTemplate reads a template, failing on fields it doesn't know and on templates
+// without a version or tag field, whose assets wouldn't carry the release identifier
+func ParseReleaseAssetTemplate(template string) (parsed ReleaseAssetTemplate, err error) {
+	parsed.Template = template
+	rest := template
+	for {
+		location := templateField.FindStringSubmatchIndex(rest)
+		if location == nil {
+			parsed.parts = append(parsed.parts, rest)
+			break
+		}
+		field, ok := releaseAssetFields[strings.ToLower(rest[location[2]:location[3]])]
+		if !ok {
+			return parsed, fmt.Errorf("unknown field %s in %q, expected name, version, tag, os or arch", rest[location[0]:location[1]], template)
+		}
+		parsed.parts = append(parsed.parts, rest[:location[0]], field)
+		rest = rest[location[1]:]
+	}
+	for i := 1; i < len(parsed.parts); i += 2 {
+		if parsed.parts[i] == "version" || parsed.parts[i] == "tag" {
+			return parsed, nil
+		}
+	}
+	return parsed, fmt.Errorf("%q has neither a {{version}} nor a {{tag}} field to identify the release", template)
+}
+
+// Matches reports whether an asset of the release with the given tag is named by the template
+func (t ReleaseAssetTemplate) Matches(asset, project, tag string) bool {
+	var pattern strings.Builder
+	pattern.WriteString("(?i)^")
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			pattern.WriteString(regexp.QuoteMeta(part))
+			continue
+		}
+		switch part {
+		case "name":
+			pattern.WriteString(regexp.QuoteMeta(project))
+		case "version":
+			pattern.WriteString(regexp.QuoteMeta(strings.TrimPrefix(tag, "v")))
+		case "tag":
+			pattern.WriteString(regexp.QuoteMeta(tag))
+		case "os":
+			pattern.WriteString(`[a-z0-9]+`)
+		case "arch":
+			pattern.WriteString(`[a-z0-9_]+`)
+		}
+	}
+	pattern.WriteString(`(\..+)?$`)
+	matched, err := regexp.MatchString(pattern.String(), asset)
+	return err == nil && matched
+}
+
+// loadReleaseAssetTemplates reads the comma separated templates in the release-asset-templates var
+func loadReleaseAssetTemplates(config *config.Config) (templates []ReleaseAssetTemplate, err error) {
+	var problems []error
+	for _, template := range strings.Split(config.GetString("release-asset-templates"), ",") {
+		template = strings.TrimSpace(template)
+		if template == "" {
+			continue
+		}
+		parsed, err := ParseReleaseAssetTemplate(template)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		templates = append(templates, parsed)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid release-asset-templates: %w", errors.Join(problems...))
+	}
+	return templates, nil
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseAssetTemplateMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		asset    string
+		want     bool
+	}{
+		{name: "name version os arch", template: "{{name}}_{{version}}_{{os}}_{{arch}}", asset: "tool_1.2.3_linux_amd64.tar.gz", want: true},
+		{name: "goreleaser fields", template: "{{ .ProjectName }}_{{ .Version }}_{{ .Os }}_{{ .Arch }}", asset: "tool_1.2.3_Darwin_x86_64.zip", want: true},
+		{name: "tag", template: "{{name}}-{{tag}}", asset: "tool-v1.2.3", want: true},
+		{name: "other version", template: "{{name}}_{{version}}_{{os}}_{{arch}}", asset: "tool_1.2.4_linux_amd64.tar.gz"},
+		{name: "other project", template: "{{name}}_{{version}}_{{os}}_{{arch}}", asset: "other_1.2.3_linux_amd64.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := ParseReleaseAssetTemplate(tt.template)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, template.Matches(tt.asset, "tool", "v1.2.3"))
+		})
+	}
+}
+
+func TestLoadReleaseAssetTemplates(t *testing.T) {
+	load := func(value string) ([]ReleaseAssetTemplate, error) {
+		return loadReleaseAssetTemplates(&config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{"release-asset-templates": value}})
+	}
+
+	templates, err := load("{{name}}_{{version}}_{{os}}_{{arch}}, {{name}}-{{tag}}.sbom")
+	require.NoError(t, err)
+	require.Len(t, templates, 2)
+	assert.Equal(t, "{{name}}-{{tag}}.sbom", templates[1].Template)
+
+	_, err = load("{{name}}_{{commit}}")
+	assert.ErrorContains(t, err, "unknown field {{commit}}")
+
+	_, err = load("checksums.txt")
+	assert.ErrorContains(t, err, "has neither a {{version}} nor a {{tag}} field")
+
+	_, err = load("{{name}}_{{os}}_{{arch}}")
+	assert.ErrorContains(t, err, "has neither a {{version}} nor a {{tag}} field", "assets named without the release identifier can't be told apart between releases")
+}
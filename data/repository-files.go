@@ -0,0 +1,183 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// phrases found in well known license texts and the SPDX identifier they correspond to
+var licenseHeadings = []struct {
+	phrases []string
+	spdxId  string
+	name    string
+}{
+	{[]string{"Apache License", "Version 2.0"}, "Apache-2.0", "Apache License 2.0"},
+	{[]string{"Mozilla Public License Version 2.0"}, "MPL-2.0", "Mozilla Public License 2.0"},
+	{[]string{"GNU AFFERO GENERAL PUBLIC LICENSE", "Version 3"}, "AGPL-3.0-only", "GNU Affero General Public License v3.0"},
+	{[]string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 3"}, "LGPL-3.0-only", "GNU Lesser General Public License v3.0"},
+	{[]string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}, "GPL-3.0-only", "GNU General Public License v3.0"},
+	{[]string{"GNU GENERAL PUBLIC LICENSE", "Version 2"}, "GPL-2.0-only", "GNU General Public License v2.0"},
+	{[]string{"Permission is hereby granted, free of charge"}, "MIT", "MIT License"},
+	{[]string{"Permission to use, copy, modify, and/or distribute this software"}, "ISC", "ISC License"},
+	{[]string{"This is free and unencumbered software released into the public domain"}, "Unlicense", "The Unlicense"},
+	{[]string{"Redistribution and use in source and binary forms", "Neither the name"}, "BSD-3-Clause", "BSD 3-Clause License"},
+	{[]string{"Redistribution and use in source and binary forms"}, "BSD-2-Clause", "BSD 2-Clause License"},
+}
+
+var licenseFilenames = []string{"license", "license.md", "license.txt", "copying", "copying.md", "copying.txt"}
+
+// describeRepository builds the repository description the GitHub GraphQL API would have returned, for
+// data sources that have no such API. Steps read these fields from Payload.GraphqlRepoData on every forge,
+// so each other data source must fill the repository's name, its default branch and that branch's head
+// commit, whether it has issues enabled, and its license and contributing guidelines, which are found in its files.
+func (r *RestData) describeRepository(name, defaultBranch, headCommit string, hasIssues bool) *GraphqlRepoData {
+	graphql := &GraphqlRepoData{}
+	graphql.Repository.Name = name
+	graphql.Repository.HasIssuesEnabled = hasIssues
+	graphql.Repository.DefaultBranchRef.Name = defaultBranch
+	graphql.Repository.DefaultBranchRef.Target.OID = headCommit
+	r.describeRepositoryFiles(graphql)
+	return graphql
+}
+
+// describeRepositoryFiles fills the license and contributing guidelines of a repository from its files,
+// for data sources that cannot report them the way the GitHub GraphQL API does
+func (r *RestData) describeRepositoryFiles(graphql *GraphqlRepoData) {
+	if licensePath := r.checkLicenseFile(); licensePath != "" {
+		graphql.Repository.LicenseInfo.Url = licensePath
+		graphql.Repository.LicenseInfo.SpdxId, graphql.Repository.LicenseInfo.Name = identifyLicense(r.readFile(licensePath))
+	}
+	if contributingPath := r.checkFile("contributing.md"); contributingPath != "" {
+		graphql.Repository.ContributingGuidelines.Body = r.readFile(contributingPath)
+	}
+}
+
+// readFile returns the decoded contents of a file, or an empty string if it cannot be read
+func (r *RestData) readFile(path string) string {
+	file, err := r.getSourceFile(path)
+	if err != nil || file == nil {
+		return ""
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return ""
+	}
+	return content
+}
+
+// checkLicenseFile returns the path of the first well known license file in the repository root
+func (r *RestData) checkLicenseFile() string {
+	for _, name := range licenseFilenames {
+		if filepath := r.checkFile(name); filepath != "" && !strings.Contains(filepath, "/") {
+			return filepath
+		}
+	}
+	return ""
+}
+
+// identifyLicense returns the SPDX identifier and name of a license text, preferring an explicit SPDX tag
+func identifyLicense(text string) (spdxId string, name string) {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, after, found := strings.Cut(line, "SPDX-License-Identifier:"); found {
+			id := strings.TrimSpace(after)
+			return id, id
+		}
+	}
+	for _, heading := range licenseHeadings {
+		matched := true
+		for _, phrase := range heading.phrases {
+			if !strings.Contains(text, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return heading.spdxId, heading.name
+		}
+	}
+	return "", ""
+}
+
+// vendoredDirectories hold the sources of dependencies rather than the project's own files
+var vendoredDirectories = []string{".git", "node_modules", "vendor", "third_party"}
+
+// FindFiles returns the paths of the files in the default branch that match, leaving out vendored
+// dependencies. The repository is listed once, from the git tree when the GitHub API is available
+// and otherwise by walking its directories.
+func (p *Payload) FindFiles(match func(filePath string) bool) (paths []string, err error) {
+	if !p.treeListed {
+		p.tree, p.treeErr = p.listTree()
+		p.treeListed = true
+	}
+	if p.treeErr != nil {
+		return nil, p.treeErr
+	}
+	for _, filePath := range p.tree {
+		if match(filePath) {
+			paths = append(paths, filePath)
+		}
+	}
+	return paths, nil
+}
+
+func (p *Payload) listTree() (paths []string, err error) {
+	vendored := func(filePath string) bool {
+		return slices.ContainsFunc(strings.Split(filePath, "/"), func(name string) bool { return slices.Contains(vendoredDirectories, name) })
+	}
+	if p.ghClient != nil {
+		ref := p.Repository.DefaultBranchRef.Target.OID
+		if ref == "" {
+			ref = p.Repository.DefaultBranchRef.Name
+		}
+		files, err := fetchRepoTree(context.Background(), p.ghClient, p.owner, p.repo, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the repository tree: %w", err)
+		}
+		for _, file := range files {
+			if !vendored(file.GetPath()) {
+				paths = append(paths, file.GetPath())
+			}
+		}
+		return paths, nil
+	}
+
+	directories := []string{""}
+	for len(directories) > 0 {
+		directory := directories[0]
+		directories = directories[1:]
+		_, entries, err := p.provider.Contents(directory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", path.Join("/", directory), err)
+		}
+		for _, entry := range entries {
+			switch {
+			case vendored(entry.GetName()):
+			case entry.GetType() == "dir":
+				directories = append(directories, entry.GetPath())
+			case entry.GetType() == "file":
+				paths = append(paths, entry.GetPath())
+			}
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// IsDockerfile reports whether a file name is that of a Dockerfile or Containerfile
+func IsDockerfile(name string) bool {
+	name = strings.ToLower(path.Base(name))
+	return name == "dockerfile" || name == "containerfile" || strings.HasPrefix(name, "dockerfile.") ||
+		strings.HasSuffix(name, ".dockerfile") || strings.HasPrefix(name, "containerfile.")
+}
+
+// IsMakefile reports whether a file name is one make reads by default
+func IsMakefile(name string) bool {
+	name = path.Base(name)
+	return name == "Makefile" || name == "makefile" || name == "GNUmakefile"
+}
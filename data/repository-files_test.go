@@ -0,0 +1,86 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifyLicense(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		expectedSpdx string
+	}{
+		{"explicit SPDX identifier", "// SPDX-License-Identifier: Apache-2.0 OR MIT\n", "Apache-2.0 OR MIT"},
+		{"apache text", "                                 Apache License\n                           Version 2.0, January 2004\n", "Apache-2.0"},
+		{"gpl v3 text", "                    GNU GENERAL PUBLIC LICENSE\n                       Version 3, 29 June 2007\n", "GPL-3.0-only"},
+		{"lgpl v3 text", "                   GNU LESSER GENERAL PUBLIC LICENSE\n                       Version 3, 29 June 2007\n", "LGPL-3.0-only"},
+		{"bsd 3 clause text", "Redistribution and use in source and binary forms...\n3. Neither the name of the copyright holder", "BSD-3-Clause"},
+		{"unknown text", "All rights reserved.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spdxId, _ := identifyLicense(tt.text)
+			assert.Equal(t, tt.expectedSpdx, spdxId)
+		})
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"Makefile":                    "all:",
+		"build/Dockerfile":            "FROM scratch",
+		"deploy/api/Containerfile":    "FROM scratch",
+		"docs/building.md":            "# notes",
+		"vendor/lib/Makefile":         "all:",
+		"web/node_modules/Dockerfile": "FROM node",
+	})
+	payload, err := loadLocalPayload(&config.Config{Logger: hclog.NewNullLogger()}, root)
+	require.NoError(t, err)
+	files, err := payload.FindFiles(func(filePath string) bool { return IsDockerfile(filePath) || IsMakefile(filePath) })
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Makefile", "build/Dockerfile", "deploy/api/Containerfile"}, files, "vendored directories are left out")
+}
+
+// TestLoadersDescribeRepository guards the fields of Payload.GraphqlRepoData that steps read on every
+// forge, which data sources other than GitHub have to fill themselves
+func TestLoadersDescribeRepository(t *testing.T) {
+	loaders := map[string]func(t *testing.T) (Payload, error){
+		"gitlab": func(t *testing.T) (Payload, error) {
+			server := newGitlabTestServer(t, `[]`)
+			t.Cleanup(server.Close)
+			return loadGitlabPayload(gitlabTestConfig(server.URL), server.Client())
+		},
+		"gitea": func(t *testing.T) (Payload, error) {
+			server := newGiteaTestServer(`[]`)
+			t.Cleanup(server.Close)
+			return loadGiteaPayload(giteaTestConfig(server.URL), server.Client())
+		},
+		"local": func(t *testing.T) (Payload, error) {
+			root := t.TempDir()
+			writeTestFiles(t, root, map[string]string{
+				"LICENSE":              "MIT License\n\nPermission is hereby granted, free of charge, to any person\n",
+				".git/HEAD":            "ref: refs/heads/main\n",
+				".git/refs/heads/main": "1111111111111111111111111111111111111111\n",
+			})
+			return loadLocalPayload(&config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{}}, root)
+		},
+	}
+
+	for name, load := range loaders {
+		t.Run(name, func(t *testing.T) {
+			payload, err := load(t)
+			require.NoError(t, err)
+			require.NotNil(t, payload.GraphqlRepoData, "steps read the repository description on every forge")
+			assert.NotEmpty(t, payload.Repository.Name)
+			assert.NotEmpty(t, payload.Repository.DefaultBranchRef.Name)
+			assert.NotEmpty(t, payload.Repository.DefaultBranchRef.Target.OID)
+			assert.NotEmpty(t, payload.Repository.LicenseInfo.Url)
+		})
+	}
+}
@@ -15,7 +15,6 @@ type RepositoryMetadata interface {
 
 type GitHubRepositoryMetadata struct {
 	Releases []ReleaseData
-	Rulesets []Ruleset
 	ghRepo   *github.Repository
 	ghOrg    *github.Organization
 }
@@ -42,12 +41,20 @@ func (r *GitHubRepositoryMetadata) IsMFARequiredForAdministrativeActions() *bool
 	return r.ghOrg.TwoFactorRequirementEnabled
 }
 
-func loadRepositoryMetadata(ghClient *github.Client, owner, repo string) (ghRepo *github.Repository, data RepositoryMetadata, err error) {
-	repository, _, err := ghClient.Repositories.Get(context.Background(), owner, repo)
+// unknownRepositoryMetadata is used when a data source cannot report on the repository's settings
+type unknownRepositoryMetadata struct{}
+
+func (u *unknownRepositoryMetadata) IsActive() bool                               { return true }
+func (u *unknownRepositoryMetadata) IsPublic() bool                               { return false }
+func (u *unknownRepositoryMetadata) OrganizationBlogURL() *string                 { return nil }
+func (u *unknownRepositoryMetadata) IsMFARequiredForAdministrativeActions() *bool { return nil }
+
+func loadRepositoryMetadata(ctx context.Context, ghClient *github.Client, owner, repo string) (ghRepo *github.Repository, data RepositoryMetadata, err error) {
+	repository, _, err := ghClient.Repositories.Get(ctx, owner, repo)
 	if err != nil {
 		return repository, &GitHubRepositoryMetadata{}, err
 	}
-	organization, _, err := ghClient.Organizations.Get(context.Background(), owner)
+	organization, _, err := ghClient.Organizations.Get(ctx, owner)
 	if err != nil {
 		return repository, &GitHubRepositoryMetadata{
 			ghRepo: repository,
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"testing"
 
 	"github.com/google/go-github/v74/github"
@@ -81,7 +82,7 @@ func TestLoadRepositoryMetadata(t *testing.T) {
 				testCase.responses...,
 			)
 			ghClient := github.NewClient(mockClient)
-			_, repoMetadata, err := loadRepositoryMetadata(ghClient, testCase.owner, testCase.repo)
+			_, repoMetadata, err := loadRepositoryMetadata(context.Background(), ghClient, testCase.owner, testCase.repo)
 			if testCase.expectedRepoError {
 				assert.Error(t, err)
 			} else {
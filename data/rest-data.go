@@ -3,10 +3,14 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/ast"
@@ -28,10 +32,23 @@ type RestData struct {
 	WorkflowPermissions WorkflowPermissions
 	Insights            si.SecurityInsights
 	Releases            []ReleaseData
-	Rulesets            []Ruleset
+	// WorkflowDirectories lists where CI/CD workflows may be kept, in order of precedence
+	WorkflowDirectories []string
 	contents            RepoContent
 	ghClient            *github.Client
-	HttpClient          HttpClient
+	apiBase             string
+	// authClient, when set, authenticates GitHub API calls in place of token
+	authClient HttpClient
+	provider   Provider
+	HttpClient HttpClient
+	// tree lists every file in the default branch once FindFiles has been called
+	tree       []string
+	treeErr    error
+	treeListed bool
+	// snapshot records what is read while a snapshot is exported
+	snapshot *snapshotRecording
+	// binaryScanErr is why a snapshot being evaluated holds no scan for binaries
+	binaryScanErr error
 }
 
 type RepoContent struct {
@@ -39,21 +56,15 @@ type RepoContent struct {
 	SubContent map[string]RepoContent
 }
 
-type Ruleset struct {
-	Type       string `json:"type"`
-	Parameters struct {
-		RequiredChecks []struct {
-			Context string `json:"context"`
-		} `json:"required_status_checks"`
-	} `json:"parameters"`
-}
-
 type ReleaseData struct {
-	Id      int            `json:"id"`
-	Name    string         `json:"name"`
-	TagName string         `json:"tag_name"`
-	URL     string         `json:"url"`
-	Assets  []ReleaseAsset `json:"assets"`
+	Id          int            `json:"id"`
+	Name        string         `json:"name"`
+	TagName     string         `json:"tag_name"`
+	URL         string         `json:"url"`
+	Description string         `json:"body"`
+	Draft       bool           `json:"draft"`
+	Prerelease  bool           `json:"prerelease"`
+	Assets      []ReleaseAsset `json:"assets"`
 }
 
 type ReleaseAsset struct {
@@ -66,54 +77,92 @@ type WorkflowPermissions struct {
 	CanApprovePullRequest bool   `json:"can_approve_pull_request_reviews"`
 }
 
+// APIBase is the REST API of github.com, used unless base-url points at a GitHub Enterprise instance
 var APIBase = "https://api.github.com"
 
-func (r *RestData) Setup() error {
-	r.owner = r.Config.GetString("owner")
-	r.repo = r.Config.GetString("repo")
-	r.token = r.Config.GetString("token")
-
-	r.getRepoContents()
-	r.loadSecurityInsights()
-	_ = r.getWorkflowPermissions()
-	_ = r.getReleases()
-	return nil
-}
+var defaultWorkflowDirectories = []string{".github/workflows"}
 
 func (r *RestData) MakeApiCall(endpoint string, isGithub bool) (body []byte, err error) {
 	if r.Config != nil && r.Config.Logger != nil {
 		r.Config.Logger.Trace(fmt.Sprintf("GET %s", endpoint))
 	}
+	if isGithub && r.authClient != nil {
+		return makeApiCall(r.authClient, endpoint, "")
+	}
+	if r.HttpClient == nil {
+		r.HttpClient = &http.Client{}
+	}
+	token := ""
+	if isGithub {
+		token = r.token
+	}
+	return makeApiCall(r.HttpClient, endpoint, token)
+}
+
+// makeApiCall performs a GET request, authenticating with token when one is provided
+func makeApiCall(httpClient HttpClient, endpoint string, token string) (body []byte, err error) {
 	request, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
-	if isGithub {
-		request.Header.Set("Authorization", "Bearer "+r.token)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
 	}
-	if r.HttpClient == nil {
-		r.HttpClient = &http.Client{}
+	if httpClient == nil {
+		httpClient = &http.Client{}
 	}
-	response, err := r.HttpClient.Do(request)
+	response, err := httpClient.Do(request)
 	if err != nil {
 		err = fmt.Errorf("error making http call: %s", err.Error())
 		return nil, err
 	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
 	if response.StatusCode != 200 {
-		err = fmt.Errorf("unexpected response: %s", response.Status)
-		return nil, err
+		if response.Header.Get("X-RateLimit-Remaining") == "0" {
+			reset, _ := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64)
+			return nil, &unexpectedResponseError{response.StatusCode, fmt.Sprintf("unexpected response: %s, API rate limit exhausted until %s", response.Status, time.Unix(reset, 0).Format(time.RFC3339))}
+		}
+		return nil, &unexpectedResponseError{response.StatusCode, fmt.Sprintf("unexpected response: %s", response.Status)}
 	}
 	return io.ReadAll(response.Body)
 }
 
-func (r *RestData) getSourceFile(owner, repo, path string) (content *github.RepositoryContent, err error) {
-	content, _, _, err = r.ghClient.Repositories.GetContents(context.Background(), owner, repo, path, nil)
+// unexpectedResponseError is returned by makeApiCall for responses other than 200 OK
+type unexpectedResponseError struct {
+	statusCode int
+	message    string
+}
+
+func (e *unexpectedResponseError) Error() string {
+	return e.message
+}
+
+// isNotFound reports whether err is a 404 Not Found response from makeApiCall
+func isNotFound(err error) bool {
+	var responseErr *unexpectedResponseError
+	return errors.As(err, &responseErr) && responseErr.statusCode == http.StatusNotFound
+}
+
+func (r *RestData) getSourceFile(path string) (content *github.RepositoryContent, err error) {
+	content, _, err = r.provider.Contents(path)
 	if err != nil {
 		return
 	}
 	return content, nil
 }
 
+// TopLevelFiles returns the paths of the files in the root directory of the repository
+func (r *RestData) TopLevelFiles() (paths []string) {
+	for _, entry := range r.contents.Content {
+		if entry.GetType() == "file" {
+			paths = append(paths, entry.GetPath())
+		}
+	}
+	return paths
+}
+
 // checkFile accepts a filename like security-insights.yml or security.md and returns the path to that file
 // if it exists in the root directory or forge directory of the repository or returns "" when the file is not found
 func (r *RestData) checkFile(filename string) (filepath string) {
@@ -153,7 +202,7 @@ func (r *RestData) GetDirectoryContent(path string) (dirContent []*github.Reposi
 			continue
 		}
 
-		content, err := r.getSourceFile(r.owner, r.repo, file.GetPath())
+		content, err := r.getSourceFile(file.GetPath())
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch workflow file %s: %s", file.GetPath(), err.Error())
 		}
@@ -163,8 +212,34 @@ func (r *RestData) GetDirectoryContent(path string) (dirContent []*github.Reposi
 	return dirContent, nil
 }
 
+// GetWorkflowFiles returns the files in the first of the WorkflowDirectories that contains any,
+// mirroring how forges that accept several locations only run workflows from one of them
+func (r *RestData) GetWorkflowFiles() (workflows []*github.RepositoryContent, err error) {
+	dirs := r.WorkflowDirectories
+	if len(dirs) == 0 {
+		dirs = defaultWorkflowDirectories
+	}
+	var firstErr error
+	found := false
+	for _, dir := range dirs {
+		workflows, err = r.GetDirectoryContent(dir)
+		if len(workflows) > 0 {
+			return workflows, nil
+		}
+		if err == nil {
+			found = true
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if !found {
+		return nil, firstErr
+	}
+	return nil, fmt.Errorf("no workflows found in %s directory", strings.Join(dirs, " or "))
+}
+
 func (r *RestData) GetFileContent(path string) (content *github.RepositoryContent, err error) {
-	content, err = r.getSourceFile(r.owner, r.repo, path)
+	content, err = r.getSourceFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve file content for %s: %w", path, err)
 	}
@@ -174,6 +249,44 @@ func (r *RestData) GetFileContent(path string) (content *github.RepositoryConten
 	return content, nil
 }
 
+// ErrRemoteFilesUnavailable is returned when files in other repositories are not to be read
+var ErrRemoteFilesUnavailable = errors.New("files in other repositories are unavailable")
+
+// GetRemoteFileContent returns a file from another GitHub repository at a commit, such as the
+// definition of an action or reusable workflow that a workflow calls. Other repositories are only
+// read when the resolve-remote-calls var is true, as their files are not kept in snapshots.
+func (r *RestData) GetRemoteFileContent(repository, commit, path string) (content string, err error) {
+	if resolve, _ := strconv.ParseBool(r.Config.GetString("resolve-remote-calls")); !resolve {
+		return "", fmt.Errorf("%w: resolve-remote-calls is not enabled", ErrRemoteFilesUnavailable)
+	}
+	if forge := r.Config.GetString("forge"); forge != "" && forge != "github" {
+		return "", fmt.Errorf("%w: they can't be read from %s", ErrRemoteFilesUnavailable, forge)
+	}
+	if r.Config.GetString("snapshot-mode") == snapshotEvaluate {
+		return "", fmt.Errorf("%w: they are not kept in snapshots", ErrRemoteFilesUnavailable)
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/contents/%s?ref=%s", r.githubAPIBase(), repository, escapePath(path), url.QueryEscape(commit))
+	body, err := r.MakeApiCall(endpoint, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from %s@%s: %w", path, repository, commit, err)
+	}
+	var file github.RepositoryContent
+	if err := json.Unmarshal(body, &file); err != nil {
+		return "", fmt.Errorf("failed to parse %s from %s@%s: %w", path, repository, commit, err)
+	}
+	return file.GetContent()
+}
+
+// LatestRelease returns the newest release that is neither a draft nor a prerelease
+func (r *RestData) LatestRelease() (release ReleaseData, found bool) {
+	for _, release := range r.Releases {
+		if !release.Draft && !release.Prerelease {
+			return release, true
+		}
+	}
+	return ReleaseData{}, false
+}
+
 // returns true when a file with case insensitive name matching support.md is found in the root or forge directories or when the readme.md contains a heading named "Support"
 func (r *RestData) HasSupportMarkdown() bool {
 	if r.checkFile("support.md") != "" {
@@ -181,7 +294,7 @@ func (r *RestData) HasSupportMarkdown() bool {
 	}
 	readmePath := r.checkFile("readme.md")
 	if readmePath != "" {
-		contents, err := r.getSourceFile(r.owner, r.repo, readmePath)
+		contents, err := r.getSourceFile(readmePath)
 		if err != nil {
 			r.Config.Logger.Error(fmt.Sprintf("failed to retrieve readme file data: %s", err.Error()))
 			return false
@@ -225,18 +338,29 @@ func parseMarkdownHeadings(content []byte) []string {
 
 func (r *RestData) loadSecurityInsights() {
 	filepath := r.checkFile(si.SecurityInsightsFilename)
-	if filepath != "" {
-		insights, err := si.Read(r.owner, r.repo, filepath)
-		r.Insights = insights
-		if err != nil {
-			r.Config.Logger.Error(fmt.Sprintf("failed to read security insights file: %s", err.Error()))
-		}
+	if filepath == "" {
+		return
+	}
+	file, err := r.getSourceFile(filepath)
+	if err != nil {
+		r.Config.Logger.Error(fmt.Sprintf("failed to read security insights file: %s", err.Error()))
+		return
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		r.Config.Logger.Error(fmt.Sprintf("failed to unpack security insights file: %s", err.Error()))
+		return
+	}
+	insights, err := si.Load([]byte(content))
+	if err != nil {
+		r.Config.Logger.Error(fmt.Sprintf("failed to read security insights file: %s", err.Error()))
 		return
 	}
+	r.Insights = *insights
 }
 
 func (r *RestData) getRepoContents() {
-	_, content, _, err := r.ghClient.Repositories.GetContents(context.Background(), r.owner, r.repo, "", nil)
+	_, content, err := r.provider.Contents("")
 	if err != nil {
 		r.Config.Logger.Error(fmt.Sprintf("failed to retrieve contents top level contents: %s", err.Error()))
 		return
@@ -308,7 +432,7 @@ func (c *RepoContent) GetSubdirContentByPath(r *RestData, path string) (RepoCont
 
 // getSubdirContents fetches contents of a directory
 func (r *RestData) getSubdirContents(path string) (RepoContent, error) {
-	_, content, _, err := r.ghClient.Repositories.GetContents(context.Background(), r.owner, r.repo, path, nil)
+	_, content, err := r.provider.Contents(path)
 	if err != nil {
 		return RepoContent{}, err
 	}
@@ -319,49 +443,11 @@ func (r *RestData) getSubdirContents(path string) (RepoContent, error) {
 	}, nil
 }
 
-func (r *RestData) getReleases() error {
-	endpoint := fmt.Sprintf("%s/repos/%s/%s/releases", APIBase, r.owner, r.repo)
-	responseData, err := r.MakeApiCall(endpoint, true)
-	if err != nil {
-		return err
+func (r *RestData) githubAPIBase() string {
+	if r.apiBase == "" {
+		return APIBase
 	}
-	return json.Unmarshal(responseData, &r.Releases)
-}
-
-func (r *RestData) getWorkflowPermissions() error {
-	endpoint := fmt.Sprintf("%s/repos/%s/%s/actions", APIBase, r.owner, r.repo)
-	responseData, err := r.MakeApiCall(endpoint, true)
-	if err != nil {
-		return err
-	}
-	var actionsData struct {
-		Enabled bool `json:"enabled"`
-	}
-	if err := json.Unmarshal(responseData, &actionsData); err != nil {
-		return fmt.Errorf("failed to parse actions data: %v", err)
-	}
-	r.WorkflowsEnabled = actionsData.Enabled
-
-	endpoint = fmt.Sprintf("%s/repos/%s/%s/actions/permissions/workflow", APIBase, r.owner, r.repo)
-	responseData, err = r.MakeApiCall(endpoint, true)
-	if err != nil {
-		return err
-	}
-	if err := json.Unmarshal(responseData, &r.WorkflowPermissions); err != nil {
-		return fmt.Errorf("failed to parse permissions: %v", err)
-	}
-	return err
-}
-
-func (r *RestData) GetRulesets(branchName string) []Ruleset {
-	endpoint := fmt.Sprintf("%s/repos/%s/%s/rules/branches/%s", APIBase, r.owner, r.repo, branchName)
-	responseData, err := r.MakeApiCall(endpoint, true)
-	if err != nil {
-		r.Config.Logger.Error(fmt.Sprintf("error getting rulesets: %s", err.Error()))
-	}
-
-	_ = json.Unmarshal(responseData, &r.Rulesets)
-	return r.Rulesets
+	return r.apiBase
 }
 
 // IsCodeRepo returns true if the repository contains any programming languages.
@@ -370,7 +456,12 @@ func (r *RestData) GetRulesets(branchName string) []Ruleset {
 // to distinguish between programming, markup, data, and prose content types for more nuanced
 // repository classification.
 func (r *RestData) IsCodeRepo() (bool, error) {
-	languages, _, err := r.ghClient.Repositories.ListLanguages(context.Background(), r.owner, r.repo)
+	return hasLanguages(context.Background(), r.ghClient, r.owner, r.repo)
+}
+
+// hasLanguages reports whether GitHub detected any programming languages in the repository
+func hasLanguages(ctx context.Context, ghClient *github.Client, owner, repo string) (bool, error) {
+	languages, _, err := ghClient.Repositories.ListLanguages(ctx, owner, repo)
 	if err != nil {
 		return false, err
 	}
@@ -1,12 +1,18 @@
 package data
 
 import (
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/google/go-github/v74/github"
+	"github.com/hashicorp/go-hclog"
 	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/privateerproj/privateer-sdk/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCheckFile(t *testing.T) {
@@ -185,3 +191,66 @@ func TestIsCodeRepo(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRemoteFileContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/shared/contents/build/action.yml" || r.URL.Query().Get("ref") != "4d34df0c" {
+			http.NotFound(w, r)
+			return
+		}
+		// "runs:\n  using: composite\n"
+		_, _ = w.Write([]byte(`{"encoding": "base64", "content": "cnVuczoKICB1c2luZzogY29tcG9zaXRlCg=="}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		vars        map[string]interface{}
+		want        string
+		unavailable bool
+	}{
+		{name: "enabled", vars: map[string]interface{}{"resolve-remote-calls": "true"}, want: "runs:\n  using: composite\n"},
+		{name: "not enabled", vars: map[string]interface{}{}, unavailable: true},
+		{name: "evaluating a snapshot", vars: map[string]interface{}{"resolve-remote-calls": "true", "snapshot-mode": "evaluate"}, unavailable: true},
+		{name: "other forge", vars: map[string]interface{}{"resolve-remote-calls": "true", "forge": "gitlab"}, unavailable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RestData{
+				Config:     &config.Config{Logger: hclog.NewNullLogger(), Vars: tt.vars},
+				apiBase:    server.URL,
+				HttpClient: server.Client(),
+			}
+			content, err := r.GetRemoteFileContent("org/shared", "4d34df0c", "build/action.yml")
+			if tt.unavailable {
+				assert.ErrorIs(t, err, ErrRemoteFilesUnavailable)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, content)
+		})
+	}
+}
+
+// closeTracker is a response body that records whether it was closed
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestMakeApiCallClosesBody(t *testing.T) {
+	for _, statusCode := range []int{http.StatusOK, http.StatusNotFound} {
+		body := &closeTracker{Reader: strings.NewReader("{}")}
+		client := &ClientMock{Response: &http.Response{StatusCode: statusCode, Status: http.StatusText(statusCode), Body: body}}
+
+		_, err := makeApiCall(client, "https://api.example.com/resource", "")
+		assert.Equal(t, statusCode == http.StatusNotFound, isNotFound(err))
+		assert.True(t, body.closed, "the body of a %d response is closed", statusCode)
+	}
+}
@@ -0,0 +1,573 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Types of the branch rules that rulesets apply
+const (
+	RuleDeletion             = "deletion"
+	RuleNonFastForward       = "non_fast_forward"
+	RulePullRequest          = "pull_request"
+	RuleRequiredSignatures   = "required_signatures"
+	RuleRequiredStatusChecks = "required_status_checks"
+	RuleUpdate               = "update"
+	RuleMergeQueue           = "merge_queue"
+)
+
+// Enforcement states of a ruleset. Rules in evaluate mode are reported in insights but not enforced.
+const (
+	EnforcementActive   = "active"
+	EnforcementEvaluate = "evaluate"
+	EnforcementDisabled = "disabled"
+)
+
+// Ruleset is a rule that applies to a branch, together with the ruleset it comes from
+type Ruleset struct {
+	Type              string         `json:"type"`
+	RulesetID         int64          `json:"ruleset_id,omitempty"`
+	RulesetSourceType string         `json:"ruleset_source_type,omitempty"`
+	RulesetSource     string         `json:"ruleset_source,omitempty"`
+	Parameters        RuleParameters `json:"parameters"`
+}
+
+// RuleParameters holds the parameters of every rule type; each rule only sets those of its own type
+type RuleParameters struct {
+	// required_status_checks
+	RequiredChecks []struct {
+		Context string `json:"context"`
+	} `json:"required_status_checks"`
+	StrictRequiredStatusChecksPolicy bool `json:"strict_required_status_checks_policy,omitempty"`
+
+	// pull_request
+	RequiredApprovingReviewCount   int      `json:"required_approving_review_count,omitempty"`
+	DismissStaleReviewsOnPush      bool     `json:"dismiss_stale_reviews_on_push,omitempty"`
+	RequireCodeOwnerReview         bool     `json:"require_code_owner_review,omitempty"`
+	RequireLastPushApproval        bool     `json:"require_last_push_approval,omitempty"`
+	RequiredReviewThreadResolution bool     `json:"required_review_thread_resolution,omitempty"`
+	AllowedMergeMethods            []string `json:"allowed_merge_methods,omitempty"`
+
+	// update
+	UpdateAllowsFetchAndMerge bool `json:"update_allows_fetch_and_merge,omitempty"`
+
+	// merge_queue
+	MergeMethod                  string `json:"merge_method,omitempty"`
+	GroupingStrategy             string `json:"grouping_strategy,omitempty"`
+	MinEntriesToMerge            int    `json:"min_entries_to_merge,omitempty"`
+	MaxEntriesToMerge            int    `json:"max_entries_to_merge,omitempty"`
+	MaxEntriesToBuild            int    `json:"max_entries_to_build,omitempty"`
+	CheckResponseTimeoutMinutes  int    `json:"check_response_timeout_minutes,omitempty"`
+	MinEntriesToMergeWaitMinutes int    `json:"min_entries_to_merge_wait_minutes,omitempty"`
+}
+
+// Bypass modes of a bypass actor
+const (
+	// BypassModeAlways lets the actor push past the rules, as well as merge pull requests that don't meet them
+	BypassModeAlways = "always"
+	// BypassModePullRequest only lets the actor merge pull requests that don't meet the rules
+	BypassModePullRequest = "pull_request"
+	// BypassModeExempt stops the rules applying to the actor at all, without a bypass being recorded
+	BypassModeExempt = "exempt"
+)
+
+// builtInRepositoryRoles names the repository roles GitHub defines, by the IDs rulesets use for them
+var builtInRepositoryRoles = map[int64]string{2: "maintain", 4: "write", 5: "admin"}
+
+// RulesetPolicy describes how a ruleset is enforced and who may bypass it
+type RulesetPolicy struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Target      string `json:"target,omitempty"`
+	SourceType  string `json:"source_type,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Enforcement string `json:"enforcement"`
+	// BypassActors is only reported to credentials that can administer the ruleset
+	BypassActors []BypassActor `json:"bypass_actors,omitempty"`
+	// BypassActorsHidden is set when BypassActors wasn't reported, so who may bypass the ruleset isn't known
+	BypassActorsHidden bool `json:"bypass_actors_hidden,omitempty"`
+	// CurrentUserCanBypass is "always", "pull_requests_only", "exempt" or "never" for the credentials in use
+	CurrentUserCanBypass string `json:"current_user_can_bypass,omitempty"`
+}
+
+// BypassActor may bypass the rules of a ruleset, either always or only when merging pull requests.
+// Actors are a Team, Integration (a GitHub App), RepositoryRole, DeployKey or OrganizationAdmin,
+// or a User that a branch protection rule allows past it.
+type BypassActor struct {
+	ActorID    int64  `json:"actor_id,omitempty"`
+	ActorType  string `json:"actor_type"`
+	BypassMode string `json:"bypass_mode"`
+	// Name is the team, app or role the actor ID refers to, when it could be looked up
+	Name string `json:"name,omitempty"`
+}
+
+func (a BypassActor) String() string {
+	name := a.Name
+	if name == "" {
+		name = a.ActorType
+		if a.ActorID != 0 {
+			name = fmt.Sprintf("%s %d", a.ActorType, a.ActorID)
+		}
+	}
+	return fmt.Sprintf("%s (%s)", name, a.BypassMode)
+}
+
+// BypassesDirectly reports whether the actor may bypass the rules outside of a pull request,
+// such as by pushing to or deleting the branch
+func (a BypassActor) BypassesDirectly() bool {
+	return a.BypassMode == BypassModeAlways || a.BypassMode == BypassModeExempt
+}
+
+// CurrentUserBypassesDirectly reports whether the credentials in use may bypass the ruleset outside
+// of a pull request, which is also reported when the bypass actors are hidden from them
+func (r RulesetPolicy) CurrentUserBypassesDirectly() bool {
+	return r.CurrentUserCanBypass == BypassModeAlways || r.CurrentUserCanBypass == BypassModeExempt
+}
+
+// BranchRuleset is an active or evaluate mode ruleset targeting a branch, with the rules it applies there
+type BranchRuleset struct {
+	RulesetPolicy
+	Rules []Ruleset `json:"rules"`
+}
+
+// rulesetDetails is a ruleset as returned by the rulesets API
+type rulesetDetails struct {
+	RulesetPolicy
+	Conditions struct {
+		RefName struct {
+			Include []string `json:"include"`
+			Exclude []string `json:"exclude"`
+		} `json:"ref_name"`
+		// organization rulesets select repositories by name, by ID or by custom property
+		RepositoryName *struct {
+			Include []string `json:"include"`
+			Exclude []string `json:"exclude"`
+		} `json:"repository_name"`
+		RepositoryID *struct {
+			RepositoryIDs []int64 `json:"repository_ids"`
+		} `json:"repository_id"`
+		RepositoryProperty *struct {
+			Include []rulesetPropertyCondition `json:"include"`
+			Exclude []rulesetPropertyCondition `json:"exclude"`
+		} `json:"repository_property"`
+	} `json:"conditions"`
+	Rules []Ruleset `json:"rules"`
+}
+
+// rulesetPropertyCondition selects the repositories whose custom property has one of the values
+type rulesetPropertyCondition struct {
+	Name           string   `json:"name"`
+	PropertyValues []string `json:"property_values"`
+}
+
+// matches reports whether the repository with properties has one of the condition's values
+func (c rulesetPropertyCondition) matches(properties map[string][]string) bool {
+	return slices.ContainsFunc(properties[c.Name], func(value string) bool {
+		return slices.ContainsFunc(c.PropertyValues, func(wanted string) bool { return strings.EqualFold(wanted, value) })
+	})
+}
+
+// appliesToBranches reports whether the ruleset is enforced or evaluated on branches
+func (r RulesetPolicy) appliesToBranches() bool {
+	return (r.Target == "" || r.Target == "branch") && r.Enforcement != EnforcementDisabled
+}
+
+// targetsDefaultBranch reports whether the ruleset's ref name conditions cover the default branch
+func (r *rulesetDetails) targetsDefaultBranch(branch string) bool {
+	refNames := func(patterns []string) (names []string) {
+		for _, pattern := range patterns {
+			if pattern == "~DEFAULT_BRANCH" {
+				pattern = "~ALL"
+			}
+			names = append(names, strings.TrimPrefix(pattern, "refs/heads/"))
+		}
+		return names
+	}
+	return matchesRulesetPatterns(refNames(r.Conditions.RefName.Include), branch) &&
+		!matchesRulesetPatterns(refNames(r.Conditions.RefName.Exclude), branch)
+}
+
+// targetsRepository reports whether an organization ruleset's repository conditions select the repository,
+// which has the custom property values in properties. A ruleset selecting by custom property applies when
+// every included property and none of the excluded ones match.
+func (r *rulesetDetails) targetsRepository(name string, id int64, properties map[string][]string) bool {
+	switch {
+	case r.Conditions.RepositoryName != nil:
+		name = strings.ToLower(name)
+		var include, exclude []string
+		for _, pattern := range r.Conditions.RepositoryName.Include {
+			include = append(include, strings.ToLower(pattern))
+		}
+		for _, pattern := range r.Conditions.RepositoryName.Exclude {
+			exclude = append(exclude, strings.ToLower(pattern))
+		}
+		return matchesRulesetPatterns(include, name) && !matchesRulesetPatterns(exclude, name)
+	case r.Conditions.RepositoryID != nil:
+		return slices.Contains(r.Conditions.RepositoryID.RepositoryIDs, id)
+	case r.Conditions.RepositoryProperty != nil:
+		matches := func(condition rulesetPropertyCondition) bool { return condition.matches(properties) }
+		include, exclude := r.Conditions.RepositoryProperty.Include, r.Conditions.RepositoryProperty.Exclude
+		return len(include) > 0 && !slices.ContainsFunc(include, func(condition rulesetPropertyCondition) bool { return !matches(condition) }) &&
+			!slices.ContainsFunc(exclude, matches)
+	default:
+		return false
+	}
+}
+
+// matchesRulesetPatterns reports whether name matches one of the fnmatch patterns of a ruleset
+// condition, where ~ALL matches every name
+func matchesRulesetPatterns(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.EqualFold(pattern, "~ALL") {
+			return true
+		}
+		if glob := globPattern(pattern); glob != nil && glob.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe names the ruleset and its enforcement, with who may bypass it
+func (r BranchRuleset) Describe() string {
+	description := fmt.Sprintf("%q", r.Name)
+	if r.Enforcement != EnforcementActive {
+		description += fmt.Sprintf(" (%s mode)", r.Enforcement)
+	}
+	if len(r.BypassActors) > 0 {
+		description += fmt.Sprintf(" (bypassable by %s)", DescribeBypassActors(r.BypassActors))
+	} else if r.BypassActorsHidden {
+		description += " (bypass actors unreadable)"
+	}
+	return description
+}
+
+// RulesetsWith returns the rulesets with the given enforcement that apply a rule of any of the given types
+func (b BranchProtection) RulesetsWith(enforcement string, ruleTypes ...string) (rulesets []BranchRuleset) {
+	for _, ruleset := range b.Rulesets {
+		if ruleset.Enforcement != enforcement {
+			continue
+		}
+		for _, rule := range ruleset.Rules {
+			if slices.Contains(ruleTypes, rule.Type) {
+				rulesets = append(rulesets, ruleset)
+				break
+			}
+		}
+	}
+	return rulesets
+}
+
+// EnforcedRules returns the rules of the given type from active rulesets
+func (b BranchProtection) EnforcedRules(ruleType string) (rules []Ruleset) {
+	for _, ruleset := range b.Rulesets {
+		if ruleset.Enforcement != EnforcementActive {
+			continue
+		}
+		for _, rule := range ruleset.Rules {
+			if rule.Type == ruleType {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
+// DirectBypassActors returns the actors that may bypass every one of rulesets outside of a pull
+// request, and so push to or delete the branch regardless of them. Each actor is returned as it
+// appears in the first ruleset.
+func DirectBypassActors(rulesets []BranchRuleset) (actors []BypassActor) {
+	return commonBypassActors(rulesets, BypassActor.BypassesDirectly)
+}
+
+// PushBypassActors returns the actors that may push directly to the branch past both the branch
+// protection rule, when it restricts pushes or requires reviews, and every one of rulesets
+func (b BranchProtection) PushBypassActors(rulesets []BranchRuleset) (actors []BypassActor) {
+	if b.RestrictsPushes || b.RequiresApprovingReviews {
+		rulesets = append([]BranchRuleset{{RulesetPolicy: RulesetPolicy{BypassActors: b.BypassActors}}}, rulesets...)
+	}
+	return DirectBypassActors(rulesets)
+}
+
+// MergeBypassActors returns the actors that may bypass every one of rulesets in any mode, and so
+// merge pull requests that don't meet them. Each actor is returned as it appears in the first ruleset.
+func MergeBypassActors(rulesets []BranchRuleset) (actors []BypassActor) {
+	return commonBypassActors(rulesets, func(BypassActor) bool { return true })
+}
+
+// commonBypassActors returns the actors that bypass every one of rulesets with a mode counted by bypasses
+func commonBypassActors(rulesets []BranchRuleset, bypasses func(BypassActor) bool) (actors []BypassActor) {
+	for i, ruleset := range rulesets {
+		var bypassing []BypassActor
+		for _, actor := range ruleset.BypassActors {
+			if !bypasses(actor) {
+				continue
+			}
+			if i == 0 {
+				bypassing = append(bypassing, actor)
+			} else if j := slices.IndexFunc(actors, func(other BypassActor) bool {
+				return other.ActorType == actor.ActorType && other.ActorID == actor.ActorID
+			}); j >= 0 {
+				bypassing = append(bypassing, actors[j])
+			}
+		}
+		actors = bypassing
+	}
+	return actors
+}
+
+// CurrentUserBypassesDirectly reports whether the credentials in use may bypass every one of
+// rulesets outside of a pull request
+func CurrentUserBypassesDirectly(rulesets []BranchRuleset) bool {
+	for _, ruleset := range rulesets {
+		if !ruleset.CurrentUserBypassesDirectly() {
+			return false
+		}
+	}
+	return len(rulesets) > 0
+}
+
+// HiddenBypassActors reports whether who may bypass any of rulesets couldn't be read
+func HiddenBypassActors(rulesets []BranchRuleset) bool {
+	return slices.ContainsFunc(rulesets, func(ruleset BranchRuleset) bool { return ruleset.BypassActorsHidden })
+}
+
+// DescribeBypassActors lists bypass actors for an assessment message
+func DescribeBypassActors(actors []BypassActor) string {
+	var descriptions []string
+	for _, actor := range actors {
+		descriptions = append(descriptions, actor.String())
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// DescribeRulesets lists the descriptions of rulesets for an assessment message
+func DescribeRulesets(rulesets []BranchRuleset) string {
+	var descriptions []string
+	for _, ruleset := range rulesets {
+		descriptions = append(descriptions, ruleset.Describe())
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// defaultBranchRulesets loads the active and evaluate mode rulesets targeting the default branch,
+// from the repository and its organization. Rules of active rulesets come from the rules API, which
+// resolves every condition GitHub applies; rulesets in evaluate mode aren't reported there, so their
+// ref name conditions are matched here.
+func (g *githubProvider) defaultBranchRulesets(branch string) (rulesets []BranchRuleset, err error) {
+	repoEndpoint := fmt.Sprintf("%s/repos/%s/%s", g.apiBase, g.owner, g.repo)
+	activeRules, err := getAllPages[Ruleset](g.getJSON, fmt.Sprintf("%s/rules/branches/%s", repoEndpoint, url.PathEscape(branch)), "per_page", 100)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the rules for %s: %w", branch, err)
+	}
+	summaries, err := getAllPages[RulesetPolicy](g.getJSON, repoEndpoint+"/rulesets?includes_parents=true", "per_page", 100)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rulesets: %w", err)
+	}
+	listed := make(map[int64]bool)
+	for _, summary := range summaries {
+		listed[summary.ID] = true
+	}
+
+	candidates, err := g.organizationRulesets(listed)
+	if err != nil {
+		return nil, err
+	}
+	for _, summary := range summaries {
+		if !summary.appliesToBranches() || slices.ContainsFunc(candidates, func(c rulesetDetails) bool { return c.ID == summary.ID }) {
+			continue
+		}
+		var details rulesetDetails
+		if err := g.getJSON(fmt.Sprintf("%s/rulesets/%d?includes_parents=true", repoEndpoint, summary.ID), &details); err != nil {
+			return nil, fmt.Errorf("failed to read ruleset %q: %w", summary.Name, err)
+		}
+		candidates = append(candidates, details)
+	}
+
+	for _, details := range candidates {
+		ruleset := BranchRuleset{RulesetPolicy: details.RulesetPolicy}
+		// the API leaves bypass_actors out, rather than empty, for credentials that can't administer the ruleset
+		ruleset.BypassActorsHidden = details.BypassActors == nil
+		if details.Enforcement == EnforcementActive {
+			for _, rule := range activeRules {
+				if rule.RulesetID == details.ID {
+					ruleset.Rules = append(ruleset.Rules, rule)
+				}
+			}
+		} else if details.targetsDefaultBranch(branch) {
+			ruleset.Rules = details.Rules
+		}
+		if len(ruleset.Rules) > 0 {
+			rulesets = append(rulesets, ruleset)
+		}
+	}
+	g.nameBypassActors(rulesets)
+	return rulesets, nil
+}
+
+// organizationRulesets loads the organization's branch rulesets that apply to the repository, either
+// because the repository's own listing includes them or because their conditions select it. Only
+// organization admins can read them there, which also shows their bypass actors; otherwise organization
+// rulesets are read through the repository. A listed ruleset that can't be read, or rulesets that select
+// repositories by custom property when the repository's properties can't be read, are returned as an error.
+func (g *githubProvider) organizationRulesets(listed map[int64]bool) (rulesets []rulesetDetails, err error) {
+	if g.repository.GetOwner().GetType() != "Organization" {
+		return nil, nil
+	}
+	orgEndpoint := fmt.Sprintf("%s/orgs/%s/rulesets", g.apiBase, g.owner)
+	summaries, err := getAllPages[RulesetPolicy](g.getJSON, orgEndpoint, "per_page", 100)
+	if err != nil {
+		g.debug(fmt.Sprintf("Organization rulesets are unavailable, reading them through the repository: %v", err))
+		return nil, nil
+	}
+	var properties map[string][]string
+	for _, summary := range summaries {
+		if !summary.appliesToBranches() {
+			continue
+		}
+		var details rulesetDetails
+		if err := g.getJSON(fmt.Sprintf("%s/%d", orgEndpoint, summary.ID), &details); err != nil {
+			return nil, fmt.Errorf("failed to read organization ruleset %q: %w", summary.Name, err)
+		}
+		if !listed[details.ID] && details.Conditions.RepositoryProperty != nil && properties == nil {
+			if properties, err = g.repositoryProperties(); err != nil {
+				return nil, fmt.Errorf("failed to read the custom properties organization ruleset %q selects repositories by: %w", details.Name, err)
+			}
+		}
+		if listed[details.ID] || details.targetsRepository(g.repo, g.repository.GetID(), properties) {
+			rulesets = append(rulesets, details)
+		}
+	}
+	return rulesets, nil
+}
+
+// repositoryProperties reads the values of the repository's custom properties, which hold either
+// a single value or a list of them
+func (g *githubProvider) repositoryProperties() (properties map[string][]string, err error) {
+	var values []struct {
+		PropertyName string          `json:"property_name"`
+		Value        json.RawMessage `json:"value"`
+	}
+	if err := g.getJSON(fmt.Sprintf("%s/repos/%s/%s/properties/values", g.apiBase, g.owner, g.repo), &values); err != nil {
+		return nil, err
+	}
+	properties = make(map[string][]string)
+	for _, property := range values {
+		// properties without a value are reported as null
+		if string(property.Value) == "null" {
+			continue
+		}
+		var single string
+		if err := json.Unmarshal(property.Value, &single); err == nil {
+			properties[property.PropertyName] = []string{single}
+			continue
+		}
+		var multiple []string
+		if err := json.Unmarshal(property.Value, &multiple); err != nil {
+			return nil, fmt.Errorf("unexpected value of custom property %q: %w", property.PropertyName, err)
+		}
+		properties[property.PropertyName] = multiple
+	}
+	return properties, nil
+}
+
+// nameBypassActors looks up the teams, apps and roles that bypass actors refer to. Lookups that
+// the credentials can't make leave the actor described by its type and ID.
+func (g *githubProvider) nameBypassActors(rulesets []BranchRuleset) {
+	var teams, apps, roles map[int64]string
+	for i := range rulesets {
+		for j := range rulesets[i].BypassActors {
+			actor := &rulesets[i].BypassActors[j]
+			switch actor.ActorType {
+			case "OrganizationAdmin":
+				actor.Name = "organization admins"
+			case "DeployKey":
+				actor.Name = "deploy keys"
+			case "Team":
+				if teams == nil {
+					teams = g.lookupNames("/orgs/%s/teams", func(endpoint string) (names map[int64]string, err error) {
+						response, err := getAllPages[struct {
+							ID   int64  `json:"id"`
+							Slug string `json:"slug"`
+						}](g.getJSON, endpoint, "per_page", 100)
+						names = make(map[int64]string)
+						for _, team := range response {
+							names[team.ID] = fmt.Sprintf("team %s/%s", g.owner, team.Slug)
+						}
+						return names, err
+					})
+				}
+				actor.Name = teams[actor.ActorID]
+			case "Integration":
+				if apps == nil {
+					apps = g.lookupNames("/orgs/%s/installations?per_page=100", func(endpoint string) (names map[int64]string, err error) {
+						var response struct {
+							Installations []struct {
+								AppID   int64  `json:"app_id"`
+								AppSlug string `json:"app_slug"`
+							} `json:"installations"`
+						}
+						err = g.getJSON(endpoint, &response)
+						names = make(map[int64]string)
+						for _, installation := range response.Installations {
+							names[installation.AppID] = "app " + installation.AppSlug
+						}
+						return names, err
+					})
+				}
+				actor.Name = apps[actor.ActorID]
+			case "RepositoryRole":
+				if role, ok := builtInRepositoryRoles[actor.ActorID]; ok {
+					actor.Name = role + " role"
+					continue
+				}
+				if roles == nil {
+					roles = g.lookupNames("/orgs/%s/custom-repository-roles", func(endpoint string) (names map[int64]string, err error) {
+						var response struct {
+							CustomRoles []struct {
+								ID   int64  `json:"id"`
+								Name string `json:"name"`
+							} `json:"custom_roles"`
+						}
+						err = g.getJSON(endpoint, &response)
+						names = make(map[int64]string)
+						for _, role := range response.CustomRoles {
+							names[role.ID] = role.Name + " role"
+						}
+						return names, err
+					})
+				}
+				actor.Name = roles[actor.ActorID]
+			}
+		}
+	}
+}
+
+// lookupNames reads the names of an organization's teams, apps or roles by ID, returning an empty
+// map when the organization can't be read
+func (g *githubProvider) lookupNames(endpoint string, load func(string) (map[int64]string, error)) map[int64]string {
+	endpoint = fmt.Sprintf(endpoint, url.PathEscape(g.owner))
+	names, err := load(g.apiBase + endpoint)
+	if err == nil {
+		return names
+	}
+	g.debug(fmt.Sprintf("Unable to name bypass actors from %s: %v", endpoint, err))
+	return map[int64]string{}
+}
+
+func (g *githubProvider) debug(message string) {
+	if g.config != nil && g.config.Logger != nil {
+		g.config.Logger.Debug(message)
+	}
+}
+
+func (g *githubProvider) getJSON(endpoint string, target any) error {
+	responseData, err := g.get(endpoint)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(responseData, target)
+}
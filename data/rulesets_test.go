@@ -0,0 +1,423 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultBranchRulesets(t *testing.T) {
+	responses := map[string]string{
+		"/repos/owner/repo/rules/branches/main": `[
+			{"type": "deletion", "ruleset_id": 1, "ruleset_source_type": "Organization", "ruleset_source": "owner"},
+			{"type": "pull_request", "ruleset_id": 1, "parameters": {"required_approving_review_count": 2, "require_last_push_approval": true}},
+			{"type": "required_signatures", "ruleset_id": 4}
+		]`,
+		"/repos/owner/repo/rulesets": `[
+			{"id": 1, "name": "org baseline", "target": "branch", "enforcement": "active"},
+			{"id": 2, "name": "trial", "target": "branch", "enforcement": "evaluate"},
+			{"id": 3, "name": "old", "target": "branch", "enforcement": "disabled"},
+			{"id": 5, "name": "releases", "target": "branch", "enforcement": "evaluate"},
+			{"id": 6, "name": "tags", "target": "tag", "enforcement": "active"}
+		]`,
+		"/repos/owner/repo/rulesets/1": `{
+			"id": 1, "name": "org baseline", "target": "branch", "enforcement": "active",
+			"bypass_actors": [{"actor_id": 7, "actor_type": "Team", "bypass_mode": "always"}]
+		}`,
+		"/repos/owner/repo/rulesets/2": `{
+			"id": 2, "name": "trial", "target": "branch", "enforcement": "evaluate",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"], "exclude": []}},
+			"rules": [{"type": "merge_queue"}]
+		}`,
+		"/repos/owner/repo/rulesets/5": `{
+			"id": 5, "name": "releases", "target": "branch", "enforcement": "evaluate",
+			"conditions": {"ref_name": {"include": ["refs/heads/release/*"], "exclude": []}},
+			"rules": [{"type": "deletion"}]
+		}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	provider := &githubProvider{apiBase: server.URL, owner: "owner", repo: "repo", httpClient: server.Client()}
+	rulesets, err := provider.defaultBranchRulesets("main")
+	require.NoError(t, err)
+	require.Len(t, rulesets, 2, "disabled, tag, unmatched and ruleless rulesets are left out")
+
+	assert.Equal(t, "org baseline", rulesets[0].Name)
+	assert.Equal(t, []BypassActor{{ActorID: 7, ActorType: "Team", BypassMode: "always"}}, rulesets[0].BypassActors)
+	require.Len(t, rulesets[0].Rules, 2)
+	assert.Equal(t, 2, rulesets[0].Rules[1].Parameters.RequiredApprovingReviewCount)
+	assert.Equal(t, `"org baseline" (bypassable by Team 7 (always))`, rulesets[0].Describe())
+	assert.False(t, rulesets[0].BypassActorsHidden)
+
+	assert.Equal(t, EnforcementEvaluate, rulesets[1].Enforcement)
+	assert.Equal(t, []Ruleset{{Type: RuleMergeQueue}}, rulesets[1].Rules)
+
+	protection := BranchProtection{Rulesets: rulesets}
+	assert.Len(t, protection.EnforcedRules(RulePullRequest), 1)
+	assert.Empty(t, protection.RulesetsWith(EnforcementActive, RuleMergeQueue))
+	assert.Len(t, protection.RulesetsWith(EnforcementEvaluate, RuleMergeQueue, RuleDeletion), 1)
+}
+
+func TestOrganizationRulesets(t *testing.T) {
+	responses := map[string]string{
+		"/repos/owner/repo/rules/branches/main": `[
+			{"type": "pull_request", "ruleset_id": 1, "ruleset_source_type": "Organization", "ruleset_source": "owner"}
+		]`,
+		"/repos/owner/repo/rulesets": `[{"id": 1, "name": "org baseline", "source_type": "Organization", "enforcement": "active"}]`,
+		"/orgs/owner/rulesets": `[
+			{"id": 1, "name": "org baseline", "target": "branch", "enforcement": "active"},
+			{"id": 8, "name": "services", "target": "branch", "enforcement": "evaluate"},
+			{"id": 9, "name": "other services", "target": "branch", "enforcement": "evaluate"},
+			{"id": 10, "name": "by property", "target": "branch", "enforcement": "evaluate"},
+			{"id": 11, "name": "internal services", "target": "branch", "enforcement": "evaluate"}
+		]`,
+		"/orgs/owner/rulesets/1": `{
+			"id": 1, "name": "org baseline", "target": "branch", "source_type": "Organization", "enforcement": "active",
+			"conditions": {"repository_property": {"include": [], "exclude": []}},
+			"bypass_actors": [
+				{"actor_id": 7, "actor_type": "Team", "bypass_mode": "always"},
+				{"actor_id": 12, "actor_type": "Integration", "bypass_mode": "pull_request"},
+				{"actor_id": 5, "actor_type": "RepositoryRole", "bypass_mode": "always"},
+				{"actor_id": 30, "actor_type": "RepositoryRole", "bypass_mode": "exempt"},
+				{"actor_id": 31, "actor_type": "RepositoryRole", "bypass_mode": "always"},
+				{"actor_type": "DeployKey", "bypass_mode": "always"}
+			]
+		}`,
+		"/orgs/owner/rulesets/8": `{
+			"id": 8, "name": "services", "target": "branch", "enforcement": "evaluate",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"]}, "repository_name": {"include": ["Re*"], "exclude": ["legacy-*"]}},
+			"rules": [{"type": "deletion"}]
+		}`,
+		"/orgs/owner/rulesets/9": `{
+			"id": 9, "name": "other services", "target": "branch", "enforcement": "evaluate",
+			"conditions": {"ref_name": {"include": ["~ALL"]}, "repository_name": {"include": ["other-*"]}},
+			"rules": [{"type": "deletion"}]
+		}`,
+		"/orgs/owner/rulesets/10": `{
+			"id": 10, "name": "by property", "target": "branch", "enforcement": "evaluate",
+			"conditions": {"ref_name": {"include": ["~ALL"]}, "repository_property": {"include": [{"name": "tier", "property_values": ["critical"]}]}},
+			"rules": [{"type": "deletion"}]
+		}`,
+		"/orgs/owner/rulesets/11": `{
+			"id": 11, "name": "internal services", "target": "branch", "enforcement": "evaluate",
+			"conditions": {"ref_name": {"include": ["~ALL"]}, "repository_property": {"include": [{"name": "tier", "property_values": ["Internal"]}], "exclude": [{"name": "lang", "property_values": ["cobol"]}]}},
+			"rules": [{"type": "deletion"}]
+		}`,
+		"/repos/owner/repo/properties/values": `[{"property_name": "tier", "value": "internal"}, {"property_name": "lang", "value": ["go", "rust"]}, {"property_name": "owner", "value": null}]`,
+		"/orgs/owner/teams":                   `[{"id": 7, "slug": "release"}]`,
+		"/orgs/owner/installations":           `{"installations": [{"app_id": 12, "app_slug": "merge-bot"}]}`,
+		"/orgs/owner/custom-repository-roles": `{"custom_roles": [{"id": 30, "name": "releaser"}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	provider := &githubProvider{
+		apiBase:    server.URL,
+		owner:      "owner",
+		repo:       "repo",
+		httpClient: server.Client(),
+		repository: &github.Repository{ID: github.Ptr(int64(42)), Owner: &github.User{Type: github.Ptr("Organization")}},
+	}
+	rulesets, err := provider.defaultBranchRulesets("main")
+	require.NoError(t, err)
+	require.Len(t, rulesets, 3)
+
+	assert.Equal(t, "org baseline", rulesets[0].Name)
+	assert.Equal(t, `"org baseline" (bypassable by team owner/release (always), app merge-bot (pull_request), `+
+		`admin role (always), releaser role (exempt), RepositoryRole 31 (always), deploy keys (always))`, rulesets[0].Describe())
+	assert.Equal(t, "services", rulesets[1].Name, "repositories are matched by name without regard to case")
+	assert.Equal(t, "internal services", rulesets[2].Name, "repositories are matched by custom property")
+
+	bypassing := DirectBypassActors(rulesets[:1])
+	assert.Equal(t, "team owner/release (always), admin role (always), releaser role (exempt), RepositoryRole 31 (always), deploy keys (always)",
+		DescribeBypassActors(bypassing))
+	assert.Empty(t, DirectBypassActors(rulesets), "no actor bypasses both rulesets")
+	assert.Equal(t, "team owner/release (always), app merge-bot (pull_request), admin role (always), releaser role (exempt), RepositoryRole 31 (always), deploy keys (always)",
+		DescribeBypassActors(MergeBypassActors(rulesets[:1])), "actors bypassing in pull requests can merge past the rules")
+}
+
+func TestOrganizationRulesetsUnreadable(t *testing.T) {
+	responses := map[string]string{
+		"/repos/owner/repo/rules/branches/main": `[{"type": "deletion", "ruleset_id": 1}]`,
+		"/repos/owner/repo/rulesets":            `[{"id": 1, "name": "org baseline", "source_type": "Organization", "enforcement": "active"}]`,
+		"/repos/owner/repo/rulesets/1":          `{"id": 1, "name": "org baseline", "source_type": "Organization", "enforcement": "active"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"message": "Must have admin rights"}`, http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	provider := &githubProvider{
+		apiBase:    server.URL,
+		owner:      "owner",
+		repo:       "repo",
+		httpClient: server.Client(),
+		repository: &github.Repository{Owner: &github.User{Type: github.Ptr("Organization")}},
+	}
+	rulesets, err := provider.defaultBranchRulesets("main")
+	require.NoError(t, err)
+	require.Len(t, rulesets, 1, "organization rulesets are read through the repository")
+	assert.Empty(t, rulesets[0].BypassActors)
+	assert.True(t, rulesets[0].BypassActorsHidden, "bypass actors are left out for credentials that can't administer the ruleset")
+	assert.Equal(t, `"org baseline" (bypass actors unreadable)`, rulesets[0].Describe())
+}
+
+func TestRulesetsPaginated(t *testing.T) {
+	var summaries []map[string]any
+	for id := 1; id <= 101; id++ {
+		summaries = append(summaries, map[string]any{"id": id, "name": fmt.Sprintf("ruleset %d", id), "target": "branch", "enforcement": "active"})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		switch r.URL.Path {
+		case "/repos/owner/repo/rules/branches/main":
+			if page == 2 {
+				_, _ = w.Write([]byte(`[{"type": "deletion", "ruleset_id": 101}]`))
+				return
+			}
+			rules := make([]map[string]any, 100)
+			for i := range rules {
+				rules[i] = map[string]any{"type": "required_signatures", "ruleset_id": 1}
+			}
+			_ = json.NewEncoder(w).Encode(rules)
+		case "/repos/owner/repo/rulesets":
+			_ = json.NewEncoder(w).Encode(summaries[min(len(summaries), (page-1)*100):min(len(summaries), page*100)])
+		default:
+			var id int
+			_, _ = fmt.Sscanf(r.URL.Path, "/repos/owner/repo/rulesets/%d", &id)
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "name": fmt.Sprintf("ruleset %d", id), "target": "branch", "enforcement": "active"})
+		}
+	}))
+	defer server.Close()
+
+	provider := &githubProvider{apiBase: server.URL, owner: "owner", repo: "repo", httpClient: server.Client()}
+	rulesets, err := provider.defaultBranchRulesets("main")
+	require.NoError(t, err)
+	require.Len(t, rulesets, 2)
+	assert.Len(t, rulesets[0].Rules, 100)
+	assert.Equal(t, "ruleset 101", rulesets[1].Name, "rulesets and rules past the first page are read")
+}
+
+func TestRulesetPropertiesUnreadable(t *testing.T) {
+	responses := map[string]string{
+		"/repos/owner/repo/rules/branches/main": `[]`,
+		"/repos/owner/repo/rulesets":            `[]`,
+		"/orgs/owner/rulesets":                  `[{"id": 10, "name": "by property", "target": "branch", "enforcement": "evaluate"}]`,
+		"/orgs/owner/rulesets/10": `{
+			"id": 10, "name": "by property", "target": "branch", "enforcement": "evaluate",
+			"conditions": {"ref_name": {"include": ["~ALL"]}, "repository_property": {"include": [{"name": "tier", "property_values": ["critical"]}]}},
+			"rules": [{"type": "deletion"}]
+		}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"message": "Resource not accessible"}`, http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	provider := &githubProvider{
+		apiBase:    server.URL,
+		owner:      "owner",
+		repo:       "repo",
+		httpClient: server.Client(),
+		repository: &github.Repository{Owner: &github.User{Type: github.Ptr("Organization")}},
+	}
+	_, err := provider.defaultBranchRulesets("main")
+	assert.ErrorContains(t, err, `failed to read the custom properties organization ruleset "by property" selects repositories by`,
+		"rulesets that may apply can't be left out")
+}
+
+func TestOrganizationRulesetDetailsUnreadable(t *testing.T) {
+	responses := map[string]string{
+		"/repos/owner/repo/rules/branches/main": `[]`,
+		"/repos/owner/repo/rulesets":            `[]`,
+		"/orgs/owner/rulesets":                  `[{"id": 10, "name": "org baseline", "target": "branch", "enforcement": "active"}]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"message": "Server Error"}`, http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	provider := &githubProvider{
+		apiBase:    server.URL,
+		owner:      "owner",
+		repo:       "repo",
+		httpClient: server.Client(),
+		repository: &github.Repository{Owner: &github.User{Type: github.Ptr("Organization")}},
+	}
+	_, err := provider.defaultBranchRulesets("main")
+	assert.ErrorContains(t, err, `failed to read organization ruleset "org baseline"`, "rulesets that may apply can't be left out")
+}
+
+func TestBypassActorTeamsPaginated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		var teams []map[string]any
+		for id := (page-1)*100 + 1; id <= min(101, page*100); id++ {
+			teams = append(teams, map[string]any{"id": id, "slug": fmt.Sprintf("team-%d", id)})
+		}
+		_ = json.NewEncoder(w).Encode(teams)
+	}))
+	defer server.Close()
+
+	provider := &githubProvider{apiBase: server.URL, owner: "owner", repo: "repo", httpClient: server.Client()}
+	rulesets := []BranchRuleset{{RulesetPolicy: RulesetPolicy{
+		BypassActors: []BypassActor{{ActorID: 101, ActorType: "Team", BypassMode: BypassModeAlways}},
+	}}}
+	provider.nameBypassActors(rulesets)
+	assert.Equal(t, "team owner/team-101", rulesets[0].BypassActors[0].Name, "teams past the first page are named")
+}
+
+func TestTargetsRepository(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions string
+		want       bool
+	}{
+		{name: "all repositories", conditions: `{"repository_name": {"include": ["~ALL"], "exclude": []}}`, want: true},
+		{name: "name pattern", conditions: `{"repository_name": {"include": ["api-*"]}}`, want: true},
+		{name: "excluded by name", conditions: `{"repository_name": {"include": ["~ALL"], "exclude": ["api-gateway"]}}`},
+		{name: "repository ID", conditions: `{"repository_id": {"repository_ids": [1, 42]}}`, want: true},
+		{name: "other repository ID", conditions: `{"repository_id": {"repository_ids": [1]}}`},
+		{name: "no custom property included", conditions: `{"repository_property": {"include": []}}`},
+		{name: "custom property", conditions: `{"repository_property": {"include": [{"name": "tier", "property_values": ["critical", "internal"]}]}}`, want: true},
+		{name: "one of a list of values", conditions: `{"repository_property": {"include": [{"name": "lang", "property_values": ["rust"]}]}}`, want: true},
+		{name: "other custom property value", conditions: `{"repository_property": {"include": [{"name": "tier", "property_values": ["critical"]}]}}`},
+		{name: "every included property must match", conditions: `{"repository_property": {"include": [{"name": "tier", "property_values": ["internal"]}, {"name": "team", "property_values": ["core"]}]}}`},
+		{name: "excluded by custom property", conditions: `{"repository_property": {"include": [{"name": "tier", "property_values": ["internal"]}], "exclude": [{"name": "lang", "property_values": ["go"]}]}}`},
+	}
+	properties := map[string][]string{"tier": {"internal"}, "lang": {"go", "rust"}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var details rulesetDetails
+			require.NoError(t, json.Unmarshal([]byte(`{"conditions": `+tt.conditions+`}`), &details))
+			assert.Equal(t, tt.want, details.targetsRepository("api-gateway", 42, properties))
+		})
+	}
+}
+
+func TestTargetsDefaultBranch(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    bool
+	}{
+		{name: "default branch", include: []string{"~DEFAULT_BRANCH"}, want: true},
+		{name: "all branches", include: []string{"~ALL"}, want: true},
+		{name: "matching pattern", include: []string{"refs/heads/ma*"}, want: true},
+		{name: "other branch", include: []string{"refs/heads/develop"}},
+		{name: "excluded", include: []string{"~ALL"}, exclude: []string{"refs/heads/main"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var details rulesetDetails
+			details.Conditions.RefName.Include = tt.include
+			details.Conditions.RefName.Exclude = tt.exclude
+			assert.Equal(t, tt.want, details.targetsDefaultBranch("main"))
+		})
+	}
+}
+
+func TestBranchProtectionWithoutRulesets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Server Error"}`, http.StatusBadGateway)
+	}))
+	defer server.Close()
+	graphql := &GraphqlRepoData{}
+	graphql.Repository.DefaultBranchRef.Name = "main"
+	graphql.Repository.DefaultBranchRef.BranchProtectionRule.RestrictsPushes = true
+
+	provider := &githubProvider{apiBase: server.URL, owner: "owner", repo: "repo", httpClient: server.Client(), graphql: graphql}
+	protection, err := provider.BranchProtection()
+	assert.ErrorIs(t, err, ErrRulesetsUnavailable)
+	assert.True(t, protection.RestrictsPushes, "the classic protection is kept when the rulesets can't be read")
+	assert.Empty(t, protection.Rulesets)
+}
+
+func TestClassicBypassActors(t *testing.T) {
+	var pushers, pullRequestBypassers branchProtectionAllowances
+	pushers.Nodes = make([]branchProtectionAllowance, 2)
+	pushers.Nodes[0].Actor.Team.DatabaseID = 7
+	pushers.Nodes[0].Actor.Team.CombinedSlug = "owner/release"
+	pushers.Nodes[1].Actor.App.DatabaseID = 12
+	pushers.Nodes[1].Actor.App.Slug = "merge-bot"
+	pullRequestBypassers.Nodes = pushers.Nodes[:1]
+
+	tests := []struct {
+		name            string
+		restrictsPushes bool
+		requiresReviews bool
+		adminEnforced   bool
+		want            string
+	}{
+		{name: "no protection", adminEnforced: false, want: ""},
+		{name: "pushes restricted", restrictsPushes: true, adminEnforced: true, want: "team owner/release (always), app merge-bot (always)"},
+		{name: "reviews required", requiresReviews: true, adminEnforced: true, want: "team owner/release (always)"},
+		{name: "both", restrictsPushes: true, requiresReviews: true, adminEnforced: true, want: "team owner/release (always)"},
+		{name: "admins not enforced", requiresReviews: true, want: "admin role (always), team owner/release (always)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actors := classicBypassActors(tt.restrictsPushes, tt.requiresReviews, tt.adminEnforced, pushers, pullRequestBypassers)
+			assert.Equal(t, tt.want, DescribeBypassActors(actors))
+		})
+	}
+}
+
+func TestPushBypassActors(t *testing.T) {
+	protection := BranchProtection{
+		RequiresApprovingReviews: true,
+		BypassActors: []BypassActor{
+			{ActorID: 5, ActorType: "RepositoryRole", BypassMode: BypassModeAlways, Name: "admin role"},
+			{ActorID: 7, ActorType: "Team", BypassMode: BypassModeAlways, Name: "team owner/release"},
+		},
+	}
+	assert.Equal(t, "admin role (always), team owner/release (always)", DescribeBypassActors(protection.PushBypassActors(nil)))
+
+	rulesets := []BranchRuleset{{RulesetPolicy: RulesetPolicy{
+		BypassActors: []BypassActor{{ActorID: 7, ActorType: "Team", BypassMode: BypassModePullRequest}},
+	}}}
+	assert.Empty(t, protection.PushBypassActors(rulesets), "actors only bypassing the ruleset in pull requests can't push directly")
+
+	protection.RequiresApprovingReviews = false
+	assert.Empty(t, protection.PushBypassActors(nil), "the allowances of a rule that doesn't stop direct commits don't count")
+}
@@ -37,6 +37,17 @@ func buildSecurityPosture(repository *github.Repository, rd RestData) (SecurityP
 	}, nil
 }
 
+// buildInsightsSecurityPosture derives the security posture from Security Insights claims alone,
+// for data sources that cannot read the forge's security settings
+func buildInsightsSecurityPosture(rd RestData) SecurityPosture {
+	insightsClaimsSecretsTooling := insightsClaimsSecretsTooling(rd.Insights)
+	return &RepoSecurityPosture{
+		restData:              rd,
+		preventsSecretPushing: insightsClaimsSecretsTooling,
+		scansForSecrets:       insightsClaimsSecretsTooling,
+	}
+}
+
 func insightsClaimsSecretsTooling(insights si.SecurityInsights) bool {
 	if insights.Repository.Security.Tools == nil {
 		return false
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/google/go-github/v74/github"
@@ -71,6 +72,13 @@ func TestBuildSecurityPosture_SecretScanningDisabledButInsightsTooling(t *testin
 	assert.True(t, sp.ScansForSecrets())
 }
 
+func TestGithubProviderSecurityPosture_MetadataUnavailable(t *testing.T) {
+	provider := &githubProvider{metadataErr: errors.New("502 Bad Gateway")}
+	sp, err := provider.SecurityPosture(si.SecurityInsights{})
+	assert.EqualError(t, err, "502 Bad Gateway")
+	assert.Nil(t, sp)
+}
+
 func TestInsightsClaimsSecretsTooling(t *testing.T) {
 	insights := si.SecurityInsights{
 		Repository: si.Repository{
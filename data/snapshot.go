@@ -0,0 +1,405 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/google/go-github/v74/github"
+	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
+)
+
+// SnapshotVersion is the format of snapshots written by this version of the plugin.
+// It is increased whenever a change to the format would stop older snapshots loading correctly,
+// or older snapshots miss data the evaluation steps now read.
+const SnapshotVersion = 6
+
+// SPDXLicenseListURL is where the list of SPDX licenses, with their OSI and FSF approvals, is downloaded from
+const SPDXLicenseListURL = "https://raw.githubusercontent.com/spdx/license-list-data/main/json/licenses.json"
+
+const (
+	snapshotExport   = "export"
+	snapshotEvaluate = "evaluate"
+)
+
+// Snapshot is everything an evaluation reads about a repository. A run writes it to the file in the
+// snapshot var when snapshot-mode is export, and evaluates from that file alone when it is evaluate,
+// so old data can be re-scored and reviewers can see exactly what the plugin saw.
+type Snapshot struct {
+	Version                  int                         `json:"version"`
+	Owner                    string                      `json:"owner"`
+	Repo                     string                      `json:"repo"`
+	APIBase                  string                      `json:"api_base,omitempty"`
+	GraphqlRepoData          *GraphqlRepoData            `json:"graphql_repo_data"`
+	Contents                 RepoContent                 `json:"contents"`
+	Files                    map[string]SnapshotContent  `json:"files"`
+	Responses                map[string]SnapshotResponse `json:"responses"`
+	Insights                 si.SecurityInsights         `json:"insights"`
+	Releases                 []ReleaseData               `json:"releases"`
+	WorkflowsEnabled         bool                        `json:"workflows_enabled"`
+	WorkflowPermissions      WorkflowPermissions         `json:"workflow_permissions"`
+	WorkflowDirectories      []string                    `json:"workflow_directories"`
+	BranchProtection         BranchProtection            `json:"branch_protection"`
+	SuspectedBinaries        []SuspectedBinary           `json:"suspected_binaries"`
+	RepositoryMetadata       SnapshotRepositoryMetadata  `json:"repository_metadata"`
+	SecurityPosture          SnapshotSecurityPosture     `json:"security_posture"`
+	DependencyManifestsCount int                         `json:"dependency_manifests_count"`
+	IsCodeRepo               bool                        `json:"is_code_repo"`
+	Unavailable              map[string]string           `json:"unavailable"`
+	// Tree lists the files of the default branch, or TreeError says why they couldn't be listed
+	Tree      []string `json:"tree"`
+	TreeError string   `json:"tree_error,omitempty"`
+	// BinaryScanError says why SuspectedBinaries is missing, when the tree couldn't be or wasn't scanned
+	BinaryScanError string `json:"binary_scan_error,omitempty"`
+}
+
+// SnapshotContent is the file or directory listing found at a path, or the error reading it
+type SnapshotContent struct {
+	File      *github.RepositoryContent   `json:"file,omitempty"`
+	Directory []*github.RepositoryContent `json:"directory,omitempty"`
+	Error     string                      `json:"error,omitempty"`
+}
+
+// SnapshotResponse is the response to an API call or download made outside of the Provider
+type SnapshotResponse struct {
+	StatusCode int    `json:"status_code"`
+	Body       string `json:"body"`
+}
+
+// SnapshotRepositoryMetadata is the RepositoryMetadata as it was reported when the snapshot was taken
+type SnapshotRepositoryMetadata struct {
+	Active              bool    `json:"active"`
+	Public              bool    `json:"public"`
+	OrganizationBlog    *string `json:"organization_blog_url"`
+	MFARequiredForAdmin *bool   `json:"mfa_required_for_administrative_actions"`
+}
+
+func (m *SnapshotRepositoryMetadata) IsActive() bool               { return m.Active }
+func (m *SnapshotRepositoryMetadata) IsPublic() bool               { return m.Public }
+func (m *SnapshotRepositoryMetadata) OrganizationBlogURL() *string { return m.OrganizationBlog }
+func (m *SnapshotRepositoryMetadata) IsMFARequiredForAdministrativeActions() *bool {
+	return m.MFARequiredForAdmin
+}
+
+// SnapshotSecurityPosture is the SecurityPosture as it was reported when the snapshot was taken
+type SnapshotSecurityPosture struct {
+	PreventsSecretPushing    bool `json:"prevents_pushing_secrets"`
+	SecretScanning           bool `json:"scans_for_secrets"`
+	PolicyForHandlingSecrets bool `json:"defines_policy_for_handling_secrets"`
+}
+
+func (p *SnapshotSecurityPosture) PreventsPushingSecrets() bool { return p.PreventsSecretPushing }
+func (p *SnapshotSecurityPosture) ScansForSecrets() bool        { return p.SecretScanning }
+func (p *SnapshotSecurityPosture) DefinesPolicyForHandlingSecrets() bool {
+	return p.PolicyForHandlingSecrets
+}
+
+// snapshotProvider serves repository contents from a snapshot. While exporting, it reads through
+// to the provider the payload was loaded from and keeps what it reads.
+type snapshotProvider struct {
+	base  Provider
+	mu    sync.Mutex
+	files map[string]SnapshotContent
+}
+
+func (s *snapshotProvider) Contents(path string) (file *github.RepositoryContent, dir []*github.RepositoryContent, err error) {
+	s.mu.Lock()
+	content, ok := s.files[path]
+	s.mu.Unlock()
+	if !ok {
+		if s.base == nil {
+			return nil, nil, fmt.Errorf("%s is not in the snapshot", path)
+		}
+		file, dir, err = s.base.Contents(path)
+		content = SnapshotContent{File: file, Directory: dir}
+		if err != nil {
+			content.Error = err.Error()
+		}
+		s.mu.Lock()
+		s.files[path] = content
+		s.mu.Unlock()
+	}
+	if content.Error != "" {
+		return content.File, content.Directory, errors.New(content.Error)
+	}
+	return content.File, content.Directory, nil
+}
+
+func (s *snapshotProvider) Releases() ([]ReleaseData, error) {
+	return nil, errors.New("releases are read from the snapshot")
+}
+
+func (s *snapshotProvider) WorkflowPermissions() (bool, WorkflowPermissions, error) {
+	return false, WorkflowPermissions{}, errors.New("workflow permissions are read from the snapshot")
+}
+
+func (s *snapshotProvider) BranchProtection() (BranchProtection, error) {
+	return BranchProtection{}, errors.New("branch protection is read from the snapshot")
+}
+
+func (s *snapshotProvider) SecurityPosture(si.SecurityInsights) (SecurityPosture, error) {
+	return nil, errors.New("the security posture is read from the snapshot")
+}
+
+func (s *snapshotProvider) RepositoryMetadata() (RepositoryMetadata, error) {
+	return nil, errors.New("repository metadata is read from the snapshot")
+}
+
+// snapshotClient serves API calls and downloads from a snapshot, reading through to base while exporting
+type snapshotClient struct {
+	base      HttpClient
+	responses *snapshotResponses
+}
+
+// snapshotResponses is shared by the clients that make GitHub API calls and other downloads
+type snapshotResponses struct {
+	mu    sync.Mutex
+	byURL map[string]SnapshotResponse
+}
+
+func (c *snapshotClient) Do(request *http.Request) (*http.Response, error) {
+	url := request.URL.String()
+	c.responses.mu.Lock()
+	recorded, ok := c.responses.byURL[url]
+	c.responses.mu.Unlock()
+	if !ok {
+		if c.base == nil {
+			return nil, fmt.Errorf("%s is not in the snapshot", url)
+		}
+		response, err := c.base.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded = SnapshotResponse{StatusCode: response.StatusCode, Body: string(body)}
+		c.responses.mu.Lock()
+		c.responses.byURL[url] = recorded
+		c.responses.mu.Unlock()
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode: recorded.StatusCode,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		Request:    request,
+	}, nil
+}
+
+// snapshotRecording records what a run reads while exporting a snapshot. Contents and API calls are kept
+// as the evaluation steps make them, so the snapshot holds exactly what the run read, and it is written
+// once the evaluation has finished.
+type snapshotRecording struct {
+	file      *os.File
+	payload   Payload
+	provider  *snapshotProvider
+	responses *snapshotResponses
+
+	mu sync.Mutex
+	// binariesScanned is set once the tree has been scanned for binaries, with the result in
+	// suspectedBinaries or the error in binaryScanErr
+	binariesScanned   bool
+	suspectedBinaries []SuspectedBinary
+	binaryScanErr     error
+}
+
+// exportingSnapshots are the snapshots exported in this run, which are written once the evaluation has finished
+var exportingSnapshots struct {
+	sync.Mutex
+	exports []*snapshotRecording
+}
+
+// exportSnapshot starts recording what is read through payload into a snapshot at path. The payload
+// reads through to its data sources as before, and WriteSnapshots writes what was read.
+func exportSnapshot(payload *Payload, path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	provider := &snapshotProvider{base: payload.provider, files: make(map[string]SnapshotContent)}
+	payload.provider = provider
+	responses := &snapshotResponses{byURL: make(map[string]SnapshotResponse)}
+	if payload.authClient != nil {
+		payload.authClient = &snapshotClient{base: payload.authClient, responses: responses}
+	}
+	if payload.HttpClient == nil {
+		payload.HttpClient = &http.Client{}
+	}
+	payload.HttpClient = &snapshotClient{base: payload.HttpClient, responses: responses}
+
+	export := &snapshotRecording{file: file, payload: *payload, provider: provider, responses: responses}
+	if payload.ghClient == nil {
+		// data sources without API access scan their tree while loading
+		export.binariesScanned = true
+		export.suspectedBinaries = payload.SuspectedBinaries
+	}
+	payload.snapshot = export
+	exportingSnapshots.Lock()
+	defer exportingSnapshots.Unlock()
+	exportingSnapshots.exports = append(exportingSnapshots.exports, export)
+	return nil
+}
+
+// recordBinaryScan keeps the result of scanning the tree for binaries
+func (e *snapshotRecording) recordBinaryScan(suspectedBinaries []SuspectedBinary, err error) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.binariesScanned, e.suspectedBinaries, e.binaryScanErr = true, suspectedBinaries, err
+}
+
+// WriteSnapshots writes the snapshots exported in this run, with everything the evaluation read.
+// It is called after the evaluation has finished.
+func WriteSnapshots() error {
+	exportingSnapshots.Lock()
+	defer exportingSnapshots.Unlock()
+	var errs []error
+	for _, export := range exportingSnapshots.exports {
+		errs = append(errs, export.write())
+	}
+	exportingSnapshots.exports = nil
+	return errors.Join(errs...)
+}
+
+func (e *snapshotRecording) write() error {
+	payload := e.payload
+	e.mu.Lock()
+	e.provider.mu.Lock()
+	e.responses.mu.Lock()
+	snapshot := Snapshot{
+		Version:                  SnapshotVersion,
+		Owner:                    payload.owner,
+		Repo:                     payload.repo,
+		APIBase:                  payload.apiBase,
+		GraphqlRepoData:          payload.GraphqlRepoData,
+		Contents:                 payload.contents,
+		Files:                    e.provider.files,
+		Responses:                e.responses.byURL,
+		Insights:                 payload.Insights,
+		Releases:                 payload.Releases,
+		WorkflowsEnabled:         payload.WorkflowsEnabled,
+		WorkflowPermissions:      payload.WorkflowPermissions,
+		WorkflowDirectories:      payload.WorkflowDirectories,
+		BranchProtection:         payload.BranchProtection,
+		SuspectedBinaries:        e.suspectedBinaries,
+		Tree:                     payload.tree,
+		DependencyManifestsCount: payload.DependencyManifestsCount,
+		IsCodeRepo:               payload.IsCodeRepo,
+		Unavailable:              payload.Unavailable,
+		RepositoryMetadata: SnapshotRepositoryMetadata{
+			Active:              payload.RepositoryMetadata.IsActive(),
+			Public:              payload.RepositoryMetadata.IsPublic(),
+			OrganizationBlog:    payload.RepositoryMetadata.OrganizationBlogURL(),
+			MFARequiredForAdmin: payload.RepositoryMetadata.IsMFARequiredForAdministrativeActions(),
+		},
+		SecurityPosture: SnapshotSecurityPosture{
+			PreventsSecretPushing:    payload.SecurityPosture.PreventsPushingSecrets(),
+			SecretScanning:           payload.SecurityPosture.ScansForSecrets(),
+			PolicyForHandlingSecrets: payload.SecurityPosture.DefinesPolicyForHandlingSecrets(),
+		},
+	}
+	// data the run never read is marked as such, rather than evaluated as empty
+	switch {
+	case !payload.treeListed:
+		snapshot.TreeError = "the file tree was not listed when the snapshot was exported"
+	case payload.treeErr != nil:
+		snapshot.TreeError = payload.treeErr.Error()
+	}
+	switch {
+	case !e.binariesScanned:
+		snapshot.BinaryScanError = "the tree was not scanned for binaries when the snapshot was exported"
+	case e.binaryScanErr != nil:
+		snapshot.BinaryScanError = e.binaryScanErr.Error()
+	}
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	e.responses.mu.Unlock()
+	e.provider.mu.Unlock()
+	e.mu.Unlock()
+	if err != nil {
+		_ = e.file.Close()
+		return err
+	}
+	if _, err := e.file.Write(append(content, '\n')); err != nil {
+		_ = e.file.Close()
+		return fmt.Errorf("failed to write snapshot %s: %w", e.file.Name(), err)
+	}
+	if err := e.file.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %w", e.file.Name(), err)
+	}
+	return nil
+}
+
+// loadSnapshotPayload builds the payload from a snapshot, without reaching the repository's forge
+func loadSnapshotPayload(config *config.Config, path string) (Payload, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Payload{}, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return Payload{}, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return Payload{}, fmt.Errorf("snapshot version %d is not supported, expected version %d", snapshot.Version, SnapshotVersion)
+	}
+	if snapshot.Files == nil {
+		snapshot.Files = make(map[string]SnapshotContent)
+	}
+	if snapshot.Responses == nil {
+		snapshot.Responses = make(map[string]SnapshotResponse)
+	}
+	if snapshot.Unavailable == nil {
+		snapshot.Unavailable = make(map[string]string)
+	}
+	if snapshot.GraphqlRepoData == nil {
+		snapshot.GraphqlRepoData = &GraphqlRepoData{}
+	}
+	var treeErr, binaryScanErr error
+	if snapshot.TreeError != "" {
+		treeErr = errors.New(snapshot.TreeError)
+	}
+	if snapshot.BinaryScanError != "" {
+		binaryScanErr = errors.New(snapshot.BinaryScanError)
+	}
+
+	return Payload{
+		GraphqlRepoData: snapshot.GraphqlRepoData,
+		RestData: &RestData{
+			owner:               snapshot.Owner,
+			repo:                snapshot.Repo,
+			Config:              config,
+			WorkflowsEnabled:    snapshot.WorkflowsEnabled,
+			WorkflowPermissions: snapshot.WorkflowPermissions,
+			Insights:            snapshot.Insights,
+			Releases:            snapshot.Releases,
+			WorkflowDirectories: snapshot.WorkflowDirectories,
+			contents:            snapshot.Contents,
+			apiBase:             snapshot.APIBase,
+			provider:            &snapshotProvider{files: snapshot.Files},
+			HttpClient:          &snapshotClient{responses: &snapshotResponses{byURL: snapshot.Responses}},
+			tree:                snapshot.Tree,
+			treeErr:             treeErr,
+			treeListed:          true,
+			binaryScanErr:       binaryScanErr,
+		},
+		Config:                   config,
+		BranchProtection:         snapshot.BranchProtection,
+		SuspectedBinaries:        snapshot.SuspectedBinaries,
+		RepositoryMetadata:       &snapshot.RepositoryMetadata,
+		DependencyManifestsCount: snapshot.DependencyManifestsCount,
+		IsCodeRepo:               snapshot.IsCodeRepo,
+		SecurityPosture:          &snapshot.SecurityPosture,
+		Unavailable:              snapshot.Unavailable,
+	}, nil
+}
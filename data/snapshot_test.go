@@ -0,0 +1,145 @@
+package data
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	server := githubStandIn(false, false)
+	defer server.Close()
+	cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{
+		"owner": "owner", "repo": "repo", "token": "token", "base-url": server.URL,
+	}}
+	loaded, err := loadGithubPayload(cfg, nil)
+	require.NoError(t, err)
+	loaded.HttpClient = licenseListStandIn{base: &http.Client{}}
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, exportSnapshot(&loaded, path))
+	// the snapshot keeps whatever the evaluation reads while it runs, whichever step reads it
+	exportedWorkflows, err := loaded.GetWorkflowFiles()
+	require.NoError(t, err)
+	for _, filePath := range []string{".github/actions/setup/action.yml", ".github/actions/cache/action.yml", ".github/actions/cache/action.yaml", ".github/workflows/release.yml", "README.md"} {
+		_, _ = loaded.GetFileContent(filePath)
+	}
+	_, err = loaded.FindFiles(IsDockerfile)
+	require.NoError(t, err)
+	_, err = loaded.GetFileContent("build/Dockerfile")
+	require.NoError(t, err)
+	_, err = loaded.MakeApiCall(server.URL+"/downloads/v1.0.0/checksums.txt", false)
+	require.NoError(t, err)
+	_, err = loaded.MakeApiCall(SPDXLicenseListURL, false)
+	require.NoError(t, err)
+	_, err = loaded.GetSuspectedBinaries()
+	require.NoError(t, err)
+	require.NoError(t, WriteSnapshots())
+
+	// evaluating from the snapshot never reaches GitHub
+	server.Close()
+	restored, err := loadSnapshotPayload(cfg, path)
+	require.NoError(t, err)
+
+	assert.Equal(t, loaded.GraphqlRepoData, restored.GraphqlRepoData)
+	assert.Equal(t, loaded.Unavailable, restored.Unavailable)
+	assert.Equal(t, loaded.IsCodeRepo, restored.IsCodeRepo)
+	assert.Equal(t, loaded.DependencyManifestsCount, restored.DependencyManifestsCount)
+	assert.Equal(t, loaded.RepositoryMetadata.IsPublic(), restored.RepositoryMetadata.IsPublic())
+	assert.Equal(t, loaded.SecurityPosture.ScansForSecrets(), restored.SecurityPosture.ScansForSecrets())
+	binaries, err := restored.GetSuspectedBinaries()
+	require.NoError(t, err)
+	assert.Equal(t, []SuspectedBinary{
+		{Path: "bin/tool.exe", Type: "ELF executable", SHA256: "ced1af6d51438341a0335cc00e1c2867fb718a537c1173cf210070a6b1cdf40a"},
+		{Path: "bin/huge.dat", Type: "gzip archive", Unread: "40 MiB is over the 32 MiB read limit"},
+	}, binaries, "blobs over the read limit are identified from their start without being downloaded")
+
+	workflows, err := restored.GetWorkflowFiles()
+	require.NoError(t, err)
+	require.Len(t, workflows, 1)
+	assert.Equal(t, exportedWorkflows, workflows)
+	content, err := workflows[0].GetContent()
+	require.NoError(t, err)
+	assert.Equal(t, standInWorkflow, content)
+	action, err := restored.GetFileContent(".github/actions/setup/action.yml")
+	require.NoError(t, err, "files read by the steps are kept")
+	content, err = action.GetContent()
+	require.NoError(t, err)
+	assert.Equal(t, standInAction, content)
+	_, err = restored.GetFileContent(".github/actions/cache/action.yaml")
+	require.NoError(t, err)
+	_, err = restored.GetFileContent(".github/actions/cache/action.yml")
+	assert.Error(t, err, "files missing from the repository stay missing")
+	assert.NotContains(t, err.Error(), "not in the snapshot")
+	_, err = restored.GetFileContent(".github/workflows/release.yml")
+	require.NoError(t, err)
+
+	buildFiles, err := restored.FindFiles(IsDockerfile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"build/Dockerfile"}, buildFiles)
+	_, err = restored.GetFileContent("build/Dockerfile")
+	require.NoError(t, err)
+
+	manifest, err := restored.MakeApiCall(server.URL+"/downloads/v1.0.0/checksums.txt", false)
+	require.NoError(t, err, "the checksum manifests of releases are kept")
+	assert.Contains(t, string(manifest), "  tool")
+
+	licenseList, err := restored.MakeApiCall(SPDXLicenseListURL, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"licenses": [{"licenseId": "MIT"}]}`, string(licenseList))
+	_, err = restored.GetFileContent("CONTRIBUTING.md")
+	assert.ErrorContains(t, err, "not in the snapshot")
+}
+
+func TestSnapshotOfUnreadData(t *testing.T) {
+	server := githubStandIn(false, false)
+	defer server.Close()
+	cfg := &config.Config{Logger: hclog.NewNullLogger(), Vars: map[string]interface{}{
+		"owner": "owner", "repo": "repo", "token": "token", "base-url": server.URL,
+	}}
+	loaded, err := loadGithubPayload(cfg, nil)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, exportSnapshot(&loaded, path))
+	require.NoError(t, WriteSnapshots())
+
+	server.Close()
+	restored, err := loadSnapshotPayload(cfg, path)
+	require.NoError(t, err)
+	_, err = restored.GetSuspectedBinaries()
+	assert.ErrorContains(t, err, "not scanned for binaries when the snapshot was exported", "data the export run didn't read isn't evaluated as empty")
+	_, err = restored.FindFiles(IsDockerfile)
+	assert.ErrorContains(t, err, "not listed when the snapshot was exported")
+}
+
+func TestLoadSnapshotPayload_UnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	content, err := json.Marshal(Snapshot{Version: SnapshotVersion + 1})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	_, err = loadSnapshotPayload(&config.Config{Logger: hclog.NewNullLogger()}, path)
+	assert.ErrorContains(t, err, "not supported")
+}
+
+// licenseListStandIn answers requests for the SPDX license list, passing any others on to base
+type licenseListStandIn struct {
+	base HttpClient
+}
+
+func (c licenseListStandIn) Do(request *http.Request) (*http.Response, error) {
+	if request.URL.String() != SPDXLicenseListURL {
+		return c.base.Do(request)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"licenses": [{"licenseId": "MIT"}]}`))}, nil
+}
@@ -1,6 +1,8 @@
 package evaluation_plans
 
 import (
+	"maps"
+
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/osps/access_control"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/osps/build_release"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/osps/docs"
@@ -56,4 +58,32 @@ var (
 		vuln_management.OSPS_VM_05(),
 		vuln_management.OSPS_VM_06(),
 	}
+
+	// OSPS_B_DataSources maps the requirements of OSPS_B to the data sources their steps depend on
+	OSPS_B_DataSources = suiteDataSources(OSPS_B,
+		access_control.DataSources,
+		build_release.DataSources,
+		docs.DataSources,
+		governance.DataSources,
+		legal.DataSources,
+		quality.DataSources,
+	)
 )
+
+// suiteDataSources merges the data sources declared by the control families, keeping the requirements
+// that the suite's evaluations assess
+func suiteDataSources(suite []*layer4.ControlEvaluation, families ...map[string][]string) map[string][]string {
+	merged := make(map[string][]string)
+	for _, family := range families {
+		maps.Copy(merged, family)
+	}
+	assessed := make(map[string][]string)
+	for _, evaluation := range suite {
+		for _, assessment := range evaluation.AssessmentLogs {
+			if sources, ok := merged[assessment.RequirementId]; ok {
+				assessed[assessment.RequirementId] = sources
+			}
+		}
+	}
+	return assessed
+}
@@ -0,0 +1,18 @@
+package evaluation_plans
+
+import (
+	"testing"
+
+	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
+	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/osps/build_release"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuiteDataSources(t *testing.T) {
+	assert.Equal(t, map[string][]string{
+		"OSPS-BR-04.01": {data.ReleasesData, data.ReleaseNotesData},
+	}, suiteDataSources([]*layer4.ControlEvaluation{build_release.OSPS_BR_04()}, build_release.DataSources), "requirements outside the suite are left out")
+
+	assert.Contains(t, OSPS_B_DataSources, "OSPS-AC-04.01")
+}
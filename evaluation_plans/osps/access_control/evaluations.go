@@ -2,12 +2,22 @@ package access_control
 
 import (
 	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/reusable_steps"
 )
 
 //
 // Access Control Control Family
 
+// DataSources names the data sources each requirement's steps depend on, as Payload.Unavailable keys
+var DataSources = map[string][]string{
+	"OSPS-AC-01.01": {data.RepositorySettingsData, data.OrganizationSettingsData},
+	"OSPS-AC-02.01": {data.RepositorySettingsData},
+	"OSPS-AC-03.01": {data.BranchProtectionData, data.RulesetsData},
+	"OSPS-AC-03.02": {data.BranchProtectionData, data.RulesetsData},
+	"OSPS-AC-04.01": {data.WorkflowPermissionsData},
+}
+
 func OSPS_AC_01() (evaluation *layer4.ControlEvaluation) {
 	evaluation = &layer4.ControlEvaluation{
 		ControlID: "OSPS-AC-01",
@@ -64,7 +74,7 @@ func OSPS_AC_03() (evaluation *layer4.ControlEvaluation) {
 			"Maturity Level 3",
 		},
 		[]layer4.AssessmentStep{
-			branchProtectionRestrictsPushes, // This checks branch protection, but not rulesets yet
+			branchProtectionRestrictsPushes,
 		},
 	)
 
@@ -77,7 +87,7 @@ func OSPS_AC_03() (evaluation *layer4.ControlEvaluation) {
 			"Maturity Level 3",
 		},
 		[]layer4.AssessmentStep{
-			branchProtectionPreventsDeletion, // This checks branch protection, but not rulesets yet
+			branchProtectionPreventsDeletion,
 		},
 	)
 
@@ -101,18 +111,16 @@ func OSPS_AC_04() (evaluation *layer4.ControlEvaluation) {
 		},
 	)
 
-	// Just run the previous assessments for now
-	// TODO: Implement this assessment
-	// evaluation.AddAssessment(
-	// 	"OSPS-AC-04.02",
-	// 	"When a job is assigned permissions in a CI/CD pipeline, the source code or configuration MUST only assign the minimum privileges necessary for the corresponding activity.",
-	// 	[]string{
-	// 		"Maturity Level 3",
-	// 	},
-	// 	[]layer4.AssessmentStep{
-	// 		reusable_steps.NotImplemented,
-	// 	},
-	// )
+	evaluation.AddAssessment(
+		"OSPS-AC-04.02",
+		"When a job is assigned permissions in a CI/CD pipeline, the source code or configuration MUST only assign the minimum privileges necessary for the corresponding activity.",
+		[]string{
+			"Maturity Level 3",
+		},
+		[]layer4.AssessmentStep{
+			workflowJobsUseLeastPrivilege,
+		},
+	)
 
 	return
 }
@@ -0,0 +1,279 @@
+package access_control
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rhysd/actionlint"
+)
+
+// permissionScopes are the scopes of the GITHUB_TOKEN that a workflow or job can grant
+var permissionScopes = []string{
+	"actions", "attestations", "checks", "contents", "deployments", "discussions", "id-token", "issues",
+	"packages", "pages", "pull-requests", "repository-projects", "security-events", "statuses",
+}
+
+// permissionLevels orders the access a scope can be granted
+var permissionLevels = map[string]int{"none": 0, "read": 1, "write": 2}
+
+// actionPermissions lists the token permissions that well known actions need, keyed by the action
+// without its version. A key naming only the repository covers every action in it. Actions that
+// don't use the token are listed with no permissions.
+var actionPermissions = map[string]map[string]string{
+	"actions/add-to-project":           {},
+	"actions/attest-build-provenance":  {"id-token": "write", "attestations": "write"},
+	"actions/attest-sbom":              {"id-token": "write", "attestations": "write"},
+	"actions/cache":                    {},
+	"actions/checkout":                 {"contents": "read"},
+	"actions/create-release":           {"contents": "write"},
+	"actions/dependency-review-action": {"contents": "read"},
+	"actions/deploy-pages":             {"pages": "write", "id-token": "write"},
+	"actions/download-artifact":        {},
+	"actions/labeler":                  {"contents": "read", "pull-requests": "write"},
+	"actions/setup-dotnet":             {},
+	"actions/setup-go":                 {},
+	"actions/setup-java":               {},
+	"actions/setup-node":               {},
+	"actions/setup-python":             {},
+	"actions/stale":                    {"issues": "write", "pull-requests": "write"},
+	"actions/upload-artifact":          {},
+	"actions/upload-pages-artifact":    {},
+	"advanced-security/component-detection-dependency-submission-action": {"contents": "write"},
+	"amannn/action-semantic-pull-request":                                {"pull-requests": "read"},
+	"aws-actions/configure-aws-credentials":                              {"id-token": "write"},
+	"azure/login":                                                        {"id-token": "write"},
+	"codecov/codecov-action":                                             {},
+	"dependabot/fetch-metadata":                                          {"pull-requests": "read"},
+	"docker/build-push-action":                                           {},
+	"docker/login-action":                                                {}, // needs packages: write when logging in to ghcr.io, see stepPermissions
+	"docker/metadata-action":                                             {},
+	"docker/setup-buildx-action":                                         {},
+	"docker/setup-qemu-action":                                           {},
+	"github/codeql-action":                                               {"security-events": "write", "contents": "read", "actions": "read"},
+	"golangci/golangci-lint-action":                                      {"contents": "read"},
+	"google-github-actions/auth":                                         {"id-token": "write"},
+	"goreleaser/goreleaser-action":                                       {"contents": "write"},
+	"gradle/actions/dependency-submission":                               {"contents": "write"},
+	"marocchino/sticky-pull-request-comment":                             {"pull-requests": "write"},
+	"ncipollo/release-action":                                            {"contents": "write"},
+	"ossf/scorecard-action":                                              {"security-events": "write", "id-token": "write"},
+	"peter-evans/create-pull-request":                                    {"contents": "write", "pull-requests": "write"},
+	"pypa/gh-action-pypi-publish":                                        {"id-token": "write"},
+	"release-drafter/release-drafter":                                    {"contents": "write", "pull-requests": "read"},
+	"sigstore/cosign-installer":                                          {},
+	"slsa-framework/slsa-github-generator":                               {"id-token": "write", "contents": "write", "actions": "read"},
+	"softprops/action-gh-release":                                        {"contents": "write"},
+	"step-security/harden-runner":                                        {},
+}
+
+// cliPermissions are the token permissions needed by commands run in scripts
+var cliPermissions = []struct {
+	pattern *regexp.Regexp
+	scope   string
+	level   string
+}{
+	{regexp.MustCompile(`\bgh\s+release\s+(create|upload|edit|delete)\b`), "contents", "write"},
+	{regexp.MustCompile(`\bgh\s+release\s+(view|list|download)\b`), "contents", "read"},
+	{regexp.MustCompile(`\bgh\s+pr\s+(create|merge|edit|comment|review|close|reopen|ready)\b`), "pull-requests", "write"},
+	{regexp.MustCompile(`\bgh\s+pr\s+(view|list|diff|checks|status)\b`), "pull-requests", "read"},
+	{regexp.MustCompile(`\bgh\s+issue\s+(create|comment|edit|close|reopen|delete|lock|unlock)\b`), "issues", "write"},
+	{regexp.MustCompile(`\bgh\s+issue\s+(view|list|status)\b`), "issues", "read"},
+	{regexp.MustCompile(`\bgh\s+(workflow\s+(run|enable|disable)|run\s+(rerun|cancel|delete)|cache\s+delete)\b`), "actions", "write"},
+	{regexp.MustCompile(`\bgh\s+(workflow|run)\s+(view|list|download|watch)\b`), "actions", "read"},
+	{regexp.MustCompile(`\bgit\s+push\b`), "contents", "write"},
+	{regexp.MustCompile(`\bdocker\s+(login|push)\b[^\n]*\bghcr\.io\b`), "packages", "write"},
+	{regexp.MustCompile(`\bcosign\s+(sign|sign-blob|attest|attest-blob)\b`), "id-token", "write"},
+	{regexp.MustCompile(`ACTIONS_ID_TOKEN_REQUEST_(URL|TOKEN)`), "id-token", "write"},
+}
+
+// scriptAPIScopes maps the octokit namespaces that actions/github-script exposes to the scope they use
+var scriptAPIScopes = map[string]string{
+	"actions": "actions", "checks": "checks", "git": "contents", "issues": "issues", "pulls": "pull-requests",
+}
+
+var (
+	// apiCalls are requests to the GitHub API whose permissions can't be inferred from the command
+	apiCalls = regexp.MustCompile(`\bgh\s+api\b|api\.github\.com`)
+	// scriptAPICalls are octokit calls in an actions/github-script script
+	scriptAPICalls = regexp.MustCompile(`\bgithub\.(rest\.)?(\w+)\.(\w+)\(|\bgithub\.(graphql|request)\(`)
+	// tokenReferences pass the workflow token to a step
+	tokenReferences = regexp.MustCompile(`\$\{\{\s*(github\.token|secrets\.GITHUB_TOKEN)\s*}}`)
+)
+
+// jobPermissions is the analysis of the permissions granted to a job against those its steps need
+type jobPermissions struct {
+	// declared is false when neither the job nor its workflow sets permissions
+	declared bool
+	writeAll bool
+	granted  map[string]string
+	needed   map[string]string
+	// unknown lists the steps whose needs couldn't be inferred
+	unknown []string
+}
+
+// overGranted returns the write permissions granted to the job that its steps don't need
+func (j jobPermissions) overGranted() (scopes []string) {
+	for _, scope := range slices.Sorted(maps.Keys(j.granted)) {
+		if j.granted[scope] == "write" && j.needed[scope] != "write" {
+			scopes = append(scopes, scope+": write")
+		}
+	}
+	return scopes
+}
+
+// analyseJobPermissions compares the permissions of a job, or of its workflow when the job doesn't
+// set them, with the needs of its steps
+func analyseJobPermissions(workflow *actionlint.Workflow, job *actionlint.Job) (analysis jobPermissions) {
+	permissions := job.Permissions
+	if permissions == nil {
+		permissions = workflow.Permissions
+	}
+	analysis.granted = make(map[string]string)
+	analysis.needed = make(map[string]string)
+	if permissions != nil {
+		analysis.declared = true
+		all := ""
+		if permissions.All != nil {
+			all = permissions.All.Value
+		}
+		analysis.writeAll = all == "write-all"
+		for _, scope := range permissionScopes {
+			switch all {
+			case "write-all":
+				analysis.granted[scope] = "write"
+			case "read-all":
+				analysis.granted[scope] = "read"
+			}
+		}
+		for name, scope := range permissions.Scopes {
+			if scope != nil && scope.Value != nil {
+				analysis.granted[name] = scope.Value.Value
+			}
+		}
+	}
+
+	if job.WorkflowCall != nil && job.WorkflowCall.Uses != nil {
+		analysis.unknown = append(analysis.unknown, "reusable workflow "+job.WorkflowCall.Uses.Value)
+	}
+	jobToken := referencesToken(job.Env)
+	for i, step := range job.Steps {
+		if step == nil {
+			continue
+		}
+		needed, known := stepPermissions(step, jobToken)
+		for scope, level := range needed {
+			if permissionLevels[level] > permissionLevels[analysis.needed[scope]] {
+				analysis.needed[scope] = level
+			}
+		}
+		if !known {
+			analysis.unknown = append(analysis.unknown, stepName(step, i))
+		}
+	}
+	return analysis
+}
+
+// stepPermissions infers the token permissions a step needs, and whether they could be inferred at all.
+// jobToken is true when the job passes the workflow token to every step in its environment.
+func stepPermissions(step *actionlint.Step, jobToken bool) (needed map[string]string, known bool) {
+	needed = make(map[string]string)
+	switch exec := step.Exec.(type) {
+	case *actionlint.ExecRun:
+		if exec.Run == nil {
+			return needed, true
+		}
+		script := exec.Run.Value
+		for _, command := range cliPermissions {
+			if command.pattern.MatchString(script) {
+				needed[command.scope] = maxLevel(needed[command.scope], command.level)
+			}
+		}
+		if apiCalls.MatchString(script) {
+			return needed, false
+		}
+		// a script given the token for something other than the commands above may use it any way it likes
+		givenToken := jobToken || referencesToken(step.Env) || tokenReferences.MatchString(script)
+		return needed, len(needed) > 0 || !givenToken
+	case *actionlint.ExecAction:
+		if exec.Uses == nil {
+			return needed, true
+		}
+		action := strings.ToLower(strings.SplitN(exec.Uses.Value, "@", 2)[0])
+		if action == "actions/github-script" {
+			return scriptPermissions(exec.Inputs["script"])
+		}
+		if action == "docker/login-action" {
+			if registry := exec.Inputs["registry"]; registry != nil && registry.Value != nil && strings.Contains(registry.Value.Value, "ghcr.io") {
+				needed["packages"] = "write"
+			}
+			return needed, true
+		}
+		permissions, ok := actionPermissions[action]
+		if !ok {
+			if segments := strings.Split(action, "/"); len(segments) > 2 {
+				permissions, ok = actionPermissions[segments[0]+"/"+segments[1]]
+			}
+		}
+		if !ok {
+			return needed, false
+		}
+		maps.Copy(needed, permissions)
+		return needed, true
+	}
+	return needed, false
+}
+
+// scriptPermissions infers the permissions of an actions/github-script script from its REST calls
+func scriptPermissions(script *actionlint.Input) (needed map[string]string, known bool) {
+	needed = make(map[string]string)
+	if script == nil || script.Value == nil {
+		return needed, true
+	}
+	known = true
+	for _, call := range scriptAPICalls.FindAllStringSubmatch(script.Value.Value, -1) {
+		scope, ok := scriptAPIScopes[call[2]]
+		if !ok {
+			known = false
+			continue
+		}
+		level := "write"
+		if strings.HasPrefix(call[3], "get") || strings.HasPrefix(call[3], "list") {
+			level = "read"
+		}
+		needed[scope] = maxLevel(needed[scope], level)
+	}
+	return needed, known
+}
+
+// referencesToken reports whether the workflow token is passed in an environment
+func referencesToken(env *actionlint.Env) bool {
+	if env == nil {
+		return false
+	}
+	for _, variable := range env.Vars {
+		if variable != nil && variable.Value != nil && tokenReferences.MatchString(variable.Value.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func maxLevel(a, b string) string {
+	if permissionLevels[b] > permissionLevels[a] {
+		return b
+	}
+	return a
+}
+
+func stepName(step *actionlint.Step, index int) string {
+	if step.Name != nil {
+		return fmt.Sprintf("step %q", step.Name.Value)
+	}
+	if action, ok := step.Exec.(*actionlint.ExecAction); ok && action.Uses != nil {
+		return fmt.Sprintf("step %s", action.Uses.Value)
+	}
+	return fmt.Sprintf("step %d", index+1)
+}
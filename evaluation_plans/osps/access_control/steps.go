@@ -1,8 +1,15 @@
 package access_control
 
 import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
 	"github.com/ossf/gemara/layer4"
+	"github.com/rhysd/actionlint"
 
+	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/reusable_steps"
 )
 
@@ -11,6 +18,12 @@ func orgRequiresMFA(payloadData any, _ map[string]*layer4.Change) (result layer4
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.RepositorySettingsData]; ok {
+		return layer4.NeedsReview, reason
+	}
+	if reason, ok := payload.Unavailable[data.OrganizationSettingsData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
 	required := payload.RepositoryMetadata.IsMFARequiredForAdministrativeActions()
 
@@ -27,17 +40,55 @@ func branchProtectionRestrictsPushes(payloadData any, _ map[string]*layer4.Chang
 	if message != "" {
 		return layer4.Unknown, message
 	}
-	protectionData := payload.Repository.DefaultBranchRef.BranchProtectionRule
+	if reason, ok := payload.Unavailable[data.BranchProtectionData]; ok {
+		return layer4.NeedsReview, reason
+	}
+	protectionData := payload.BranchProtection
+	// rulesets stop direct commits by requiring pull requests or a merge queue, or by blocking updates
+	directCommitRules := []string{data.RulePullRequest, data.RuleMergeQueue, data.RuleUpdate}
+	enforcing := protectionData.RulesetsWith(data.EnforcementActive, directCommitRules...)
+	evaluating := protectionData.RulesetsWith(data.EnforcementEvaluate, directCommitRules...)
 
+	protection := ""
 	if protectionData.RestrictsPushes {
-		result = layer4.Passed
-		message = "Branch protection rule restricts pushes"
+		protection = "Branch protection rule restricts pushes"
 	} else if protectionData.RequiresApprovingReviews {
+		protection = "Branch protection rule requires approving reviews"
+	}
+	// pushing directly means bypassing the branch protection rule as well as every enforcing ruleset
+	bypassing := protectionData.PushBypassActors(enforcing)
+
+	if protection != "" && len(bypassing) > 0 {
+		result = layer4.NeedsReview
+		message = fmt.Sprintf("%s, but %s can push directly to the branch", protection, data.DescribeBypassActors(bypassing))
+	} else if protection != "" && len(protectionData.BypassActors) > 0 && data.HiddenBypassActors(enforcing) {
+		result = layer4.NeedsReview
+		message = fmt.Sprintf("%s, but %s may push past it, and who may bypass the rulesets also preventing direct commits could not be read with the credentials in use; manual review required: %s",
+			protection, data.DescribeBypassActors(protectionData.BypassActors), data.DescribeRulesets(enforcing))
+	} else if protection != "" {
 		result = layer4.Passed
-		message = "Branch protection rule requires approving reviews"
-	} else {
+		message = protection
+	} else if reason, ok := payload.Unavailable[data.RulesetsData]; ok {
+		result = layer4.NeedsReview
+		message = "The branch protection rule doesn't restrict pushes or require pull requests, and rulesets could not be checked: " + reason
+	} else if len(bypassing) > 0 {
+		result = layer4.NeedsReview
+		message = fmt.Sprintf("Rulesets prevent direct commits, but %s can push directly to the branch: %s", data.DescribeBypassActors(bypassing), data.DescribeRulesets(enforcing))
+	} else if data.CurrentUserBypassesDirectly(enforcing) {
 		result = layer4.NeedsReview
-		message = "Branch protection rule does not restrict pushes or require approving reviews; Rulesets not yet evaluated."
+		message = fmt.Sprintf("Rulesets prevent direct commits, but the credentials in use can push directly to the branch: %s", data.DescribeRulesets(enforcing))
+	} else if data.HiddenBypassActors(enforcing) {
+		result = layer4.NeedsReview
+		message = fmt.Sprintf("Rulesets prevent direct commits, but who may bypass them could not be read with the credentials in use; manual review required: %s", data.DescribeRulesets(enforcing))
+	} else if len(enforcing) > 0 {
+		result = layer4.Passed
+		message = fmt.Sprintf("Rulesets prevent direct commits: %s", data.DescribeRulesets(enforcing))
+	} else if len(evaluating) > 0 {
+		result = layer4.NeedsReview
+		message = fmt.Sprintf("Only rulesets in evaluate mode, which are not enforced, would prevent direct commits: %s", data.DescribeRulesets(evaluating))
+	} else {
+		result = layer4.Failed
+		message = "Neither the branch protection rule nor any ruleset restricts pushes or requires pull requests"
 	}
 	return
 }
@@ -47,15 +98,38 @@ func branchProtectionPreventsDeletion(payloadData any, _ map[string]*layer4.Chan
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.BranchProtectionData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
-	allowsDeletion := payload.Repository.DefaultBranchRef.RefUpdateRule.AllowsDeletions
+	allowsDeletion := payload.BranchProtection.AllowsDeletions
+	enforcing := payload.BranchProtection.RulesetsWith(data.EnforcementActive, data.RuleDeletion)
+	evaluating := payload.BranchProtection.RulesetsWith(data.EnforcementEvaluate, data.RuleDeletion)
 
-	if allowsDeletion {
-		result = layer4.Failed
-		message = "Branch protection rule allows deletions"
-	} else {
+	if !allowsDeletion {
 		result = layer4.Passed
 		message = "Branch protection rule prevents deletions"
+	} else if reason, ok := payload.Unavailable[data.RulesetsData]; ok {
+		result = layer4.NeedsReview
+		message = "Branch protection rule allows deletions, and rulesets could not be checked: " + reason
+	} else if bypassing := data.DirectBypassActors(enforcing); len(bypassing) > 0 {
+		result = layer4.NeedsReview
+		message = fmt.Sprintf("Branch protection rule allows deletions, and rulesets preventing them can be bypassed by %s: %s", data.DescribeBypassActors(bypassing), data.DescribeRulesets(enforcing))
+	} else if data.CurrentUserBypassesDirectly(enforcing) {
+		result = layer4.NeedsReview
+		message = fmt.Sprintf("Branch protection rule allows deletions, and rulesets preventing them can be bypassed by the credentials in use: %s", data.DescribeRulesets(enforcing))
+	} else if data.HiddenBypassActors(enforcing) {
+		result = layer4.NeedsReview
+		message = fmt.Sprintf("Branch protection rule allows deletions; rulesets prevent them, but who may bypass them could not be read with the credentials in use; manual review required: %s", data.DescribeRulesets(enforcing))
+	} else if len(enforcing) > 0 {
+		result = layer4.Passed
+		message = fmt.Sprintf("Branch protection rule allows deletions, but rulesets prevent them: %s", data.DescribeRulesets(enforcing))
+	} else if len(evaluating) > 0 {
+		result = layer4.Failed
+		message = fmt.Sprintf("Branch protection rule allows deletions; rulesets in evaluate mode would prevent them but are not enforced: %s", data.DescribeRulesets(evaluating))
+	} else {
+		result = layer4.Failed
+		message = "Branch protection rule allows deletions"
 	}
 	return
 }
@@ -65,6 +139,9 @@ func workflowDefaultReadPermissions(payloadData any, _ map[string]*layer4.Change
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.WorkflowPermissionsData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
 	permissions := payload.WorkflowPermissions
 	if !payload.WorkflowsEnabled {
@@ -86,3 +163,67 @@ func workflowDefaultReadPermissions(payloadData any, _ map[string]*layer4.Change
 	}
 	return
 }
+
+func workflowJobsUseLeastPrivilege(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
+	payload, message := reusable_steps.VerifyPayload(payloadData)
+	if message != "" {
+		return layer4.Unknown, message
+	}
+	workflows, err := payload.GetWorkflowFiles()
+	if len(workflows) == 0 {
+		return layer4.NotApplicable, err.Error()
+	}
+
+	var findings, uncertain []string
+	for _, file := range workflows {
+		if !strings.HasSuffix(file.GetName(), ".yml") && !strings.HasSuffix(file.GetName(), ".yaml") {
+			continue
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			return layer4.Failed, fmt.Sprintf("Error decoding workflow file %s: %v", file.GetPath(), err)
+		}
+		workflow, parseErrors := actionlint.Parse([]byte(content))
+		if workflow == nil {
+			return layer4.Failed, fmt.Sprintf("Error parsing workflow: %v (%s)", parseErrors, file.GetPath())
+		}
+		jobFindings, jobUncertain := checkWorkflowJobPermissions(file.GetPath(), workflow)
+		findings = append(findings, jobFindings...)
+		uncertain = append(uncertain, jobUncertain...)
+	}
+
+	switch {
+	case len(findings) > 0:
+		return layer4.Failed, strings.Join(append(findings, uncertain...), "; ")
+	case len(uncertain) > 0:
+		return layer4.NeedsReview, strings.Join(uncertain, "; ")
+	default:
+		return layer4.Passed, "Every workflow job declares only the permissions its steps need"
+	}
+}
+
+// checkWorkflowJobPermissions reports the jobs of a workflow that don't declare permissions, grant
+// write-all or grant write scopes their steps don't need. Write scopes that can't be shown to be
+// unneeded, because some steps' needs can't be inferred, are reported as uncertain.
+func checkWorkflowJobPermissions(path string, workflow *actionlint.Workflow) (findings, uncertain []string) {
+	jobIDs := slices.Sorted(maps.Keys(workflow.Jobs))
+	for _, id := range jobIDs {
+		job := workflow.Jobs[id]
+		if job == nil {
+			continue
+		}
+		analysis := analyseJobPermissions(workflow, job)
+		switch overGranted := analysis.overGranted(); {
+		case !analysis.declared:
+			findings = append(findings, fmt.Sprintf("%s job %s doesn't declare permissions and gets the repository default", path, id))
+		case analysis.writeAll:
+			findings = append(findings, fmt.Sprintf("%s job %s grants write-all", path, id))
+		case len(overGranted) > 0 && len(analysis.unknown) == 0:
+			findings = append(findings, fmt.Sprintf("%s job %s grants %s, which its steps don't need", path, id, strings.Join(overGranted, ", ")))
+		case len(overGranted) > 0:
+			uncertain = append(uncertain, fmt.Sprintf("%s job %s grants %s, which its steps may not need; the permissions used by %s couldn't be inferred",
+				path, id, strings.Join(overGranted, ", "), strings.Join(analysis.unknown, ", ")))
+		}
+	}
+	return findings, uncertain
+}
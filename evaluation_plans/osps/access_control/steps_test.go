@@ -5,7 +5,10 @@ import (
 
 	"github.com/ossf/gemara/layer4"
 	"github.com/revanite-io/pvtr-github-repo/data"
+	"github.com/revanite-io/pvtr-github-repo/data/datatest"
+	"github.com/rhysd/actionlint"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type FakeRepositoryMetadata struct {
@@ -57,6 +60,15 @@ func Test_orgRequiresMFA(t *testing.T) {
 			wantResult:  layer4.NeedsReview,
 			wantMessage: "Not evaluated. Two-factor authentication evaluation requires a token with org:admin permissions, or manual review",
 		},
+		{
+			name: "organization settings unreadable",
+			payload: data.Payload{
+				RepositoryMetadata: stubRepoMetadata(nil),
+				Unavailable:        map[string]string{data.OrganizationSettingsData: "The credentials can't read the organization settings"},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "The credentials can't read the organization settings",
+		},
 	}
 
 	for _, tt := range tests {
@@ -146,6 +158,17 @@ func Test_workflowDefaultReadPermissions(t *testing.T) {
 			wantResult:  layer4.NeedsReview,
 			wantMessage: "GitHub Actions is disabled for this repository; manual review required.",
 		},
+		{
+			name: "Workflow permissions unavailable from the data source",
+			payload: data.Payload{
+				RestData: &data.RestData{},
+				Unavailable: map[string]string{
+					data.WorkflowPermissionsData: "not available offline",
+				},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "not available offline",
+		},
 	}
 
 	for _, tt := range tests {
@@ -156,3 +179,555 @@ func Test_workflowDefaultReadPermissions(t *testing.T) {
 		})
 	}
 }
+
+func Test_branchProtectionRestrictsPushes(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name: "pushes restricted",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{RestrictsPushes: true},
+			},
+			wantResult:  layer4.Passed,
+			wantMessage: "Branch protection rule restricts pushes",
+		},
+		{
+			name: "approving reviews required",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{RequiresApprovingReviews: true},
+			},
+			wantResult:  layer4.Passed,
+			wantMessage: "Branch protection rule requires approving reviews",
+		},
+		{
+			name: "branch protection rule bypassed",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{
+					RequiresApprovingReviews: true,
+					BypassActors:             []data.BypassActor{{ActorID: 5, ActorType: "RepositoryRole", BypassMode: data.BypassModeAlways, Name: "admin role"}},
+				},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "Branch protection rule requires approving reviews, but admin role (always) can push directly to the branch",
+		},
+		{
+			name: "branch protection rule bypassed by actors a ruleset stops",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{
+					RestrictsPushes: true,
+					BypassActors:    []data.BypassActor{{ActorID: 7, ActorType: "Team", BypassMode: data.BypassModeAlways, Name: "team org/release"}},
+					Rulesets: []data.BranchRuleset{
+						{
+							RulesetPolicy: data.RulesetPolicy{Name: "main", Enforcement: data.EnforcementActive},
+							Rules:         []data.Ruleset{{Type: data.RuleUpdate}},
+						},
+					},
+				},
+			},
+			wantResult:  layer4.Passed,
+			wantMessage: "Branch protection rule restricts pushes",
+		},
+		{
+			name: "branch protection rule bypassed and ruleset bypass actors unreadable",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{
+					RestrictsPushes: true,
+					BypassActors:    []data.BypassActor{{ActorID: 7, ActorType: "Team", BypassMode: data.BypassModeAlways, Name: "team org/release"}},
+					Rulesets: []data.BranchRuleset{
+						{
+							RulesetPolicy: data.RulesetPolicy{Name: "main", Enforcement: data.EnforcementActive, BypassActorsHidden: true},
+							Rules:         []data.Ruleset{{Type: data.RulePullRequest}},
+						},
+					},
+				},
+			},
+			wantResult: layer4.NeedsReview,
+			wantMessage: "Branch protection rule restricts pushes, but team org/release (always) may push past it, and who may bypass the rulesets " +
+				`also preventing direct commits could not be read with the credentials in use; manual review required: "main" (bypass actors unreadable)`,
+		},
+		{
+			name: "active ruleset requires pull requests",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+					{
+						RulesetPolicy: data.RulesetPolicy{
+							Name:         "main",
+							Enforcement:  data.EnforcementActive,
+							BypassActors: []data.BypassActor{{ActorID: 5, ActorType: "RepositoryRole", BypassMode: "pull_request"}},
+						},
+						Rules: []data.Ruleset{{Type: data.RuleDeletion}, {Type: data.RulePullRequest}},
+					},
+				}},
+			},
+			wantResult:  layer4.Passed,
+			wantMessage: `Rulesets prevent direct commits: "main" (bypassable by RepositoryRole 5 (pull_request))`,
+		},
+		{
+			name: "ruleset bypass actors unreadable",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+					{
+						RulesetPolicy: data.RulesetPolicy{Name: "main", Enforcement: data.EnforcementActive, BypassActorsHidden: true, CurrentUserCanBypass: "never"},
+						Rules:         []data.Ruleset{{Type: data.RulePullRequest}},
+					},
+				}},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: `Rulesets prevent direct commits, but who may bypass them could not be read with the credentials in use; manual review required: "main" (bypass actors unreadable)`,
+		},
+		{
+			name: "ruleset bypassed by the credentials in use",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+					{
+						RulesetPolicy: data.RulesetPolicy{Name: "main", Enforcement: data.EnforcementActive, BypassActorsHidden: true, CurrentUserCanBypass: data.BypassModeAlways},
+						Rules:         []data.Ruleset{{Type: data.RulePullRequest}},
+					},
+				}},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: `Rulesets prevent direct commits, but the credentials in use can push directly to the branch: "main" (bypass actors unreadable)`,
+		},
+		{
+			name: "every ruleset can be bypassed by the same actor",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+					{
+						RulesetPolicy: data.RulesetPolicy{
+							Name:        "org baseline",
+							Enforcement: data.EnforcementActive,
+							BypassActors: []data.BypassActor{
+								{ActorID: 7, ActorType: "Team", BypassMode: data.BypassModeAlways, Name: "team org/release"},
+								{ActorID: 5, ActorType: "RepositoryRole", BypassMode: data.BypassModeAlways},
+							},
+						},
+						Rules: []data.Ruleset{{Type: data.RulePullRequest}},
+					},
+					{
+						RulesetPolicy: data.RulesetPolicy{
+							Name:         "merge queue",
+							Enforcement:  data.EnforcementActive,
+							BypassActors: []data.BypassActor{{ActorID: 7, ActorType: "Team", BypassMode: data.BypassModeExempt, Name: "team org/release"}},
+						},
+						Rules: []data.Ruleset{{Type: data.RuleMergeQueue}},
+					},
+				}},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: `Rulesets prevent direct commits, but team org/release (always) can push directly to the branch: "org baseline" (bypassable by team org/release (always), RepositoryRole 5 (always)), "merge queue" (bypassable by team org/release (exempt))`,
+		},
+		{
+			name: "rulesets bypassed by different actors",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+					{
+						RulesetPolicy: data.RulesetPolicy{
+							Name:         "org baseline",
+							Enforcement:  data.EnforcementActive,
+							BypassActors: []data.BypassActor{{ActorType: "DeployKey", BypassMode: data.BypassModeAlways, Name: "deploy keys"}},
+						},
+						Rules: []data.Ruleset{{Type: data.RulePullRequest}},
+					},
+					{
+						RulesetPolicy: data.RulesetPolicy{
+							Name:         "repo",
+							Enforcement:  data.EnforcementActive,
+							BypassActors: []data.BypassActor{{ActorID: 1, ActorType: "OrganizationAdmin", BypassMode: data.BypassModeAlways, Name: "organization admins"}},
+						},
+						Rules: []data.Ruleset{{Type: data.RuleUpdate}},
+					},
+				}},
+			},
+			wantResult:  layer4.Passed,
+			wantMessage: `Rulesets prevent direct commits: "org baseline" (bypassable by deploy keys (always)), "repo" (bypassable by organization admins (always))`,
+		},
+		{
+			name: "ruleset in evaluate mode",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+					{
+						RulesetPolicy: data.RulesetPolicy{Name: "trial", Enforcement: data.EnforcementEvaluate},
+						Rules:         []data.Ruleset{{Type: data.RuleMergeQueue}},
+					},
+				}},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: `Only rulesets in evaluate mode, which are not enforced, would prevent direct commits: "trial" (evaluate mode)`,
+		},
+		{
+			name: "ruleset without a rule preventing direct commits",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+					{
+						RulesetPolicy: data.RulesetPolicy{Name: "signed", Enforcement: data.EnforcementActive},
+						Rules:         []data.Ruleset{{Type: data.RuleRequiredSignatures}},
+					},
+				}},
+			},
+			wantResult:  layer4.Failed,
+			wantMessage: "Neither the branch protection rule nor any ruleset restricts pushes or requires pull requests",
+		},
+		{
+			name:        "no protection",
+			payload:     data.Payload{},
+			wantResult:  layer4.Failed,
+			wantMessage: "Neither the branch protection rule nor any ruleset restricts pushes or requires pull requests",
+		},
+		{
+			name: "branch protection unavailable from the data source",
+			payload: data.Payload{
+				Unavailable: map[string]string{
+					data.BranchProtectionData: "not available offline",
+				},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "not available offline",
+		},
+		{
+			name: "rulesets unavailable",
+			payload: data.Payload{
+				Unavailable: map[string]string{data.RulesetsData: "the rulesets targeting the branch are unavailable"},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "The branch protection rule doesn't restrict pushes or require pull requests, and rulesets could not be checked: the rulesets targeting the branch are unavailable",
+		},
+		{
+			name: "rulesets unavailable but pushes restricted",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{RestrictsPushes: true},
+				Unavailable:      map[string]string{data.RulesetsData: "the rulesets targeting the branch are unavailable"},
+			},
+			wantResult:  layer4.Passed,
+			wantMessage: "Branch protection rule restricts pushes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, gotMessage := branchProtectionRestrictsPushes(tt.payload, map[string]*layer4.Change{})
+			assert.Equal(t, tt.wantResult, gotResult)
+			assert.Equal(t, tt.wantMessage, gotMessage)
+		})
+	}
+}
+
+func Test_branchProtectionPreventsDeletion(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name: "deletions allowed",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{AllowsDeletions: true},
+			},
+			wantResult:  layer4.Failed,
+			wantMessage: "Branch protection rule allows deletions",
+		},
+		{
+			name: "deletions allowed by branch protection but prevented by a ruleset",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{
+					AllowsDeletions: true,
+					Rulesets: []data.BranchRuleset{
+						{
+							RulesetPolicy: data.RulesetPolicy{Name: "org baseline", Enforcement: data.EnforcementActive},
+							Rules:         []data.Ruleset{{Type: data.RuleDeletion}},
+						},
+					},
+				},
+			},
+			wantResult:  layer4.Passed,
+			wantMessage: `Branch protection rule allows deletions, but rulesets prevent them: "org baseline"`,
+		},
+		{
+			name: "ruleset preventing deletions can be bypassed",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{
+					AllowsDeletions: true,
+					Rulesets: []data.BranchRuleset{
+						{
+							RulesetPolicy: data.RulesetPolicy{
+								Name:         "org baseline",
+								Enforcement:  data.EnforcementActive,
+								BypassActors: []data.BypassActor{{ActorID: 12, ActorType: "Integration", BypassMode: data.BypassModeAlways, Name: "app release-bot"}},
+							},
+							Rules: []data.Ruleset{{Type: data.RuleDeletion}},
+						},
+					},
+				},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: `Branch protection rule allows deletions, and rulesets preventing them can be bypassed by app release-bot (always): "org baseline" (bypassable by app release-bot (always))`,
+		},
+		{
+			name: "ruleset preventing deletions has unreadable bypass actors",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{
+					AllowsDeletions: true,
+					Rulesets: []data.BranchRuleset{
+						{
+							RulesetPolicy: data.RulesetPolicy{Name: "org baseline", Enforcement: data.EnforcementActive, BypassActorsHidden: true},
+							Rules:         []data.Ruleset{{Type: data.RuleDeletion}},
+						},
+					},
+				},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: `Branch protection rule allows deletions; rulesets prevent them, but who may bypass them could not be read with the credentials in use; manual review required: "org baseline" (bypass actors unreadable)`,
+		},
+		{
+			name: "ruleset preventing deletions bypassed by the credentials in use",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{
+					AllowsDeletions: true,
+					Rulesets: []data.BranchRuleset{
+						{
+							RulesetPolicy: data.RulesetPolicy{Name: "org baseline", Enforcement: data.EnforcementActive, CurrentUserCanBypass: data.BypassModeExempt},
+							Rules:         []data.Ruleset{{Type: data.RuleDeletion}},
+						},
+					},
+				},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: `Branch protection rule allows deletions, and rulesets preventing them can be bypassed by the credentials in use: "org baseline"`,
+		},
+		{
+			name: "deletions prevented only by a ruleset in evaluate mode",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{
+					AllowsDeletions: true,
+					Rulesets: []data.BranchRuleset{
+						{
+							RulesetPolicy: data.RulesetPolicy{Name: "trial", Enforcement: data.EnforcementEvaluate},
+							Rules:         []data.Ruleset{{Type: data.RuleDeletion}},
+						},
+					},
+				},
+			},
+			wantResult:  layer4.Failed,
+			wantMessage: `Branch protection rule allows deletions; rulesets in evaluate mode would prevent them but are not enforced: "trial" (evaluate mode)`,
+		},
+		{
+			name:        "deletions prevented",
+			payload:     data.Payload{},
+			wantResult:  layer4.Passed,
+			wantMessage: "Branch protection rule prevents deletions",
+		},
+		{
+			name: "deletions allowed and rulesets unavailable",
+			payload: data.Payload{
+				BranchProtection: data.BranchProtection{AllowsDeletions: true},
+				Unavailable:      map[string]string{data.RulesetsData: "the rulesets targeting the branch are unavailable"},
+			},
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "Branch protection rule allows deletions, and rulesets could not be checked: the rulesets targeting the branch are unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, gotMessage := branchProtectionPreventsDeletion(tt.payload, map[string]*layer4.Change{})
+			assert.Equal(t, tt.wantResult, gotResult)
+			assert.Equal(t, tt.wantMessage, gotMessage)
+		})
+	}
+}
+
+func Test_checkWorkflowJobPermissions(t *testing.T) {
+	tests := []struct {
+		name          string
+		workflow      string
+		wantFindings  []string
+		wantUncertain []string
+	}{
+		{
+			name: "permissions match the steps",
+			workflow: `
+on: push
+permissions:
+  contents: read
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v5
+      - uses: actions/setup-go@v6
+      - run: go test ./...
+  release:
+    runs-on: ubuntu-latest
+    permissions:
+      contents: write
+      id-token: write
+    steps:
+      - uses: actions/checkout@v5
+      - uses: sigstore/cosign-installer@v3
+      - run: gh release upload v1 dist/*
+        env:
+          GH_TOKEN: ${{ github.token }}
+      - run: cosign sign-blob --yes dist/app
+`,
+		},
+		{
+			name: "job without permissions",
+			workflow: `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`,
+			wantFindings: []string{"ci.yml job build doesn't declare permissions and gets the repository default"},
+		},
+		{
+			name: "write-all",
+			workflow: `
+on: push
+permissions: write-all
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`,
+			wantFindings: []string{"ci.yml job build grants write-all"},
+		},
+		{
+			name: "write scopes the steps don't need",
+			workflow: `
+on: pull_request
+jobs:
+  label:
+    runs-on: ubuntu-latest
+    permissions:
+      contents: write
+      issues: write
+      pull-requests: write
+    steps:
+      - uses: actions/labeler@v5
+      - uses: actions/github-script@v7
+        with:
+          script: |
+            const { data } = await github.rest.issues.listLabelsOnIssue(context.issue)
+`,
+			wantFindings: []string{"ci.yml job label grants contents: write, issues: write, which its steps don't need"},
+		},
+		{
+			name: "steps whose needs can't be inferred",
+			workflow: `
+on: push
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    permissions:
+      deployments: write
+    steps:
+      - uses: example/deploy-action@v1
+      - run: gh api repos/{owner}/{repo}/deployments -f ref=main
+  call:
+    permissions:
+      contents: write
+    uses: ./.github/workflows/release.yml
+`,
+			wantUncertain: []string{
+				"ci.yml job call grants contents: write, which its steps may not need; the permissions used by reusable workflow ./.github/workflows/release.yml couldn't be inferred",
+				"ci.yml job deploy grants deployments: write, which its steps may not need; the permissions used by step example/deploy-action@v1, step 2 couldn't be inferred",
+			},
+		},
+		{
+			name: "ghcr.io login needs packages",
+			workflow: `
+on: push
+jobs:
+  image:
+    runs-on: ubuntu-latest
+    permissions:
+      packages: write
+    steps:
+      - uses: docker/login-action@v3
+        with:
+          registry: ghcr.io
+          password: ${{ secrets.GITHUB_TOKEN }}
+      - uses: docker/build-push-action@v6
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow, errs := actionlint.Parse([]byte(tt.workflow))
+			require.Empty(t, errs)
+			findings, uncertain := checkWorkflowJobPermissions("ci.yml", workflow)
+			assert.Equal(t, tt.wantFindings, findings)
+			assert.Equal(t, tt.wantUncertain, uncertain)
+		})
+	}
+}
+
+func Test_workflowJobsUseLeastPrivilege(t *testing.T) {
+	deployWorkflow := `
+on: push
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    permissions:
+      deployments: write
+    steps:
+      - uses: example/deploy-action@v1
+`
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name: "permissions match the steps",
+			payload: datatest.PayloadWithFiles(map[string]string{".github/workflows/ci.yml": `
+on: push
+permissions:
+  contents: read
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v5
+      - run: go test ./...
+`}),
+			wantResult:  layer4.Passed,
+			wantMessage: "Every workflow job declares only the permissions its steps need",
+		},
+		{
+			name:        "steps whose needs can't be inferred",
+			payload:     datatest.PayloadWithFiles(map[string]string{".github/workflows/deploy.yml": deployWorkflow}),
+			wantResult:  layer4.NeedsReview,
+			wantMessage: ".github/workflows/deploy.yml job deploy grants deployments: write, which its steps may not need; the permissions used by step example/deploy-action@v1 couldn't be inferred",
+		},
+		{
+			name: "findings are reported with the uncertain jobs",
+			payload: datatest.PayloadWithFiles(map[string]string{
+				".github/workflows/ci.yml":     "on: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n",
+				".github/workflows/deploy.yml": deployWorkflow,
+				".github/workflows/README.md":  "# workflows\n",
+			}),
+			wantResult: layer4.Failed,
+			wantMessage: ".github/workflows/ci.yml job build doesn't declare permissions and gets the repository default; " +
+				".github/workflows/deploy.yml job deploy grants deployments: write, which its steps may not need; the permissions used by step example/deploy-action@v1 couldn't be inferred",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := workflowJobsUseLeastPrivilege(tt.payload, nil)
+			assert.Equal(t, tt.wantResult, result)
+			assert.Equal(t, tt.wantMessage, message)
+		})
+	}
+}
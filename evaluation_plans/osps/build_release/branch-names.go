@@ -0,0 +1,230 @@
+package build_release
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rhysd/actionlint"
+)
+
+// branchNameExpressions match the contexts holding branch and ref names, which are chosen by whoever
+// pushes the branch or opens the pull request
+var branchNameExpressions = regexp.MustCompile(`\bgithub\.(head_ref|base_ref|ref_name|ref\b|` +
+	`event\.(ref|base_ref|master_ref)\b|` +
+	`event\.pull_request\.(head|base)\.(ref|label)\b|` +
+	`event\.workflow_run\.head_branch|` +
+	`event\.workflow_run\.pull_requests.*\.head\.ref|` +
+	`event\.check_suite\.head_branch|` +
+	`event\.check_run\.check_suite\.head_branch|` +
+	`event\.merge_group\.(head|base)_ref)`)
+
+// GitLab CI predefined variables holding branch names. CI_COMMIT_REF_SLUG is left out, as GitLab
+// reduces it to lowercase letters, digits and dashes.
+var gitlabBranchVariables = []string{
+	"CI_COMMIT_BRANCH",
+	"CI_COMMIT_REF_NAME",
+	"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME",
+	"CI_MERGE_REQUEST_TARGET_BRANCH_NAME",
+	"CI_EXTERNAL_PULL_REQUEST_SOURCE_BRANCH_NAME",
+	"CI_EXTERNAL_PULL_REQUEST_TARGET_BRANCH_NAME",
+}
+
+// comparisonExpressions only test a value, so they expand to true or false however the branch is named
+var comparisonExpressions = regexp.MustCompile(`^[^&|]*(==|!=|\b(startsWith|endsWith|contains)\()`)
+
+// shellVariable matches a variable expansion in a shell script, such as $BRANCH or ${BRANCH}
+var shellVariable = regexp.MustCompile(`^\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// branchNameUse is a place where a branch name reaches a script
+type branchNameUse struct {
+	// location names the workflow, job and step
+	location string
+	// value is the expression or variable holding the branch name
+	value string
+	// safe is true when the name is passed through the environment and quoted where it is expanded
+	safe bool
+}
+
+func (u branchNameUse) String() string {
+	if strings.HasPrefix(u.value, "$") {
+		return fmt.Sprintf("Branch name expanded without quotes: %s (%s)", u.value, u.location)
+	}
+	return fmt.Sprintf("Branch name interpolated into a script: %s (%s)", u.value, u.location)
+}
+
+// findBranchNameUses finds the branch names used by the scripts of a workflow. Names interpolated
+// into a script with ${{ }} are unsafe, as the expression is expanded before the script is parsed.
+// Names passed through env: are safe where the script expands the variable in double quotes.
+func findBranchNameUses(path string, workflow *actionlint.Workflow) (uses []branchNameUse) {
+	workflowEnv := branchNameVariables(workflow.Env, nil)
+	for _, jobID := range slices.Sorted(maps.Keys(workflow.Jobs)) {
+		job := workflow.Jobs[jobID]
+		if job == nil {
+			continue
+		}
+		jobEnv := branchNameVariables(job.Env, workflowEnv)
+		shell := defaultShell(workflow.Defaults)
+		if jobShell := defaultShell(job.Defaults); jobShell != "" {
+			shell = jobShell
+		}
+		for i, step := range job.Steps {
+			if step == nil {
+				continue
+			}
+			location := fmt.Sprintf("%s job %s %s", path, jobID, stepLabel(step, i))
+			var script string
+			stepShell := shell
+			switch exec := step.Exec.(type) {
+			case *actionlint.ExecRun:
+				if exec.Run == nil {
+					continue
+				}
+				script = exec.Run.Value
+				if exec.Shell != nil {
+					stepShell = exec.Shell.Value
+				}
+			case *actionlint.ExecAction:
+				// actions/github-script runs its script input as JavaScript
+				if exec.Uses == nil || !strings.HasPrefix(exec.Uses.Value, "actions/github-script@") || exec.Inputs["script"] == nil || exec.Inputs["script"].Value == nil {
+					continue
+				}
+				script = exec.Inputs["script"].Value.Value
+				stepShell = "javascript"
+			default:
+				continue
+			}
+
+			for _, expression := range pullVariablesFromScript(script) {
+				if branchNameExpressions.MatchString(expression) && !comparisonExpressions.MatchString(expression) {
+					uses = append(uses, branchNameUse{location: location, value: expression})
+				}
+			}
+			if stepShell == "javascript" {
+				continue
+			}
+			env := branchNameVariables(step.Env, jobEnv)
+			for _, name := range slices.Sorted(maps.Keys(env)) {
+				quoted, unquoted := shellExpansions(script, name)
+				// PowerShell and Python don't split or glob variables, so any reference to one is safe
+				if !isPOSIXShell(stepShell) {
+					quoted, unquoted = quoted || unquoted, false
+				}
+				if unquoted {
+					uses = append(uses, branchNameUse{location: location, value: "$" + name})
+				} else if quoted {
+					uses = append(uses, branchNameUse{location: location, value: "$" + name, safe: true})
+				}
+			}
+		}
+	}
+	return uses
+}
+
+// findGitlabBranchNameUses finds the branch names expanded by the scripts of a GitLab CI pipeline,
+// where predefined variables reach the script through the environment
+func findGitlabBranchNameUses(pipeline map[string]any) (uses []branchNameUse) {
+	names := []string{""}
+	for name := range pipeline {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		var section any = pipeline
+		if name != "" {
+			section = pipeline[name]
+		}
+		keywords, ok := section.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, keyword := range gitlabScriptKeywords {
+			script := strings.Join(flattenGitlabScript(keywords[keyword]), "\n")
+			location := strings.TrimPrefix(name+"."+keyword, ".")
+			for _, variable := range gitlabBranchVariables {
+				quoted, unquoted := shellExpansions(script, variable)
+				if unquoted {
+					uses = append(uses, branchNameUse{location: location, value: "$" + variable})
+				} else if quoted {
+					uses = append(uses, branchNameUse{location: location, value: "$" + variable, safe: true})
+				}
+			}
+		}
+	}
+	return uses
+}
+
+// branchNameVariables returns the environment variables holding branch names, starting from those
+// inherited from an enclosing environment. Variables set here override inherited ones.
+func branchNameVariables(env *actionlint.Env, inherited map[string]bool) map[string]bool {
+	variables := maps.Clone(inherited)
+	if variables == nil {
+		variables = make(map[string]bool)
+	}
+	if env == nil {
+		return variables
+	}
+	for _, variable := range env.Vars {
+		if variable == nil || variable.Name == nil {
+			continue
+		}
+		holdsBranch := false
+		if variable.Value != nil {
+			for _, expression := range pullVariablesFromScript(variable.Value.Value) {
+				if branchNameExpressions.MatchString(expression) && !comparisonExpressions.MatchString(expression) {
+					holdsBranch = true
+				}
+			}
+		}
+		if holdsBranch {
+			variables[variable.Name.Value] = true
+		} else {
+			delete(variables, variable.Name.Value)
+		}
+	}
+	return variables
+}
+
+// shellExpansions reports whether a POSIX shell script expands the variable name inside double
+// quotes, and whether it does so outside of any quotes. Expansions in single quotes are literal.
+func shellExpansions(script, name string) (quoted, unquoted bool) {
+	inSingle, inDouble := false, false
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\\' && !inSingle:
+			i++
+		case c == '\'' && !inDouble:
+			inSingle = !inSingle
+		case c == '"' && !inSingle:
+			inDouble = !inDouble
+		case c == '$' && !inSingle:
+			match := shellVariable.FindStringSubmatch(script[i:])
+			if match == nil || match[1] != name {
+				continue
+			}
+			if inDouble {
+				quoted = true
+			} else {
+				unquoted = true
+			}
+			i += len(match[0]) - 1
+		}
+	}
+	return quoted, unquoted
+}
+
+func defaultShell(defaults *actionlint.Defaults) string {
+	if defaults == nil || defaults.Run == nil || defaults.Run.Shell == nil {
+		return ""
+	}
+	return defaults.Run.Shell.Value
+}
+
+// isPOSIXShell reports whether a step's shell splits and globs unquoted variables. Steps without a
+// shell run bash on Linux and macOS runners.
+func isPOSIXShell(shell string) bool {
+	name := strings.Fields(shell + " bash")[0]
+	return name == "bash" || name == "sh"
+}
@@ -0,0 +1,246 @@
+package build_release
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/rhysd/actionlint"
+
+	"github.com/revanite-io/pvtr-github-repo/data"
+)
+
+var (
+	runsSection  = regexp.MustCompile(`^runs:\s*$`)
+	stepsSection = regexp.MustCompile(`^(\s+)steps:\s*$`)
+)
+
+// callGraph reads the composite actions and reusable workflows that workflows call, so that
+// untrusted inputs can be followed through the values passed to them with with:
+type callGraph struct {
+	// read returns a file of the repository being evaluated
+	read func(path string) (string, error)
+	// readRemote returns a file of another repository at a commit. Calls to other repositories are
+	// only followed when they are pinned to a commit.
+	readRemote func(repository, commit, path string) (string, error)
+	// calling holds the calls being followed, so that calls which loop end
+	calling map[string]bool
+	// unresolved lists the calls whose definitions couldn't be read
+	unresolved []string
+}
+
+// callTarget is where the definition of a called action or reusable workflow is kept
+type callTarget struct {
+	// repository and commit are empty for the repository being evaluated
+	repository string
+	commit     string
+	path       string
+}
+
+func (t callTarget) String() string {
+	if t.repository == "" {
+		return t.path
+	}
+	return fmt.Sprintf("%s/%s@%s", t.repository, t.path, t.commit)
+}
+
+// resolveCall finds where the definition of the action or workflow in a uses: value is kept, or
+// returns false when it can't be followed
+func (g *callGraph) resolveCall(uses string) (target callTarget, ok bool) {
+	if local, isLocal := strings.CutPrefix(uses, "./"); isLocal {
+		return callTarget{path: path.Clean(local)}, g.read != nil
+	}
+	if g.readRemote == nil || strings.HasPrefix(uses, "docker://") {
+		return target, false
+	}
+	name, commit, _ := strings.Cut(uses, "@")
+	segments := strings.SplitN(name, "/", 3)
+	if len(segments) < 2 || !commitSHA.MatchString(commit) {
+		return target, false
+	}
+	target = callTarget{repository: segments[0] + "/" + segments[1], commit: commit}
+	if len(segments) == 3 {
+		target.path = segments[2]
+	}
+	return target, true
+}
+
+// readTarget reads the definition of a call, trying each of names in turn within the target's path
+func (g *callGraph) readTarget(target callTarget, names ...string) (file callTarget, content string, err error) {
+	for _, name := range names {
+		file = target
+		file.path = strings.TrimPrefix(path.Join(target.path, name), "/")
+		if file.repository == "" {
+			content, err = g.read(file.path)
+		} else {
+			content, err = g.readRemote(file.repository, file.commit, file.path)
+		}
+		if err == nil {
+			return file, content, nil
+		}
+	}
+	return file, "", err
+}
+
+// enter marks a call as being followed, returning false when it already is
+func (g *callGraph) enter(file callTarget) bool {
+	if g.calling == nil {
+		g.calling = make(map[string]bool)
+	}
+	if g.calling[file.String()] {
+		return false
+	}
+	g.calling[file.String()] = true
+	return true
+}
+
+func (g *callGraph) unreadable(uses string, err error) {
+	// other repositories can't be read in some setups, which is not something to review
+	if !errors.Is(err, data.ErrRemoteFilesUnavailable) {
+		g.unresolved = append(g.unresolved, fmt.Sprintf("%s (%v)", uses, err))
+	}
+}
+
+// actionFlows follows untrusted data into the composite action a step runs
+func (g *callGraph) actionFlows(exec *actionlint.ExecAction, scope taintScope, location string) (flows []taintPath) {
+	if g == nil {
+		return nil
+	}
+	target, ok := g.resolveCall(exec.Uses.Value)
+	if !ok {
+		return nil
+	}
+	file, content, err := g.readTarget(target, "action.yml", "action.yaml")
+	if err != nil {
+		g.unreadable(exec.Uses.Value, err)
+		return nil
+	}
+	steps, composite, err := parseCompositeAction(content)
+	if err != nil {
+		g.unreadable(exec.Uses.Value, err)
+		return nil
+	}
+	if !composite || !g.enter(file) {
+		return nil
+	}
+	defer delete(g.calling, file.String())
+
+	inputs := make(map[string]taintPath)
+	for _, key := range slices.Sorted(maps.Keys(exec.Inputs)) {
+		input := exec.Inputs[key]
+		if input == nil || input.Name == nil || input.Value == nil {
+			continue
+		}
+		if path := scope.valueTaint(input.Value.Value); path != nil {
+			inputs[key] = path.then(fmt.Sprintf("inputs.%s of %s in %s", input.Name.Value, exec.Uses.Value, location), input.Value.Pos.Line)
+		}
+	}
+	// the steps of a composite action run in the environment of the step that calls it
+	actionScope := newTaintScope(inputs)
+	actionScope.env = maps.Clone(scope.env)
+	return stepFlows(actionScope, steps, file.String(), g)
+}
+
+// workflowCallFlows follows untrusted data into the reusable workflow a job calls
+func (g *callGraph) workflowCallFlows(call *actionlint.WorkflowCall, scope taintScope, place string) (flows []taintPath) {
+	if g == nil || call.Uses == nil {
+		return nil
+	}
+	target, ok := g.resolveCall(call.Uses.Value)
+	if !ok {
+		return nil
+	}
+	file, content, err := g.readTarget(target, "")
+	if err != nil {
+		g.unreadable(call.Uses.Value, err)
+		return nil
+	}
+	workflow, errs := actionlint.Parse([]byte(content))
+	if workflow == nil {
+		g.unreadable(call.Uses.Value, fmt.Errorf("%v", errs))
+		return nil
+	}
+	if !g.enter(file) {
+		return nil
+	}
+	defer delete(g.calling, file.String())
+
+	inputs := make(map[string]taintPath)
+	for _, key := range slices.Sorted(maps.Keys(call.Inputs)) {
+		input := call.Inputs[key]
+		if input == nil || input.Name == nil || input.Value == nil {
+			continue
+		}
+		if path := scope.valueTaint(input.Value.Value); path != nil {
+			inputs[key] = path.then(fmt.Sprintf("inputs.%s of %s in %s", input.Name.Value, call.Uses.Value, place), input.Value.Pos.Line)
+		}
+	}
+	flows = workflowFlows(workflow, file.String(), inputs, g)
+	if target.repository != "" {
+		return flows
+	}
+	// workflows in this repository are checked on their own, so only what the caller passes them is new
+	var passed []taintPath
+	for _, flow := range flows {
+		if slices.ContainsFunc(flow, func(hop string) bool { return strings.HasPrefix(hop, "inputs.") }) {
+			passed = append(passed, flow)
+		}
+	}
+	return passed
+}
+
+// parseCompositeAction returns the steps of an action.yml, and whether it is a composite action at
+// all. The steps are parsed as those of a workflow job, keeping their line numbers in the file.
+func parseCompositeAction(content string) (steps []*actionlint.Step, composite bool, err error) {
+	var metadata struct {
+		Runs struct {
+			Using string `yaml:"using"`
+		} `yaml:"runs"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &metadata); err != nil {
+		return nil, false, fmt.Errorf("failed to parse action: %w", err)
+	}
+	if metadata.Runs.Using != "composite" {
+		return nil, false, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	start, indent := -1, ""
+	inRuns := false
+	for i, line := range lines {
+		if runsSection.MatchString(line) {
+			inRuns = true
+			continue
+		}
+		if match := stepsSection.FindStringSubmatch(line); inRuns && match != nil {
+			start, indent = i, match[1]
+			break
+		}
+	}
+	if start < 0 {
+		return nil, true, nil
+	}
+	// the job header takes three lines, the steps then start on the same line as in the action
+	job := []string{"jobs:", "  composite:", "    steps:"}
+	for len(job) < start+1 {
+		job = append(job, "")
+	}
+	for _, line := range lines[start+1:] {
+		if strings.TrimSpace(line) != "" && len(line)-len(strings.TrimLeft(line, " ")) <= len(indent) {
+			break
+		}
+		job = append(job, "      "+line)
+	}
+	job = append(job, "    runs-on: ubuntu-latest", "on: push", "")
+
+	workflow, errs := actionlint.Parse([]byte(strings.Join(job, "\n")))
+	if workflow == nil || workflow.Jobs["composite"] == nil {
+		return nil, true, fmt.Errorf("failed to parse action steps: %v", errs)
+	}
+	return workflow.Jobs["composite"].Steps, true, nil
+}
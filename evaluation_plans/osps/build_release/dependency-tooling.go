@@ -0,0 +1,159 @@
+package build_release
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// lockedInstalls install exactly the dependency versions recorded in a lockfile, or fail
+var lockedInstalls = []*regexp.Regexp{
+	regexp.MustCompile(`\bnpm\s+ci\b`),
+	regexp.MustCompile(`\b(yarn|pnpm)\s+(install|i)\b[^;&|]*--(frozen-lockfile|immutable)\b`),
+	regexp.MustCompile(`\bpip3?\s+install\b[^;&|]*--require-hashes\b`),
+	regexp.MustCompile(`\bcargo\s+(build|install|test|fetch|run|check)\b[^;&|]*--(locked|frozen)\b`),
+	regexp.MustCompile(`\buv\s+sync\b[^;&|]*--(locked|frozen)\b`),
+}
+
+// unlockedInstalls install the newest versions that match, rather than those recorded in a lockfile,
+// unless they also match one of lockedInstalls
+var unlockedInstalls = []*regexp.Regexp{
+	regexp.MustCompile(`\bnpm\s+(install|i|add)\b[^;&|]*`),
+	regexp.MustCompile(`\b(yarn|pnpm)\s+(install|i|add)\b[^;&|]*`),
+	regexp.MustCompile(`\bgo\s+get\b[^;&|]*`),
+	regexp.MustCompile(`\bgem\s+install\b[^;&|]*`),
+}
+
+// goModDownload fetches the modules listed in go.sum, which go verifies them against
+var goModDownload = regexp.MustCompile(`\bgo\s+mod\s+download\b`)
+
+var (
+	// pipedDownloads run a script fetched from the network without keeping it, so it can't be checked
+	pipedDownloads = regexp.MustCompile(`\b(curl|wget)\b[^;&|]*\|\s*(sudo\s+(-\S+\s+)*)?((ba|z|da|k)?sh|python3?|perl|ruby|node)\b|` +
+		`\b(ba|z)?sh\s+(-c\s+)?["']?(<\(|\$\()\s*(curl|wget)\b[^)]*\)`)
+	// binaryDownloads fetch a release, archive or package with curl or wget
+	binaryDownloads = regexp.MustCompile(`\b(curl|wget)\b[^;&|]*?https?://[^\s"']*(/releases/download/[^\s"']*|` +
+		`\.(tar\.gz|tgz|tar\.xz|txz|tar\.bz2|zip|deb|rpm|apk|exe|msi|bin|jar|AppImage|dmg|pkg))\b`)
+	// checksumVerifications check a download against a known digest or signature
+	checksumVerifications = regexp.MustCompile(`\b(sha256sum|sha512sum|shasum|sha1sum)\b|\bgpg\s+--verify\b|` +
+		`\bcosign\s+verify|\bslsa-verifier\b|\bgh\s+attestation\s+verify\b|--checksum\b`)
+	pipInstall = regexp.MustCompile(`\bpip3?\s+install\b([^;&|]*)`)
+)
+
+// pipOptionsWithValues are the options of pip install that take the next argument as their value
+var pipOptionsWithValues = []string{
+	"-r", "--requirement", "-c", "--constraint", "-e", "--editable", "-t", "--target", "--prefix", "--root",
+	"-i", "--index-url", "--extra-index-url", "-f", "--find-links", "--platform", "--python-version",
+	"--only-binary", "--no-binary", "--cache-dir", "--src", "--upgrade-strategy", "--progress-bar",
+}
+
+// dependencyInstall is a command in a workflow, Dockerfile or Makefile that installs dependencies
+type dependencyInstall struct {
+	file    string
+	line    int
+	command string
+	// problem is empty when the command installs the versions recorded in a lockfile
+	problem string
+}
+
+func (d dependencyInstall) String() string {
+	if d.problem == "" {
+		return fmt.Sprintf("%s (%s line %d)", d.command, d.file, d.line)
+	}
+	return fmt.Sprintf("%s line %d: %s: %s", d.file, d.line, d.problem, d.command)
+}
+
+// findDependencyInstalls finds the commands in a script that install dependencies. Downloads count as
+// verified when the same script checks a digest or signature. goSum is true when the repository
+// has a go.sum for go mod download to check modules against.
+func findDependencyInstalls(file string, lines []scriptLine, goSum bool) (installs []dependencyInstall) {
+	lines = joinContinuations(lines)
+	verified := false
+	for _, line := range lines {
+		if checksumVerifications.MatchString(line.text) {
+			verified = true
+		}
+	}
+	for _, line := range lines {
+		text := strings.TrimSpace(line.text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		found := func(command, problem string) {
+			installs = append(installs, dependencyInstall{file: file, line: line.number, command: strings.Join(strings.Fields(command), " "), problem: problem})
+		}
+		for _, pattern := range lockedInstalls {
+			if command := pattern.FindString(text); command != "" {
+				found(command, "")
+			}
+		}
+		for _, pattern := range unlockedInstalls {
+			command := pattern.FindString(text)
+			locked := slices.ContainsFunc(lockedInstalls, func(locked *regexp.Regexp) bool { return locked.MatchString(command) })
+			if command != "" && !locked {
+				found(command, "install without a lockfile")
+			}
+		}
+		if command := goModDownload.FindString(text); command != "" && goSum {
+			found(command, "")
+		}
+		if command := pipedDownloads.FindString(text); command != "" {
+			found(command, "download piped into an interpreter")
+		} else if command := binaryDownloads.FindString(text); command != "" && !verified {
+			found(command, "download not verified against a checksum")
+		}
+		if match := pipInstall.FindStringSubmatch(text); match != nil {
+			if unpinned := unpinnedPipPackages(match[1]); len(unpinned) > 0 {
+				found(match[0], "pip install without pinned versions of "+strings.Join(unpinned, ", "))
+			}
+		}
+	}
+	return installs
+}
+
+// unpinnedPipPackages returns the packages named in the arguments of pip install that are not
+// pinned to a version. Requirements files, local paths and URLs are left alone, as is pip itself.
+func unpinnedPipPackages(arguments string) (unpinned []string) {
+	fields := strings.Fields(arguments)
+	if strings.Contains(arguments, "--require-hashes") {
+		return nil
+	}
+	for i := 0; i < len(fields); i++ {
+		field := strings.Trim(fields[i], `"'`)
+		switch {
+		case strings.HasPrefix(field, "-"):
+			if !strings.Contains(field, "=") && slices.Contains(pipOptionsWithValues, field) {
+				i++
+			}
+		case strings.Contains(field, "==") || strings.Contains(field, "@") || strings.Contains(field, "://"),
+			strings.HasPrefix(field, ".") || strings.HasPrefix(field, "/") || strings.HasPrefix(field, "$"),
+			strings.HasSuffix(field, ".whl") || strings.HasSuffix(field, ".tar.gz"),
+			strings.EqualFold(field, "pip"):
+		default:
+			unpinned = append(unpinned, field)
+		}
+	}
+	return unpinned
+}
+
+// joinContinuations joins lines ending in a backslash to the next, numbering the result as its first line
+func joinContinuations(lines []scriptLine) (joined []scriptLine) {
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		for strings.HasSuffix(strings.TrimRight(line.text, " \t"), `\`) && i+1 < len(lines) {
+			i++
+			line.text = strings.TrimSuffix(strings.TrimRight(line.text, " \t"), `\`) + " " + strings.TrimSpace(lines[i].text)
+		}
+		joined = append(joined, line)
+	}
+	return joined
+}
+
+// numberLines splits the content of a file into lines numbered from one
+func numberLines(content string) (lines []scriptLine) {
+	for i, text := range strings.Split(content, "\n") {
+		lines = append(lines, scriptLine{number: i + 1, text: text})
+	}
+	return lines
+}
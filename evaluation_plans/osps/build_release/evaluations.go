@@ -2,12 +2,22 @@ package build_release
 
 import (
 	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/reusable_steps"
 )
 
 //
 // Build and Release Control Family
 
+// DataSources names the data sources that the release and secret scanning steps depend on, by requirement
+var DataSources = map[string][]string{
+	"OSPS-BR-02.01": {data.ReleasesData},
+	"OSPS-BR-02.02": {data.ReleasesData},
+	"OSPS-BR-04.01": {data.ReleasesData, data.ReleaseNotesData},
+	"OSPS-BR-06.01": {data.ReleasesData},
+	"OSPS-BR-07.01": {data.SecurityPostureData},
+}
+
 func OSPS_BR_01() (evaluation *layer4.ControlEvaluation) {
 	evaluation = &layer4.ControlEvaluation{
 		ControlID: "OSPS-BR-01",
@@ -22,7 +32,7 @@ func OSPS_BR_01() (evaluation *layer4.ControlEvaluation) {
 			"Maturity Level 3",
 		},
 		[]layer4.AssessmentStep{
-			cicdSanitizedInputParameters,
+			reusable_steps.CombineSteps(cicdSanitizedInputParameters, privilegedWorkflowsIsolateUntrustedCode),
 		},
 	)
 
@@ -35,7 +45,7 @@ func OSPS_BR_01() (evaluation *layer4.ControlEvaluation) {
 			"Maturity Level 3",
 		},
 		[]layer4.AssessmentStep{
-			reusable_steps.NotImplemented,
+			branchNamesSanitizedInPipelines,
 		},
 	)
 
@@ -60,18 +70,17 @@ func OSPS_BR_02() (evaluation *layer4.ControlEvaluation) {
 		},
 	)
 
-	// Just run the previous assessments for now
-	// TODO: Implement this assessment
-	// evaluation.AddAssessment(
-	// 	"OSPS-BR-02.02",
-	// 	"When an official release is created, all assets within that release MUST be clearly associated with the release identifier or another unique identifier for the asset.",
-	// 	[]string{
-	// 		"Maturity Level 3",
-	// 	},
-	// 	[]layer4.AssessmentStep{
-	// 		reusable_steps.NotImplemented,
-	// 	},
-	// )
+	evaluation.AddAssessment(
+		"OSPS-BR-02.02",
+		"When an official release is created, all assets within that release MUST be clearly associated with the release identifier or another unique identifier for the asset.",
+		[]string{
+			"Maturity Level 3",
+		},
+		[]layer4.AssessmentStep{
+			reusable_steps.HasMadeReleases,
+			releaseAssetsCarryIdentifier,
+		},
+	)
 
 	return
 }
@@ -145,7 +154,7 @@ func OSPS_BR_05() (evaluation *layer4.ControlEvaluation) {
 			"Maturity Level 3",
 		},
 		[]layer4.AssessmentStep{
-			reusable_steps.NotImplemented,
+			reusable_steps.CombineSteps(actionsPinnedToCommits, dependenciesInstalledWithLockfiles),
 		},
 	)
 
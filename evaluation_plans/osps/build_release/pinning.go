@@ -0,0 +1,123 @@
+package build_release
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rhysd/actionlint"
+)
+
+// pinning is how firmly a reference to an action, reusable workflow or image names its version
+type pinning int
+
+const (
+	// shaPinned references name a full commit SHA, or an image digest, which can't be moved
+	shaPinned pinning = iota
+	// tagPinned references name a tag, which the owner can move to other code
+	tagPinned
+	// branchFloating references name a branch, or an image without a tag, and change with every push
+	branchFloating
+)
+
+var (
+	commitSHA   = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	versionTag  = regexp.MustCompile(`^v?\d+(\.\d+)*([-+.][0-9A-Za-z.-]+)?$`)
+	imageDigest = regexp.MustCompile(`@sha256:[0-9a-f]{64}$`)
+)
+
+// actionReference is a uses: in a workflow naming an action, reusable workflow or Docker image
+type actionReference struct {
+	location string
+	uses     string
+	pinning  pinning
+	// firstParty is true for the actions GitHub publishes under actions/
+	firstParty bool
+	docker     bool
+}
+
+func (r actionReference) String() string {
+	var how string
+	switch {
+	case r.pinning == shaPinned && r.docker:
+		how = "is pinned to a digest"
+	case r.pinning == shaPinned:
+		how = "is pinned to a commit SHA"
+	case r.pinning == tagPinned && r.docker:
+		how = "is pinned to a tag, not a digest"
+	case r.pinning == tagPinned:
+		how = "is pinned to a tag, not a commit SHA"
+	case r.docker:
+		how = "is not pinned to a digest or tag"
+	default:
+		how = "follows a branch"
+	}
+	return fmt.Sprintf("%s %s (%s)", r.uses, how, r.location)
+}
+
+// findActionReferences lists the actions, reusable workflows and Docker images a workflow uses.
+// Local actions and workflows are left out, as they are versioned with the repository.
+func findActionReferences(path string, workflow *actionlint.Workflow) (references []actionReference) {
+	for _, jobID := range slices.Sorted(maps.Keys(workflow.Jobs)) {
+		job := workflow.Jobs[jobID]
+		if job == nil {
+			continue
+		}
+		if job.WorkflowCall != nil && job.WorkflowCall.Uses != nil {
+			location := fmt.Sprintf("%s job %s (line %d)", path, jobID, job.WorkflowCall.Uses.Pos.Line)
+			if reference, ok := classifyReference(job.WorkflowCall.Uses.Value, location); ok {
+				references = append(references, reference)
+			}
+		}
+		for i, step := range job.Steps {
+			if step == nil {
+				continue
+			}
+			exec, ok := step.Exec.(*actionlint.ExecAction)
+			if !ok || exec.Uses == nil {
+				continue
+			}
+			location := fmt.Sprintf("%s job %s %s (line %d)", path, jobID, stepLabel(step, i), exec.Uses.Pos.Line)
+			if reference, ok := classifyReference(exec.Uses.Value, location); ok {
+				references = append(references, reference)
+			}
+		}
+	}
+	return references
+}
+
+// classifyReference works out how a uses: value is pinned. Without asking GitHub, a ref that looks
+// like a version number is taken to be a tag and any other ref that isn't a SHA to be a branch.
+func classifyReference(uses, location string) (reference actionReference, ok bool) {
+	reference = actionReference{location: location, uses: uses}
+	if image, isDocker := strings.CutPrefix(uses, "docker://"); isDocker {
+		reference.docker = true
+		name := image[strings.LastIndex(image, "/")+1:]
+		_, tag, tagged := strings.Cut(name, ":")
+		switch {
+		case imageDigest.MatchString(image):
+			reference.pinning = shaPinned
+		case tagged && tag != "latest":
+			reference.pinning = tagPinned
+		default:
+			reference.pinning = branchFloating
+		}
+		return reference, true
+	}
+	if strings.HasPrefix(uses, "./") {
+		return reference, false
+	}
+	action, ref, _ := strings.Cut(uses, "@")
+	reference.firstParty = strings.HasPrefix(strings.ToLower(action), "actions/")
+	switch {
+	case commitSHA.MatchString(ref):
+		reference.pinning = shaPinned
+	case versionTag.MatchString(ref):
+		reference.pinning = tagPinned
+	default:
+		reference.pinning = branchFloating
+	}
+	return reference, true
+}
@@ -0,0 +1,220 @@
+package build_release
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rhysd/actionlint"
+)
+
+// privilegedTriggers run with the repository's secrets and a token that can write, even when the
+// pull request that set them off comes from a fork
+var privilegedTriggers = []string{"pull_request_target", "workflow_run"}
+
+var (
+	// untrustedRefs name the code of the pull request or run that triggered a privileged workflow
+	untrustedRefs = regexp.MustCompile(`\bgithub\.(head_ref|` +
+		`event\.pull_request\.head\.(sha|ref|repo\.full_name)|` +
+		`event\.pull_request\.(number|merge_commit_sha)|` +
+		`event\.number|` +
+		`event\.workflow_run\.(head_sha|head_branch|head_repository\.full_name)|` +
+		`event\.workflow_run\.pull_requests.*\.head\.(sha|ref))\b|\brefs/pull/`)
+	// untrustedCheckoutCommands fetch the code of a pull request in a script
+	untrustedCheckoutCommands = regexp.MustCompile(`\bgh\s+pr\s+checkout\b|\bgit\s+(fetch|pull)\b[^\n]*\bpull/`)
+	// gitCheckoutCommands switch to a ref, which is untrusted when it matches untrustedRefs
+	gitCheckoutCommands = regexp.MustCompile(`\bgit\s+(checkout|switch|fetch|pull|reset)\b[^\n]*`)
+	// gitCommand matches a line of a script that only runs git or gh
+	gitCommand = regexp.MustCompile(`^(git|gh)\s[^;&|]*$`)
+	// artifactDownloadCommands download the artifacts of another run in a script
+	artifactDownloadCommands = regexp.MustCompile(`\bgh\s+run\s+download\b|\b(downloadArtifact|listWorkflowRunArtifacts)\(`)
+)
+
+// cacheActions write to the Actions cache when the job ends, keyed by the action without its version.
+// The value is the input that turns caching on, or empty when the action always caches.
+var cacheActions = map[string]string{
+	"actions/cache":               "",
+	"actions/cache/save":          "",
+	"actions/setup-dotnet":        "cache",
+	"actions/setup-java":          "cache",
+	"actions/setup-node":          "cache",
+	"actions/setup-python":        "cache",
+	"astral-sh/setup-uv":          "enable-cache",
+	"gradle/actions/setup-gradle": "",
+	"ruby/setup-ruby":             "bundler-cache",
+	"swatinem/rust-cache":         "",
+}
+
+// pwnRequest is a job of a privileged workflow that handles code or data from the run that triggered it
+type pwnRequest struct {
+	location string
+	trigger  string
+	// checkout is the untrusted ref checked out, and runs the step that then runs it
+	checkout string
+	runs     string
+	// artifacts is the step that downloads artifacts from another run
+	artifacts string
+	// cache is the step that writes to the cache
+	cache string
+}
+
+// exploitable reports whether code from the triggering pull request runs with the workflow's privileges
+func (p pwnRequest) exploitable() bool {
+	return p.checkout != "" && p.runs != ""
+}
+
+func (p pwnRequest) String() string {
+	var findings []string
+	if p.checkout != "" {
+		finding := "checks out " + p.checkout
+		if p.runs != "" {
+			finding += " and runs it in " + p.runs
+		}
+		findings = append(findings, finding)
+	}
+	if p.artifacts != "" {
+		findings = append(findings, "downloads artifacts from another run in "+p.artifacts)
+	}
+	if p.cache != "" {
+		findings = append(findings, "writes to the cache in "+p.cache)
+	}
+	return fmt.Sprintf("%s triggered by %s %s", p.location, p.trigger, strings.Join(findings, ", "))
+}
+
+// findPwnRequests finds the jobs of a pull_request_target or workflow_run workflow that check out the
+// triggering pull request, download artifacts from the triggering run, or write to the cache. Any of
+// these lets a fork reach the secrets, the token or the cache of the base repository.
+func findPwnRequests(path string, workflow *actionlint.Workflow) (requests []pwnRequest) {
+	var triggers []string
+	for _, event := range workflow.On {
+		if slices.Contains(privilegedTriggers, event.EventName()) {
+			triggers = append(triggers, event.EventName())
+		}
+	}
+	if len(triggers) == 0 {
+		return nil
+	}
+	for _, jobID := range slices.Sorted(maps.Keys(workflow.Jobs)) {
+		job := workflow.Jobs[jobID]
+		if job == nil {
+			continue
+		}
+		request := pwnRequest{location: fmt.Sprintf("%s job %s", path, jobID), trigger: strings.Join(triggers, " and ")}
+		for i, step := range job.Steps {
+			if step == nil {
+				continue
+			}
+			label := fmt.Sprintf("%s (line %d)", stepLabel(step, i), step.Pos.Line)
+			switch exec := step.Exec.(type) {
+			case *actionlint.ExecRun:
+				if exec.Run == nil {
+					continue
+				}
+				if request.checkout != "" && request.runs == "" {
+					request.runs = label
+				}
+				if ref := untrustedScriptCheckout(exec.Run.Value); ref != "" && request.checkout == "" {
+					request.checkout = fmt.Sprintf("%s in %s", ref, label)
+					if runsOtherCommands(exec.Run.Value) {
+						request.runs = label
+					}
+				}
+				if artifactDownloadCommands.MatchString(exec.Run.Value) && request.artifacts == "" {
+					request.artifacts = label
+				}
+			case *actionlint.ExecAction:
+				if exec.Uses == nil {
+					continue
+				}
+				action := strings.ToLower(strings.SplitN(exec.Uses.Value, "@", 2)[0])
+				if request.checkout != "" && request.runs == "" && strings.HasPrefix(action, "./") {
+					request.runs = label
+				}
+				switch {
+				case action == "actions/checkout":
+					if ref := untrustedCheckoutInputs(exec.Inputs); ref != "" && request.checkout == "" {
+						request.checkout = fmt.Sprintf("%s in %s", ref, label)
+					}
+				case downloadsArtifacts(action, exec.Inputs) && request.artifacts == "":
+					request.artifacts = label
+				case writesCache(action, exec.Inputs) && request.cache == "":
+					request.cache = label
+				}
+			}
+		}
+		if request.checkout != "" || request.artifacts != "" || request.cache != "" {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// untrustedCheckoutInputs returns the untrusted ref or repository actions/checkout is given, if any
+func untrustedCheckoutInputs(inputs map[string]*actionlint.Input) string {
+	for _, name := range []string{"ref", "repository"} {
+		input := inputs[name]
+		if input == nil || input.Value == nil {
+			continue
+		}
+		if ref := untrustedRefs.FindString(input.Value.Value); ref != "" {
+			return ref
+		}
+	}
+	return ""
+}
+
+// untrustedScriptCheckout returns the untrusted ref or command a script checks out with, if any
+func untrustedScriptCheckout(script string) string {
+	if command := untrustedCheckoutCommands.FindString(script); command != "" {
+		return "the pull request with " + strings.Join(strings.Fields(command), " ")
+	}
+	for _, command := range gitCheckoutCommands.FindAllString(script, -1) {
+		if ref := untrustedRefs.FindString(command); ref != "" {
+			return ref
+		}
+	}
+	return ""
+}
+
+// runsOtherCommands reports whether a script does more than fetch and check out code with git and gh
+func runsOtherCommands(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && !gitCommand.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadsArtifacts reports whether an action downloads artifacts uploaded by another run
+func downloadsArtifacts(action string, inputs map[string]*actionlint.Input) bool {
+	switch action {
+	case "dawidd6/action-download-artifact":
+		return true
+	case "actions/download-artifact":
+		return inputs["run-id"] != nil
+	case "actions/github-script":
+		return inputs["script"] != nil && inputs["script"].Value != nil && artifactDownloadCommands.MatchString(inputs["script"].Value.Value)
+	}
+	return false
+}
+
+// writesCache reports whether an action saves to the Actions cache. actions/setup-go caches unless
+// told not to, the other setup actions only when asked to.
+func writesCache(action string, inputs map[string]*actionlint.Input) bool {
+	if action == "actions/setup-go" {
+		return inputs["cache"] == nil || inputs["cache"].Value == nil || inputs["cache"].Value.Value != "false"
+	}
+	input, ok := cacheActions[action]
+	if !ok {
+		return false
+	}
+	if input == "" {
+		return true
+	}
+	value := inputs[input]
+	return value != nil && value.Value != nil && value.Value.Value != "" && value.Value.Value != "false"
+}
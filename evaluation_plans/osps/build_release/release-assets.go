@@ -0,0 +1,82 @@
+package build_release
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/revanite-io/pvtr-github-repo/data"
+)
+
+// companionSuffix ends the name of a signature, digest or attestation of the asset named before it
+var companionSuffix = regexp.MustCompile(`(?i)\.(sha1|sha256|sha512|md5|sig|asc|pem|cert|crt|sigstore|sigstore\.json|intoto\.jsonl|bundle)$`)
+
+// carriesIdentifier reports whether an asset name contains a tag or version, and not only as the
+// start of a longer version
+func carriesIdentifier(name, identifier string) bool {
+	if identifier == "" {
+		return false
+	}
+	pattern := `(^|[^0-9.])` + regexp.QuoteMeta(identifier) + `($|[^0-9.]|\.([^0-9]|$))`
+	matched, err := regexp.MatchString(pattern, name)
+	return err == nil && matched
+}
+
+// releaseVersion is the version in a release tag, without a leading v or a monorepo prefix such as cli/
+func releaseVersion(tag string) string {
+	return strings.TrimPrefix(tag[strings.LastIndex(tag, "/")+1:], "v")
+}
+
+// unassociatedAssets returns the assets of a release that can't be told apart from those of other
+// releases. An asset is associated when its name carries the release tag or version or matches one
+// of the templates, or when a checksum manifest of the release lists it, giving it a unique digest.
+// Signatures and digests of an asset are associated along with it. read downloads a manifest.
+func unassociatedAssets(release data.ReleaseData, project string, templates []data.ReleaseAssetTemplate, read func(url string) ([]byte, error)) (unassociated []string, err error) {
+	named := func(name string) bool {
+		for companionSuffix.MatchString(name) {
+			name = companionSuffix.ReplaceAllString(name, "")
+		}
+		if carriesIdentifier(name, release.TagName) || carriesIdentifier(name, releaseVersion(release.TagName)) {
+			return true
+		}
+		for _, template := range templates {
+			if template.Matches(name, project, release.TagName) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var manifests []data.ReleaseAsset
+	for _, asset := range release.Assets {
+		if data.IsChecksumManifest(asset.Name) {
+			manifests = append(manifests, asset)
+		} else if !named(asset.Name) {
+			unassociated = append(unassociated, asset.Name)
+		}
+	}
+	if len(unassociated) == 0 || len(manifests) == 0 {
+		return unassociated, nil
+	}
+
+	listed := make(map[string]bool)
+	for _, manifest := range manifests {
+		content, err := read(manifest.DownloadURL)
+		if err != nil {
+			return unassociated, fmt.Errorf("failed to read %s of release %s: %w", manifest.Name, release.TagName, err)
+		}
+		// each line is a digest followed by a file name, which sha256sum marks as binary with a leading *
+		for _, line := range strings.Split(string(content), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				listed[strings.TrimPrefix(fields[len(fields)-1], "*")] = true
+			}
+		}
+	}
+	var unlisted []string
+	for _, name := range unassociated {
+		if !listed[name] {
+			unlisted = append(unlisted, name)
+		}
+	}
+	return unlisted, nil
+}
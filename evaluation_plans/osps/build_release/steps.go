@@ -3,9 +3,14 @@ package build_release
 import (
 	"encoding/base64"
 	"fmt"
+	"maps"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/goccy/go-yaml"
+	"github.com/google/go-github/v74/github"
 	"github.com/ossf/gemara/layer4"
 	"github.com/rhysd/actionlint"
 
@@ -33,6 +38,22 @@ var untrustedVarsRegex = `.*(github\.event\.issue\.title|` +
 	`github\.event\.pull_request\.head\.repo\.default_branch|` +
 	`github\.head_ref).*`
 
+// GitLab CI predefined variables that carry data controlled by whoever pushed the commit or opened the merge request
+var untrustedGitlabVarsRegex = `\$\{?(CI_COMMIT_MESSAGE|` +
+	`CI_COMMIT_TITLE|` +
+	`CI_COMMIT_DESCRIPTION|` +
+	`CI_COMMIT_TAG_MESSAGE|` +
+	`CI_COMMIT_AUTHOR|` +
+	`CI_COMMIT_BRANCH|` +
+	`CI_COMMIT_REF_NAME|` +
+	`CI_MERGE_REQUEST_TITLE|` +
+	`CI_MERGE_REQUEST_DESCRIPTION|` +
+	`CI_MERGE_REQUEST_SOURCE_BRANCH_NAME|` +
+	`CI_EXTERNAL_PULL_REQUEST_SOURCE_BRANCH_NAME)\b`
+
+// keywords in .gitlab-ci.yml whose values are shell scripts
+var gitlabScriptKeywords = []string{"before_script", "script", "after_script"}
+
 func cicdSanitizedInputParameters(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
 
 	// parse the payload and see if we pass our checks
@@ -40,76 +61,347 @@ func cicdSanitizedInputParameters(payloadData any, _ map[string]*layer4.Change)
 	if message != "" {
 		return layer4.Unknown, message
 	}
-	workflows, err := data.GetDirectoryContent(".github/workflows")
+	workflows, err := data.GetWorkflowFiles()
+	if len(workflows) == 0 {
+		if pipeline, pipelineErr := data.GetFileContent(".gitlab-ci.yml"); pipelineErr == nil {
+			return checkGitlabPipeline(pipeline)
+		}
+		return layer4.NotApplicable, err.Error()
+	}
+
+	parsed, err := parseWorkflowFiles(workflows)
+	if err != nil {
+		return layer4.Failed, err.Error()
+	}
+	graph := &callGraph{
+		read: func(path string) (string, error) {
+			file, err := data.GetFileContent(path)
+			if err != nil {
+				return "", err
+			}
+			return file.GetContent()
+		},
+		readRemote: data.GetRemoteFileContent,
+	}
+	for _, file := range parsed {
+		// Check the workflow for untrusted inputs
+		ok, message := checkWorkflowFileForUntrustedInputs(file.workflow, graph)
+
+		if !ok {
+			return layer4.Failed, message
+		}
+	}
+
+	if len(graph.unresolved) > 0 {
+		return layer4.NeedsReview, "Untrusted inputs could not be followed into called actions and workflows:\n" + strings.Join(graph.unresolved, "\n")
+	}
+	return layer4.Passed, "GitHub Workflows variables do not contain untrusted inputs"
+
+}
+
+func branchNamesSanitizedInPipelines(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
+	payload, message := reusable_steps.VerifyPayload(payloadData)
+	if message != "" {
+		return layer4.Unknown, message
+	}
+
+	var uses []branchNameUse
+	workflows, err := payload.GetWorkflowFiles()
 	if len(workflows) == 0 {
+		file, pipelineErr := payload.GetFileContent(".gitlab-ci.yml")
+		if pipelineErr != nil {
+			return layer4.NotApplicable, err.Error()
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			return layer4.Failed, fmt.Sprintf("Error decoding .gitlab-ci.yml: %v", err)
+		}
+		var pipeline map[string]any
+		if err := yaml.Unmarshal([]byte(content), &pipeline); err != nil {
+			return layer4.Failed, fmt.Sprintf("Error parsing .gitlab-ci.yml: %v", err)
+		}
+		uses = findGitlabBranchNameUses(pipeline)
+	} else {
+		parsed, err := parseWorkflowFiles(workflows)
+		if err != nil {
+			return layer4.Failed, err.Error()
+		}
+		for _, file := range parsed {
+			uses = append(uses, findBranchNameUses(file.path, file.workflow)...)
+		}
+	}
+
+	var unsafe []string
+	for _, use := range uses {
+		if !use.safe {
+			unsafe = append(unsafe, use.String())
+		}
+	}
+	switch {
+	case len(unsafe) > 0:
+		return layer4.Failed, strings.Join(unsafe, "\n")
+	case len(uses) > 0:
+		return layer4.Passed, fmt.Sprintf("Branch names reach pipeline scripts only through quoted environment variables (%d uses)", len(uses))
+	default:
+		return layer4.NotApplicable, "Pipeline scripts do not use branch names"
+	}
+}
+
+func privilegedWorkflowsIsolateUntrustedCode(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
+	payload, message := reusable_steps.VerifyPayload(payloadData)
+	if message != "" {
+		return layer4.Unknown, message
+	}
+	workflows, err := payload.GetWorkflowFiles()
+	if len(workflows) == 0 {
+		return layer4.NotApplicable, fmt.Sprintf("No GitHub Actions workflows can be triggered by pull_request_target or workflow_run: %v", err)
+	}
+	parsed, err := parseWorkflowFiles(workflows)
+	if err != nil {
+		return layer4.Failed, err.Error()
+	}
+
+	var exploitable, review []string
+	for _, file := range parsed {
+		for _, request := range findPwnRequests(file.path, file.workflow) {
+			if request.exploitable() {
+				exploitable = append(exploitable, request.String())
+			} else {
+				review = append(review, request.String())
+			}
+		}
+	}
+	switch {
+	case len(exploitable) > 0:
+		return layer4.Failed, "Privileged workflows run code from pull requests:\n" + strings.Join(append(exploitable, review...), "\n")
+	case len(review) > 0:
+		return layer4.NeedsReview, "Privileged workflows handle code or artifacts from pull requests, or write to the cache:\n" + strings.Join(review, "\n")
+	}
+	return layer4.Passed, "No pull_request_target or workflow_run workflow checks out pull requests, downloads their artifacts or writes to the cache"
+}
+
+func actionsPinnedToCommits(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
+	payload, message := reusable_steps.VerifyPayload(payloadData)
+	if message != "" {
+		return layer4.Unknown, message
+	}
+	workflows, err := payload.GetWorkflowFiles()
+	if len(workflows) == 0 {
+		return layer4.NotApplicable, err.Error()
+	}
+	parsed, err := parseWorkflowFiles(workflows)
+	if err != nil {
+		return layer4.Failed, err.Error()
+	}
+
+	var references []actionReference
+	for _, file := range parsed {
+		references = append(references, findActionReferences(file.path, file.workflow)...)
+	}
+	if len(references) == 0 {
+		return layer4.NotApplicable, "Workflows don't use any actions, reusable workflows or Docker images from outside the repository"
+	}
+
+	// first-party actions pinned to a tag are widely accepted, so only branches need a look
+	var unpinned, firstParty []string
+	pinned, firstPartyTags := 0, 0
+	for _, reference := range references {
+		switch {
+		case reference.pinning == shaPinned:
+			pinned++
+		case reference.firstParty && reference.pinning == tagPinned:
+			firstPartyTags++
+		case reference.firstParty:
+			firstParty = append(firstParty, reference.String())
+		default:
+			unpinned = append(unpinned, reference.String())
+		}
+	}
+	switch {
+	case len(unpinned) > 0:
+		return layer4.Failed, fmt.Sprintf("%d of %d third-party actions, workflows and images are not pinned to a commit SHA or digest:\n%s",
+			len(unpinned), len(references)-firstPartyTags-len(firstParty), strings.Join(append(unpinned, firstParty...), "\n"))
+	case len(firstParty) > 0:
+		return layer4.NeedsReview, "First-party actions follow a branch:\n" + strings.Join(firstParty, "\n")
+	}
+	return layer4.Passed, fmt.Sprintf("%d references are pinned to a commit SHA or digest, and %d first-party actions to a tag", pinned, firstPartyTags)
+}
+
+func dependenciesInstalledWithLockfiles(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
+	payload, message := reusable_steps.VerifyPayload(payloadData)
+	if message != "" {
+		return layer4.Unknown, message
+	}
+
+	topLevel := payload.TopLevelFiles()
+	goSum := slices.Contains(topLevel, "go.sum")
+	var installs []dependencyInstall
+	workflows, _ := payload.GetWorkflowFiles()
+	parsed, err := parseWorkflowFiles(workflows)
+	if err != nil {
+		return layer4.Failed, err.Error()
+	}
+	for _, file := range parsed {
+		for _, jobID := range slices.Sorted(maps.Keys(file.workflow.Jobs)) {
+			job := file.workflow.Jobs[jobID]
+			if job == nil {
+				continue
+			}
+			for _, step := range job.Steps {
+				if step == nil {
+					continue
+				}
+				if exec, ok := step.Exec.(*actionlint.ExecRun); ok && exec.Run != nil {
+					installs = append(installs, findDependencyInstalls(file.path, scriptLines(exec.Run), goSum)...)
+				}
+			}
+		}
+	}
+	// Dockerfiles and Makefiles are often kept in subdirectories such as build/ or docker/
+	var unread []string
+	buildFiles, err := payload.FindFiles(func(path string) bool { return data.IsDockerfile(path) || data.IsMakefile(path) })
+	if err != nil {
+		unread = append(unread, fmt.Sprintf("Dockerfiles and Makefiles outside the root directory (%v)", err))
+		for _, path := range topLevel {
+			if data.IsDockerfile(path) || data.IsMakefile(path) {
+				buildFiles = append(buildFiles, path)
+			}
+		}
+	}
+	// the scripts of .gitlab-ci.yml are lists of shell commands, so it is read line by line like the others
+	if slices.Contains(topLevel, ".gitlab-ci.yml") {
+		buildFiles = append(buildFiles, ".gitlab-ci.yml")
+	}
+	for _, path := range buildFiles {
+		file, err := payload.GetFileContent(path)
 		if err != nil {
-			message = err.Error()
+			// the error already names the file
+			unread = append(unread, err.Error())
+			continue
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			unread = append(unread, fmt.Sprintf("%s (%v)", path, err))
+			continue
+		}
+		installs = append(installs, findDependencyInstalls(path, numberLines(content), goSum)...)
+	}
+
+	var problems, locked []string
+	for _, install := range installs {
+		if install.problem != "" {
+			problems = append(problems, install.String())
 		} else {
-			message = "No workflows found in .github/workflows directory"
+			locked = append(locked, install.String())
 		}
-		return layer4.NotApplicable, message
 	}
+	unreadNote := ""
+	if len(unread) > 0 {
+		unreadNote = "\nFiles that could not be read: " + strings.Join(unread, ", ")
+	}
+	switch {
+	case len(problems) > 0:
+		return layer4.Failed, "Dependencies are installed without standard tooling:\n" + strings.Join(problems, "\n") + unreadNote
+	case len(unread) > 0:
+		return layer4.NeedsReview, "Files that may install dependencies could not be read, review them manually: " + strings.Join(unread, ", ")
+	case len(locked) > 0:
+		return layer4.Passed, "Dependencies are installed from lockfiles: " + strings.Join(locked, ", ")
+	}
+	return layer4.NotApplicable, "No dependency installs found in workflows, Dockerfiles or Makefiles"
+}
+
+// workflowFile is a parsed GitHub Actions workflow and the path it was read from
+type workflowFile struct {
+	path     string
+	workflow *actionlint.Workflow
+}
 
+// parseWorkflowFiles decodes and parses the YAML files among workflows
+func parseWorkflowFiles(workflows []*github.RepositoryContent) (parsed []workflowFile, err error) {
 	for _, file := range workflows {
 		if !strings.HasSuffix(*file.Name, ".yml") && !strings.HasSuffix(*file.Name, ".yaml") {
 			continue
 		}
 
 		if *file.Encoding != "base64" {
-			return layer4.Failed, fmt.Sprintf("File %v is not base64 encoded", file.Name)
+			return nil, fmt.Errorf("File %v is not base64 encoded", file.GetName())
 		}
 
 		decoded, err := base64.StdEncoding.DecodeString(*file.Content)
 		if err != nil {
-			return layer4.Failed, fmt.Sprintf("Error decoding workflow file: %v", err)
+			return nil, fmt.Errorf("Error decoding workflow file: %v", err)
 		}
 
 		workflow, actionError := actionlint.Parse(decoded)
 		if actionError != nil {
-			return layer4.Failed, fmt.Sprintf("Error parsing workflow: %v (%s)", actionError, *file.Path)
+			return nil, fmt.Errorf("Error parsing workflow: %v (%s)", actionError, *file.Path)
 		}
+		parsed = append(parsed, workflowFile{path: file.GetPath(), workflow: workflow})
+	}
+	return parsed, nil
+}
 
-		// Check the workflow for untrusted inputs
-		ok, message := checkWorkflowFileForUntrustedInputs(workflow)
+// checkWorkflowFileForUntrustedInputs reports the untrusted inputs that reach a script, either
+// directly or through env, outputs, needs and matrix values, with the path each one takes. With a
+// graph, inputs are followed into the composite actions and reusable workflows that are called.
+func checkWorkflowFileForUntrustedInputs(workflow *actionlint.Workflow, graph *callGraph) (bool, string) {
+	var message strings.Builder
 
-		if !ok {
-			return layer4.Failed, message
+	reported := make(map[string]bool)
+	for _, flow := range untrustedInputFlows(workflow, graph) {
+		// an action called more than once has the same findings of its own each time
+		if reported[flow.String()] {
+			continue
 		}
+		reported[flow.String()] = true
+		message.WriteString(fmt.Sprintf("Untrusted input found: %v\n", flow))
 	}
 
-	return layer4.Passed, "GitHub Workflows variables do not contain untrusted inputs"
+	if message.Len() > 0 {
+		return false, message.String()
+	}
+	return true, ""
 
 }
 
-func checkWorkflowFileForUntrustedInputs(workflow *actionlint.Workflow) (bool, string) {
+func checkGitlabPipeline(file *github.RepositoryContent) (result layer4.Result, message string) {
+	content, err := file.GetContent()
+	if err != nil {
+		return layer4.Failed, fmt.Sprintf("Error decoding .gitlab-ci.yml: %v", err)
+	}
+	var pipeline map[string]any
+	if err := yaml.Unmarshal([]byte(content), &pipeline); err != nil {
+		return layer4.Failed, fmt.Sprintf("Error parsing .gitlab-ci.yml: %v", err)
+	}
+	if ok, message := checkGitlabPipelineForUntrustedInputs(pipeline); !ok {
+		return layer4.Failed, message
+	}
+	return layer4.Passed, "GitLab CI scripts do not contain untrusted inputs"
+}
 
-	untrustedVars, _ := regexp.Compile(untrustedVarsRegex)
+func checkGitlabPipelineForUntrustedInputs(pipeline map[string]any) (bool, string) {
+	untrustedVars, _ := regexp.Compile(untrustedGitlabVarsRegex)
 	var message strings.Builder
 
-	for _, job := range workflow.Jobs {
-
-		if job == nil {
+	// jobs, default and the deprecated global keywords at the top level may all hold scripts
+	names := []string{""}
+	for name := range pipeline {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var section any = pipeline
+		if name != "" {
+			section = pipeline[name]
+		}
+		keywords, ok := section.(map[string]any)
+		if !ok {
 			continue
 		}
-
-		//Check the step for untrusted inputs
-		for _, step := range job.Steps {
-
-			if step == nil {
-				continue
-			}
-
-			// if it isn't an exec run get out of dodge
-			run, ok := step.Exec.(*actionlint.ExecRun)
-			if !ok || run.Run == nil {
-				continue
-			}
-
-			varList := pullVariablesFromScript(run.Run.Value)
-
-			for _, name := range varList {
-				if untrustedVars.Match([]byte(name)) {
-					message.WriteString(fmt.Sprintf("Untrusted input found: %v\n", name))
+		for _, keyword := range gitlabScriptKeywords {
+			for _, line := range flattenGitlabScript(keywords[keyword]) {
+				for _, match := range untrustedVars.FindAllStringSubmatch(line, -1) {
+					message.WriteString(fmt.Sprintf("Untrusted input found: %v (%v)\n", match[1], strings.TrimPrefix(name+"."+keyword, ".")))
 				}
 			}
 		}
@@ -119,7 +411,19 @@ func checkWorkflowFileForUntrustedInputs(workflow *actionlint.Workflow) (bool, s
 		return false, message.String()
 	}
 	return true, ""
+}
 
+// flattenGitlabScript returns the lines of a script keyword, which may be a string or a list nested by YAML anchors
+func flattenGitlabScript(script any) (lines []string) {
+	switch value := script.(type) {
+	case string:
+		lines = append(lines, value)
+	case []any:
+		for _, item := range value {
+			lines = append(lines, flattenGitlabScript(item)...)
+		}
+	}
+	return lines
 }
 
 func pullVariablesFromScript(script string) []string {
@@ -155,16 +459,19 @@ func pullVariablesFromScript(script string) []string {
 }
 
 func releaseHasUniqueIdentifier(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.ReleasesData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
 	var noNameCount int
 	var sameNameFound []string
 	var releaseNames = make(map[string]int)
 
-	for _, release := range data.Releases {
+	for _, release := range payload.Releases {
 		if release.Name == "" {
 			noNameCount++
 		} else if _, ok := releaseNames[release.Name]; ok {
@@ -184,6 +491,51 @@ func releaseHasUniqueIdentifier(payloadData any, _ map[string]*layer4.Change) (r
 	return layer4.Passed, "All releases found have a unique name"
 }
 
+func releaseAssetsCarryIdentifier(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
+	payload, message := reusable_steps.VerifyPayload(payloadData)
+	if message != "" {
+		return layer4.Unknown, message
+	}
+	if reason, ok := payload.Unavailable[data.ReleasesData]; ok {
+		return layer4.NeedsReview, reason
+	}
+
+	project := ""
+	if payload.GraphqlRepoData != nil {
+		project = payload.Repository.Name
+	}
+	download := func(url string) ([]byte, error) {
+		return payload.MakeApiCall(url, false)
+	}
+	var releases, assets int
+	var unassociated, unreadable []string
+	for _, release := range payload.Releases {
+		if release.Draft || release.Prerelease {
+			continue
+		}
+		releases++
+		assets += len(release.Assets)
+		names, err := unassociatedAssets(release, project, payload.ReleaseAssetTemplates, download)
+		if err != nil {
+			unreadable = append(unreadable, err.Error())
+		}
+		if len(names) > 0 {
+			unassociated = append(unassociated, fmt.Sprintf("Release %s: %s", release.TagName, strings.Join(names, ", ")))
+		}
+	}
+	switch {
+	case releases == 0:
+		return layer4.NotApplicable, "No official releases found"
+	case assets == 0:
+		return layer4.NotApplicable, "Official releases have no assets"
+	case len(unreadable) > 0:
+		return layer4.NeedsReview, "Checksum manifests could not be read:\n" + strings.Join(append(unreadable, unassociated...), "\n")
+	case len(unassociated) > 0:
+		return layer4.Failed, "Release assets do not carry the release tag or version, and are not listed in a checksum manifest:\n" + strings.Join(unassociated, "\n")
+	}
+	return layer4.Passed, fmt.Sprintf("All %d assets of %d official releases are associated with their release", assets, releases)
+}
+
 func getLinks(data data.Payload) []string {
 	si := data.Insights
 	links := []string{
@@ -252,12 +604,21 @@ func ensureInsightsLinksUseHTTPS(payloadData any, _ map[string]*layer4.Change) (
 }
 
 func ensureLatestReleaseHasChangelog(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	for _, source := range []string{data.ReleasesData, data.ReleaseNotesData} {
+		if reason, ok := payload.Unavailable[source]; ok {
+			return layer4.NeedsReview, reason
+		}
+	}
 
-	releaseDescription := data.Repository.LatestRelease.Description
+	release, found := payload.LatestRelease()
+	if !found {
+		return layer4.NotApplicable, "No releases found"
+	}
+	releaseDescription := release.Description
 	if strings.Contains(releaseDescription, "Change Log") || strings.Contains(releaseDescription, "Changelog") {
 		return layer4.Passed, "Mention of a changelog found in the latest release"
 	}
@@ -305,14 +666,16 @@ func distributionPointsUseHTTPS(payloadData any, _ map[string]*layer4.Change) (r
 }
 
 func secretScanningInUse(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
 
-	if data.SecurityPosture.PreventsPushingSecrets() && data.SecurityPosture.ScansForSecrets() {
+	if payload.SecurityPosture.PreventsPushingSecrets() && payload.SecurityPosture.ScansForSecrets() {
 		return layer4.Passed, "Secret scanning is enabled and prevents pushing secrets"
-	} else if data.SecurityPosture.PreventsPushingSecrets() || data.SecurityPosture.ScansForSecrets() {
+	} else if reason, ok := payload.Unavailable[data.SecurityPostureData]; ok {
+		return layer4.NeedsReview, reason
+	} else if payload.SecurityPosture.PreventsPushingSecrets() || payload.SecurityPosture.ScansForSecrets() {
 		return layer4.Failed, "Secret scanning is only partially enabled"
 	} else {
 		return layer4.Failed, "Secret scanning is not enabled"
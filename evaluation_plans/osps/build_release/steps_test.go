@@ -1,13 +1,19 @@
 package build_release
 
 import (
+	"encoding/base64"
 	"fmt"
 	"regexp"
 	"slices"
 	"testing"
 
+	"github.com/google/go-github/v74/github"
+	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
+	"github.com/revanite-io/pvtr-github-repo/data/datatest"
 	"github.com/rhysd/actionlint"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var goodWorkflowFile = `name: OSPS Baseline Scan
@@ -91,7 +97,7 @@ func TestCicdSanitizedInputParameters(t *testing.T) {
 
 		workflow, _ := actionlint.Parse([]byte(data.workflowFile))
 
-		result, message := checkWorkflowFileForUntrustedInputs(workflow)
+		result, message := checkWorkflowFileForUntrustedInputs(workflow, nil)
 
 		fmt.Println(message)
 		assert.Equal(t, result, data.expectedResult, data.assertionMessage)
@@ -135,3 +141,1022 @@ func TestUnTrustedVarsRegex(t *testing.T) {
 	assert.Equal(t, expression.Match([]byte("github.event.issue.title")), true, "regex match failed")
 	assert.Equal(t, expression.Match([]byte("github.event.commits.arbitrary.data.message")), true, "regex match failed")
 }
+
+func TestCheckGitlabPipelineForUntrustedInputs(t *testing.T) {
+	tests := []struct {
+		name            string
+		pipeline        string
+		expectedResult  layer4.Result
+		expectedMessage string
+	}{
+		{
+			name: "safe pipeline",
+			pipeline: `include:
+  - template: Jobs/Secret-Detection.gitlab-ci.yml
+build:
+  script:
+    - make build
+    - echo "$CI_COMMIT_SHA $CI_COMMIT_REF_SLUG"
+`,
+			expectedResult:  layer4.Passed,
+			expectedMessage: "GitLab CI scripts do not contain untrusted inputs",
+		},
+		{
+			name: "untrusted inputs in job and default scripts",
+			pipeline: `default:
+  before_script:
+    - echo ${CI_MERGE_REQUEST_TITLE}
+.common: &common
+  - eval "$CI_COMMIT_MESSAGE"
+test:
+  script:
+    - *common
+    - make test
+`,
+			expectedResult:  layer4.Failed,
+			expectedMessage: "Untrusted input found: CI_MERGE_REQUEST_TITLE (default.before_script)\nUntrusted input found: CI_COMMIT_MESSAGE (test.script)\n",
+		},
+		{
+			name:            "invalid yaml",
+			pipeline:        "build: [",
+			expectedResult:  layer4.Failed,
+			expectedMessage: "Error parsing .gitlab-ci.yml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &github.RepositoryContent{
+				Encoding: github.Ptr("base64"),
+				Content:  github.Ptr(base64.StdEncoding.EncodeToString([]byte(tt.pipeline))),
+			}
+			result, message := checkGitlabPipeline(file)
+			assert.Equal(t, tt.expectedResult, result)
+			assert.Contains(t, message, tt.expectedMessage)
+		})
+	}
+}
+
+func TestFindBranchNameUses(t *testing.T) {
+	tests := []struct {
+		name       string
+		workflow   string
+		wantUnsafe []string
+		wantSafe   int
+	}{
+		{
+			name: "branch name interpolated into run",
+			workflow: `
+on: pull_request_target
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - name: Checkout branch
+        run: git checkout "${{ github.head_ref }}"
+      - run: echo ${{ github.event.workflow_run.head_branch }}
+      - run: echo ${{ github.ref == 'refs/heads/main' }}
+`,
+			wantUnsafe: []string{
+				`Branch name interpolated into a script: github.head_ref (ci.yml job build step "Checkout branch")`,
+				"Branch name interpolated into a script: github.event.workflow_run.head_branch (ci.yml job build step 2)",
+			},
+		},
+		{
+			name: "branch name passed through env and quoted",
+			workflow: `
+on: pull_request
+env:
+  BRANCH: ${{ github.event.pull_request.head.ref }}
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    env:
+      REF: ${{ github.ref_name }}
+    steps:
+      - run: |
+          git checkout "$BRANCH"
+          echo "building ${REF}"
+          echo '$REF is literal'
+      - shell: pwsh
+        run: Write-Output $env:REF $REF
+`,
+			wantSafe: 3,
+		},
+		{
+			name: "branch name passed through env but unquoted",
+			workflow: `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - env:
+          BRANCH: ${{ github.ref_name }}
+          SHA: ${{ github.sha }}
+        run: |
+          ./deploy.sh $BRANCH "$SHA"
+`,
+			wantUnsafe: []string{"Branch name expanded without quotes: $BRANCH (ci.yml job build step 1)"},
+		},
+		{
+			name: "branch name interpolated into github-script",
+			workflow: `
+on: pull_request
+jobs:
+  comment:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/github-script@v7
+        with:
+          script: |
+            console.log("${{ github.head_ref }}")
+`,
+			wantUnsafe: []string{"Branch name interpolated into a script: github.head_ref (ci.yml job comment step 1)"},
+		},
+		{
+			name: "no branch names",
+			workflow: `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow, errs := actionlint.Parse([]byte(tt.workflow))
+			require.Empty(t, errs)
+			var unsafe []string
+			safe := 0
+			for _, use := range findBranchNameUses("ci.yml", workflow) {
+				if use.safe {
+					safe++
+				} else {
+					unsafe = append(unsafe, use.String())
+				}
+			}
+			assert.Equal(t, tt.wantUnsafe, unsafe)
+			assert.Equal(t, tt.wantSafe, safe)
+		})
+	}
+}
+
+func TestFindGitlabBranchNameUses(t *testing.T) {
+	pipeline := map[string]any{
+		"build": map[string]any{
+			"script": []any{`git checkout "$CI_COMMIT_BRANCH"`, "./publish.sh ${CI_MERGE_REQUEST_SOURCE_BRANCH_NAME}"},
+		},
+		"docs": map[string]any{
+			"script": "echo $CI_COMMIT_REF_SLUG",
+		},
+	}
+
+	uses := findGitlabBranchNameUses(pipeline)
+	require.Len(t, uses, 2)
+	assert.True(t, uses[0].safe)
+	assert.False(t, uses[1].safe)
+	assert.Equal(t, "Branch name expanded without quotes: $CI_MERGE_REQUEST_SOURCE_BRANCH_NAME (build.script)", uses[1].String())
+}
+
+func TestBranchNamesSanitizedInPipelines(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name:        "no branch names",
+			payload:     datatest.PayloadWithFiles(map[string]string{".github/workflows/ci.yml": goodWorkflowFile}),
+			wantResult:  layer4.NotApplicable,
+			wantMessage: "Pipeline scripts do not use branch names",
+		},
+		{
+			name: "branch name in a script",
+			payload: datatest.PayloadWithFiles(map[string]string{".github/workflows/ci.yml": `on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: git checkout ${{ github.head_ref }}
+`}),
+			wantResult:  layer4.Failed,
+			wantMessage: "Branch name interpolated into a script: github.head_ref (.github/workflows/ci.yml job build step 1)",
+		},
+		{
+			name: "branch name passed through a quoted variable",
+			payload: datatest.PayloadWithFiles(map[string]string{".github/workflows/ci.yml": `on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: git checkout "$BRANCH"
+        env:
+          BRANCH: ${{ github.head_ref }}
+`}),
+			wantResult:  layer4.Passed,
+			wantMessage: "Branch names reach pipeline scripts only through quoted environment variables (1 uses)",
+		},
+		{
+			name:        "GitLab pipeline",
+			payload:     datatest.PayloadWithFiles(map[string]string{".gitlab-ci.yml": "publish:\n  script: ./publish.sh $CI_COMMIT_BRANCH\n"}),
+			wantResult:  layer4.Failed,
+			wantMessage: "Branch name expanded without quotes: $CI_COMMIT_BRANCH (publish.script)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := branchNamesSanitizedInPipelines(tt.payload, nil)
+			assert.Equal(t, tt.wantResult, result)
+			assert.Equal(t, tt.wantMessage, message)
+		})
+	}
+}
+
+func TestUntrustedInputFlows(t *testing.T) {
+	tests := []struct {
+		name      string
+		workflow  string
+		wantFlows []string
+	}{
+		{
+			name: "env interpolated into a script",
+			workflow: `on: issues
+env:
+  TITLE: ${{ github.event.issue.title }}
+jobs:
+  triage:
+    runs-on: ubuntu-latest
+    steps:
+      - name: Quoted variable
+        run: echo "$TITLE"
+      - name: Interpolated variable
+        run: |
+          echo checking
+          echo "${{ env.TITLE }}"
+`,
+			wantFlows: []string{
+				`github.event.issue.title -> env.TITLE (line 3) -> run script in job triage step "Interpolated variable" (line 13)`,
+			},
+		},
+		{
+			name: "step and job outputs reach another job",
+			workflow: `on: pull_request_target
+jobs:
+  meta:
+    runs-on: ubuntu-latest
+    outputs:
+      title: ${{ steps.read.outputs.title }}
+    steps:
+      - id: read
+        env:
+          BODY: ${{ github.event.pull_request.title }}
+        run: |
+          echo "title=$BODY" >> "$GITHUB_OUTPUT"
+  comment:
+    needs: meta
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/github-script@v7
+        with:
+          script: |
+            console.log("${{ needs.meta.outputs.title }}")
+`,
+			wantFlows: []string{
+				"github.event.pull_request.title -> env.BODY (line 10) -> steps.read.outputs.title (line 12) -> " +
+					"needs.meta.outputs.title (line 6) -> github-script script in job comment step 1 (line 20)",
+			},
+		},
+		{
+			name: "matrix values and GITHUB_ENV",
+			workflow: `on: pull_request_target
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        ref: ["${{ github.head_ref }}"]
+    steps:
+      - run: echo "REF=${{ matrix.ref }}" >> $GITHUB_ENV
+      - run: echo ${{ env.REF }}
+`,
+			wantFlows: []string{
+				"github.head_ref -> matrix.ref (line 7) -> run script in job build step 1 (line 9)",
+				"github.head_ref -> matrix.ref (line 7) -> GITHUB_ENV in job build step 1 (line 9)",
+				"github.head_ref -> matrix.ref (line 7) -> env.REF (line 9) -> run script in job build step 2 (line 10)",
+			},
+		},
+		{
+			name: "overridden variable is no longer tainted",
+			workflow: `on: issues
+env:
+  TITLE: ${{ github.event.issue.title }}
+jobs:
+  triage:
+    runs-on: ubuntu-latest
+    env:
+      TITLE: fixed
+    steps:
+      - run: echo "${{ env.TITLE }}"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow, errs := actionlint.Parse([]byte(tt.workflow))
+			require.Empty(t, errs)
+			var flows []string
+			for _, flow := range untrustedInputFlows(workflow, nil) {
+				flows = append(flows, flow.String())
+			}
+			assert.Equal(t, tt.wantFlows, flows)
+		})
+	}
+}
+
+func TestFindPwnRequests(t *testing.T) {
+	tests := []struct {
+		name            string
+		workflow        string
+		wantRequests    []string
+		wantExploitable []bool
+	}{
+		{
+			name: "pull request head checked out and built",
+			workflow: `on: pull_request_target
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+        with:
+          ref: ${{ github.event.pull_request.head.sha }}
+      - name: Build
+        run: make test
+`,
+			wantRequests: []string{
+				`ci.yml job test triggered by pull_request_target checks out github.event.pull_request.head.sha in step 1 (line 6) and runs it in step "Build" (line 9)`,
+			},
+			wantExploitable: []bool{true},
+		},
+		{
+			name: "gh pr checkout in the same script",
+			workflow: `on: pull_request_target
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - run: |
+          gh pr checkout ${{ github.event.number }}
+          npm ci
+`,
+			wantRequests: []string{
+				"ci.yml job test triggered by pull_request_target checks out the pull request with gh pr checkout in step 2 (line 7) and runs it in step 2 (line 7)",
+			},
+			wantExploitable: []bool{true},
+		},
+		{
+			name: "artifacts and cache in workflow_run",
+			workflow: `on:
+  workflow_run:
+    workflows: [CI]
+    types: [completed]
+jobs:
+  report:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/download-artifact@v4
+        with:
+          run-id: ${{ github.event.workflow_run.id }}
+          github-token: ${{ github.token }}
+      - uses: actions/setup-go@v5
+`,
+			wantRequests: []string{
+				"ci.yml job report triggered by workflow_run downloads artifacts from another run in step 1 (line 9), writes to the cache in step 2 (line 13)",
+			},
+			wantExploitable: []bool{false},
+		},
+		{
+			name: "base branch checkout with caching turned off",
+			workflow: `on: pull_request_target
+jobs:
+  label:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          cache: false
+      - uses: actions/setup-node@v4
+      - run: make label
+`,
+		},
+		{
+			name: "unprivileged trigger",
+			workflow: `on: pull_request
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+        with:
+          ref: ${{ github.event.pull_request.head.sha }}
+      - uses: actions/cache@v4
+        with:
+          path: ~/.cache
+          key: cache
+      - run: make test
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow, errs := actionlint.Parse([]byte(tt.workflow))
+			require.Empty(t, errs)
+			var requests []string
+			var exploitable []bool
+			for _, request := range findPwnRequests("ci.yml", workflow) {
+				requests = append(requests, request.String())
+				exploitable = append(exploitable, request.exploitable())
+			}
+			assert.Equal(t, tt.wantRequests, requests)
+			assert.Equal(t, tt.wantExploitable, exploitable)
+		})
+	}
+}
+
+func TestFindActionReferences(t *testing.T) {
+	workflow := `on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@11bd71901bbe5b1630ceea73d27597364c9af683
+      - uses: actions/setup-go@v5
+      - uses: actions/cache@main
+      - uses: golangci/golangci-lint-action@v6.1.0
+      - name: Release
+        uses: goreleaser/goreleaser-action@master
+      - uses: ./.github/actions/local
+      - uses: docker://alpine:3.20
+      - uses: docker://alpine
+      - uses: docker://ghcr.io/org/tool@sha256:0000000000000000000000000000000000000000000000000000000000000000
+  shared:
+    uses: org/workflows/.github/workflows/build.yml@4d34df0c2316fe8122ab82dc22947d607c0c91f9
+`
+	parsed, errs := actionlint.Parse([]byte(workflow))
+	require.Empty(t, errs)
+
+	var references []string
+	var pinnings []pinning
+	var firstParty []bool
+	for _, reference := range findActionReferences("ci.yml", parsed) {
+		references = append(references, reference.String())
+		pinnings = append(pinnings, reference.pinning)
+		firstParty = append(firstParty, reference.firstParty)
+	}
+	assert.Equal(t, []string{
+		"actions/checkout@11bd71901bbe5b1630ceea73d27597364c9af683 is pinned to a commit SHA (ci.yml job build step 1 (line 6))",
+		"actions/setup-go@v5 is pinned to a tag, not a commit SHA (ci.yml job build step 2 (line 7))",
+		"actions/cache@main follows a branch (ci.yml job build step 3 (line 8))",
+		"golangci/golangci-lint-action@v6.1.0 is pinned to a tag, not a commit SHA (ci.yml job build step 4 (line 9))",
+		`goreleaser/goreleaser-action@master follows a branch (ci.yml job build step "Release" (line 11))`,
+		"docker://alpine:3.20 is pinned to a tag, not a digest (ci.yml job build step 7 (line 13))",
+		"docker://alpine is not pinned to a digest or tag (ci.yml job build step 8 (line 14))",
+		"docker://ghcr.io/org/tool@sha256:0000000000000000000000000000000000000000000000000000000000000000 is pinned to a digest (ci.yml job build step 9 (line 15))",
+		"org/workflows/.github/workflows/build.yml@4d34df0c2316fe8122ab82dc22947d607c0c91f9 is pinned to a commit SHA (ci.yml job shared (line 17))",
+	}, references)
+	assert.Equal(t, []pinning{shaPinned, tagPinned, branchFloating, tagPinned, branchFloating, tagPinned, branchFloating, shaPinned, shaPinned}, pinnings)
+	assert.Equal(t, []bool{true, true, true, false, false, false, false, false, false}, firstParty)
+}
+
+func TestActionsPinnedToCommits(t *testing.T) {
+	workflow := func(uses ...string) map[string]string {
+		content := "on: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n"
+		for _, action := range uses {
+			content += "      - uses: " + action + "\n"
+		}
+		return map[string]string{".github/workflows/ci.yml": content}
+	}
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name:        "only local actions",
+			payload:     datatest.PayloadWithFiles(workflow("./.github/actions/setup")),
+			wantResult:  layer4.NotApplicable,
+			wantMessage: "Workflows don't use any actions, reusable workflows or Docker images from outside the repository",
+		},
+		{
+			name:        "pinned to commits and first-party tags",
+			payload:     datatest.PayloadWithFiles(workflow("actions/checkout@v4", "some/action@8f4b7f84864484a7bf31766abe9204da3cbe65b3")),
+			wantResult:  layer4.Passed,
+			wantMessage: "1 references are pinned to a commit SHA or digest, and 1 first-party actions to a tag",
+		},
+		{
+			name:        "first-party action on a branch",
+			payload:     datatest.PayloadWithFiles(workflow("actions/checkout@main")),
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "First-party actions follow a branch:\nactions/checkout@main follows a branch (.github/workflows/ci.yml job build step 1 (line 6))",
+		},
+		{
+			name:       "third-party action on a tag",
+			payload:    datatest.PayloadWithFiles(workflow("actions/checkout@main", "some/action@v1")),
+			wantResult: layer4.Failed,
+			wantMessage: "1 of 1 third-party actions, workflows and images are not pinned to a commit SHA or digest:\n" +
+				"some/action@v1 is pinned to a tag, not a commit SHA (.github/workflows/ci.yml job build step 2 (line 7))\n" +
+				"actions/checkout@main follows a branch (.github/workflows/ci.yml job build step 1 (line 6))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := actionsPinnedToCommits(tt.payload, nil)
+			assert.Equal(t, tt.wantResult, result)
+			assert.Equal(t, tt.wantMessage, message)
+		})
+	}
+}
+
+func TestUntrustedInputFlowsThroughCalls(t *testing.T) {
+	files := map[string]string{
+		".github/actions/greet/action.yml": `name: Greet
+inputs:
+  title:
+    description: Issue title
+runs:
+  using: composite
+  steps:
+    - shell: bash
+      run: echo "${{ inputs.title }}"
+    - shell: bash
+      run: echo "$TITLE"
+`,
+		".github/workflows/label.yml": `on:
+  workflow_call:
+    inputs:
+      ref:
+        type: string
+jobs:
+  label:
+    runs-on: ubuntu-latest
+    steps:
+      - run: git log ${{ inputs.ref }}
+      - run: echo "${{ github.event.pull_request.title }}"
+`,
+		"org/shared/build/action.yml": `runs:
+  using: composite
+  steps:
+    - shell: bash
+      run: |
+        make ${{ inputs.target }}
+`,
+	}
+	graph := &callGraph{
+		read: func(path string) (string, error) {
+			if content, ok := files[path]; ok {
+				return content, nil
+			}
+			return "", fmt.Errorf("file not found at %s", path)
+		},
+		readRemote: func(repository, commit, path string) (string, error) {
+			return files[repository+"/"+path], nil
+		},
+	}
+	workflow, errs := actionlint.Parse([]byte(`on: pull_request_target
+jobs:
+  greet:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: ./.github/actions/greet
+        with:
+          title: ${{ github.event.issue.title }}
+      - uses: org/shared/build@4d34df0c2316fe8122ab82dc22947d607c0c91f9
+        with:
+          target: ${{ github.head_ref }}
+      - uses: org/shared/build@main
+        with:
+          target: ${{ github.head_ref }}
+      - uses: ./.github/actions/missing
+  label:
+    uses: ./.github/workflows/label.yml
+    with:
+      ref: ${{ github.event.pull_request.head.ref }}
+`))
+	require.Empty(t, errs)
+
+	var flows []string
+	for _, flow := range untrustedInputFlows(workflow, graph) {
+		flows = append(flows, flow.String())
+	}
+	assert.Equal(t, []string{
+		"github.event.issue.title -> inputs.title of ./.github/actions/greet in job greet step 1 (line 8) -> run script in .github/actions/greet/action.yml step 1 (line 9)",
+		"github.head_ref -> inputs.target of org/shared/build@4d34df0c2316fe8122ab82dc22947d607c0c91f9 in job greet step 2 (line 11) -> run script in org/shared/build/action.yml@4d34df0c2316fe8122ab82dc22947d607c0c91f9 step 1 (line 6)",
+		"github.event.pull_request.head.ref -> inputs.ref of ./.github/workflows/label.yml in job label (line 19) -> run script in .github/workflows/label.yml job label step 1 (line 10)",
+	}, flows)
+	require.Len(t, graph.unresolved, 1)
+	assert.Contains(t, graph.unresolved[0], "./.github/actions/missing")
+}
+
+func TestFindDependencyInstalls(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		goSum  bool
+		want   []string
+	}{
+		{
+			name: "lockfile installs",
+			script: `npm ci
+yarn install --frozen-lockfile
+pip install --require-hashes -r requirements.txt
+cargo build --release --locked
+go mod download`,
+			goSum: true,
+			want: []string{
+				"npm ci (Dockerfile line 1)",
+				"yarn install --frozen-lockfile (Dockerfile line 2)",
+				"pip install --require-hashes (Dockerfile line 3)",
+				"cargo build --release --locked (Dockerfile line 4)",
+				"go mod download (Dockerfile line 5)",
+			},
+		},
+		{
+			name:   "go mod download without go.sum",
+			script: "go mod download",
+		},
+		{
+			name: "installs without a lockfile",
+			script: `npm install
+yarn install && yarn build
+pnpm install --frozen-lockfile
+go get github.com/org/tool@latest
+gem install bundler`,
+			want: []string{
+				"Dockerfile line 1: install without a lockfile: npm install",
+				"Dockerfile line 2: install without a lockfile: yarn install",
+				"pnpm install --frozen-lockfile (Dockerfile line 3)",
+				"Dockerfile line 4: install without a lockfile: go get github.com/org/tool@latest",
+				"Dockerfile line 5: install without a lockfile: gem install bundler",
+			},
+		},
+		{
+			name: "download piped into a shell",
+			script: `RUN apt-get update && \
+    curl -fsSL https://example.com/install.sh | sudo -E bash -
+RUN sh -c "$(wget -qO- https://example.com/setup)"`,
+			want: []string{
+				"Dockerfile line 1: download piped into an interpreter: curl -fsSL https://example.com/install.sh | sudo -E bash",
+				`Dockerfile line 3: download piped into an interpreter: sh -c "$(wget -qO- https://example.com/setup)`,
+			},
+		},
+		{
+			name: "unpinned pip packages",
+			script: `pip install --upgrade pip
+pip install -r requirements.txt requests==2.32.3 black
+python -m pip install -e . pytest`,
+			want: []string{
+				"Dockerfile line 2: pip install without pinned versions of black: pip install -r requirements.txt requests==2.32.3 black",
+				"Dockerfile line 3: pip install without pinned versions of pytest: pip install -e . pytest",
+			},
+		},
+		{
+			name:   "binary download without a checksum",
+			script: "wget https://github.com/org/tool/releases/download/v1.0.0/tool-linux-amd64 -O /usr/local/bin/tool",
+			want: []string{
+				"Dockerfile line 1: download not verified against a checksum: wget https://github.com/org/tool/releases/download/v1.0.0/tool-linux-amd64",
+			},
+		},
+		{
+			name: "binary download with a checksum",
+			script: `curl -fsSLo tool.tar.gz https://example.com/tool-1.0.tar.gz
+echo "$TOOL_SHA256  tool.tar.gz" | sha256sum -c -`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var installs []string
+			for _, install := range findDependencyInstalls("Dockerfile", numberLines(tt.script), tt.goSum) {
+				installs = append(installs, install.String())
+			}
+			assert.Equal(t, tt.want, installs)
+		})
+	}
+}
+
+func TestUnassociatedAssets(t *testing.T) {
+	template, err := data.ParseReleaseAssetTemplate("{{name}}_{{os}}_{{arch}}_{{tag}}")
+	require.NoError(t, err)
+	manifests := map[string]string{
+		"https://example.com/checksums.txt": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 *tool.deb\n",
+	}
+	read := func(url string) ([]byte, error) {
+		if content, ok := manifests[url]; ok {
+			return []byte(content), nil
+		}
+		return nil, fmt.Errorf("unexpected response: 404 Not Found")
+	}
+
+	tests := []struct {
+		name      string
+		assets    []data.ReleaseAsset
+		templates []data.ReleaseAssetTemplate
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name: "names carry the tag or version",
+			assets: []data.ReleaseAsset{
+				{Name: "tool-v1.2.0-linux-amd64.tar.gz"},
+				{Name: "tool_1.2.0_windows.zip"},
+				{Name: "tool_1.2.0_windows.zip.sig"},
+				{Name: "tool-1.2.0.tar.gz.intoto.jsonl"},
+			},
+		},
+		{
+			name: "longer versions don't count",
+			assets: []data.ReleaseAsset{
+				{Name: "tool-1.2.0.1.tar.gz"},
+				{Name: "tool-11.2.0.tar.gz"},
+				{Name: "tool-linux-amd64"},
+			},
+			want: []string{"tool-1.2.0.1.tar.gz", "tool-11.2.0.tar.gz", "tool-linux-amd64"},
+		},
+		{
+			name:      "template",
+			assets:    []data.ReleaseAsset{{Name: "tool_linux_arm64_v1.2.0.tar.gz"}, {Name: "tool_linux_arm64.tar.gz"}},
+			templates: []data.ReleaseAssetTemplate{template},
+			want:      []string{"tool_linux_arm64.tar.gz"},
+		},
+		{
+			name: "listed in a checksum manifest",
+			assets: []data.ReleaseAsset{
+				{Name: "tool.deb"},
+				{Name: "tool.rpm"},
+				{Name: "checksums.txt", DownloadURL: "https://example.com/checksums.txt"},
+			},
+			want: []string{"tool.rpm"},
+		},
+		{
+			name: "unreadable manifest",
+			assets: []data.ReleaseAsset{
+				{Name: "tool.deb"},
+				{Name: "SHA256SUMS", DownloadURL: "https://example.com/SHA256SUMS"},
+			},
+			want:    []string{"tool.deb"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := data.ReleaseData{TagName: "v1.2.0", Assets: tt.assets}
+			unassociated, err := unassociatedAssets(release, "tool", tt.templates, read)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, unassociated)
+		})
+	}
+}
+
+func TestReleaseAssetsCarryIdentifier(t *testing.T) {
+	manifest := data.ReleaseAsset{Name: "checksums.txt", DownloadURL: "https://example.com/v1.2.0/checksums.txt"}
+	releasesPayload := func(releases ...data.ReleaseData) data.Payload {
+		return data.Payload{RestData: &data.RestData{Releases: releases}}
+	}
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name:        "no official releases",
+			payload:     releasesPayload(data.ReleaseData{TagName: "v1.3.0-rc.1", Prerelease: true, Assets: []data.ReleaseAsset{{Name: "tool"}}}),
+			wantResult:  layer4.NotApplicable,
+			wantMessage: "No official releases found",
+		},
+		{
+			name:        "assets carry the version",
+			payload:     releasesPayload(data.ReleaseData{TagName: "v1.2.0", Assets: []data.ReleaseAsset{{Name: "tool_1.2.0_linux_amd64.tar.gz"}, {Name: "tool_1.2.0_linux_amd64.tar.gz.sig"}}}),
+			wantResult:  layer4.Passed,
+			wantMessage: "All 2 assets of 1 official releases are associated with their release",
+		},
+		{
+			name: "asset listed in a checksum manifest",
+			payload: data.NewPayloadWithHTTPMock(
+				releasesPayload(data.ReleaseData{TagName: "v1.2.0", Assets: []data.ReleaseAsset{{Name: "tool"}, manifest}}),
+				[]byte("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  tool\n"), 0, nil),
+			wantResult:  layer4.Passed,
+			wantMessage: "All 2 assets of 1 official releases are associated with their release",
+		},
+		{
+			name:        "asset without the version",
+			payload:     releasesPayload(data.ReleaseData{TagName: "v1.2.0", Assets: []data.ReleaseAsset{{Name: "tool"}, {Name: "tool_1.2.0.zip"}}}),
+			wantResult:  layer4.Failed,
+			wantMessage: "Release assets do not carry the release tag or version, and are not listed in a checksum manifest:\nRelease v1.2.0: tool",
+		},
+		{
+			name: "unreadable checksum manifest",
+			payload: data.NewPayloadWithHTTPMock(
+				releasesPayload(data.ReleaseData{TagName: "v1.2.0", Assets: []data.ReleaseAsset{{Name: "tool"}, manifest}}),
+				nil, 0, fmt.Errorf("connection reset")),
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "Checksum manifests could not be read:\nfailed to read checksums.txt of release v1.2.0: error making http call: connection reset\nRelease v1.2.0: tool",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := releaseAssetsCarryIdentifier(tt.payload, nil)
+			assert.Equal(t, tt.wantResult, result)
+			assert.Equal(t, tt.wantMessage, message)
+		})
+	}
+}
+
+// pwnRequestWorkflow builds the head of a pull request with the privileges of pull_request_target
+var pwnRequestWorkflow = `on: pull_request_target
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+        with:
+          ref: ${{ github.event.pull_request.head.sha }}
+      - name: Build
+        run: make test
+`
+
+func TestPrivilegedWorkflowsIsolateUntrustedCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name:        "pull request code run with privileges",
+			payload:     datatest.PayloadWithFiles(map[string]string{".github/workflows/ci.yml": pwnRequestWorkflow}),
+			wantResult:  layer4.Failed,
+			wantMessage: "Privileged workflows run code from pull requests:\n" + `.github/workflows/ci.yml job test triggered by pull_request_target checks out github.event.pull_request.head.sha in step 1 (line 6) and runs it in step "Build" (line 9)`,
+		},
+		{
+			name: "pull request artifacts downloaded",
+			payload: datatest.PayloadWithFiles(map[string]string{".github/workflows/report.yml": `on:
+  workflow_run:
+    workflows: [ci]
+    types: [completed]
+jobs:
+  report:
+    runs-on: ubuntu-latest
+    steps:
+      - run: gh run download ${{ github.event.workflow_run.id }}
+`}),
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "Privileged workflows handle code or artifacts from pull requests, or write to the cache:\n.github/workflows/report.yml job report triggered by workflow_run downloads artifacts from another run in step 1 (line 9)",
+		},
+		{
+			name:        "no privileged workflows",
+			payload:     datatest.PayloadWithFiles(map[string]string{".github/workflows/ci.yml": goodWorkflowFile}),
+			wantResult:  layer4.Passed,
+			wantMessage: "No pull_request_target or workflow_run workflow checks out pull requests, downloads their artifacts or writes to the cache",
+		},
+		{
+			name:        "GitLab pipeline",
+			payload:     datatest.PayloadWithFiles(map[string]string{".gitlab-ci.yml": "test:\n  script: make test\n"}),
+			wantResult:  layer4.NotApplicable,
+			wantMessage: "No GitHub Actions workflows can be triggered by pull_request_target or workflow_run: content not found at .github/workflows: directory '.github' not found in path '.github/workflows'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := privilegedWorkflowsIsolateUntrustedCode(tt.payload, nil)
+			assert.Equal(t, tt.wantResult, result)
+			assert.Equal(t, tt.wantMessage, message)
+		})
+	}
+}
+
+func TestUntrustedInputsAssessment(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name:       "findings of both steps",
+			payload:    datatest.PayloadWithFiles(map[string]string{".github/workflows/ci.yml": pwnRequestWorkflow, ".github/workflows/scan.yml": badWorkflowFile}),
+			wantResult: layer4.Failed,
+			wantMessage: `Untrusted input found: github.event.review.body -> run script in job scan step "Add GitHub Secret to config file so it is protected in outputs" (line 20)` + "\n" +
+				`Untrusted input found: github.event.issue.title -> run script in job scan step "Scan all repos specified in .github/pvtr-config.yml" (line 25)` + "\n" +
+				"Privileged workflows run code from pull requests:\n" + `.github/workflows/ci.yml job test triggered by pull_request_target checks out github.event.pull_request.head.sha in step 1 (line 6) and runs it in step "Build" (line 9)`,
+		},
+		{
+			name:        "GitLab pipeline",
+			payload:     datatest.PayloadWithFiles(map[string]string{".gitlab-ci.yml": "test:\n  script: make test\n"}),
+			wantResult:  layer4.Passed,
+			wantMessage: "GitLab CI scripts do not contain untrusted inputs",
+		},
+		{
+			name:       "no pipelines",
+			payload:    datatest.PayloadWithFiles(map[string]string{"README.md": "# project\n"}),
+			wantResult: layer4.NotApplicable,
+			wantMessage: "content not found at .github/workflows: directory '.github' not found in path '.github/workflows'\n" +
+				"No GitHub Actions workflows can be triggered by pull_request_target or workflow_run: content not found at .github/workflows: directory '.github' not found in path '.github/workflows'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := OSPS_BR_01().AssessmentLogs[0].Steps[0]
+			result, message := step(tt.payload, nil)
+			assert.Equal(t, tt.wantResult, result)
+			assert.Equal(t, tt.wantMessage, message)
+		})
+	}
+}
+
+func TestDependenciesInstalledWithLockfiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     data.Payload
+		wantResult  layer4.Result
+		wantMessage string
+	}{
+		{
+			name:        "no installs",
+			payload:     datatest.PayloadWithFiles(map[string]string{"README.md": "# project\n", "build/Dockerfile": "FROM scratch\nCOPY app /\n"}),
+			wantResult:  layer4.NotApplicable,
+			wantMessage: "No dependency installs found in workflows, Dockerfiles or Makefiles",
+		},
+		{
+			name:        "lockfile install in a subdirectory",
+			payload:     datatest.PayloadWithFiles(map[string]string{"build/Dockerfile": "FROM node\nRUN npm ci\n"}),
+			wantResult:  layer4.Passed,
+			wantMessage: "Dependencies are installed from lockfiles: npm ci (build/Dockerfile line 2)",
+		},
+		{
+			name:        "install without a lockfile",
+			payload:     datatest.PayloadWithFiles(map[string]string{"build/Dockerfile": "FROM node\nRUN npm install && npm test\n", "docs/Makefile": datatest.UnreadableFile}),
+			wantResult:  layer4.Failed,
+			wantMessage: "Dependencies are installed without standard tooling:\nbuild/Dockerfile line 2: install without a lockfile: npm install\nFiles that could not be read: failed to retrieve file content for docs/Makefile: 403 resource not accessible",
+		},
+		{
+			name:        "unreadable file",
+			payload:     datatest.PayloadWithFiles(map[string]string{"build/Dockerfile": "FROM node\nRUN npm ci\n", "docs/Makefile": datatest.UnreadableFile}),
+			wantResult:  layer4.NeedsReview,
+			wantMessage: "Files that may install dependencies could not be read, review them manually: failed to retrieve file content for docs/Makefile: 403 resource not accessible",
+		},
+		{
+			name:        "vendored dependencies are left alone",
+			payload:     datatest.PayloadWithFiles(map[string]string{"vendor/lib/Makefile": "deps:\n\tgo get ./...\n"}),
+			wantResult:  layer4.NotApplicable,
+			wantMessage: "No dependency installs found in workflows, Dockerfiles or Makefiles",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := dependenciesInstalledWithLockfiles(tt.payload, nil)
+			assert.Equal(t, tt.wantResult, result)
+			assert.Equal(t, tt.wantMessage, message)
+		})
+	}
+}
+
+func TestDependencyToolingAssessment(t *testing.T) {
+	payload := datatest.PayloadWithFiles(map[string]string{
+		".github/workflows/ci.yml": `on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: some/action@main
+`,
+		"build/Dockerfile": "FROM node\nRUN npm install\n",
+	})
+	step := OSPS_BR_05().AssessmentLogs[0].Steps[0]
+	result, message := step(payload, nil)
+	assert.Equal(t, layer4.Failed, result)
+	assert.Contains(t, message, "some/action@main")
+	assert.Contains(t, message, "build/Dockerfile line 2: install without a lockfile: npm install", "the findings of both steps are reported")
+}
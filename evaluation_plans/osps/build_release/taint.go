@@ -0,0 +1,419 @@
+package build_release
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rhysd/actionlint"
+)
+
+var (
+	// untrustedContext matches the same contexts as untrustedVarsRegex, capturing the context
+	untrustedContext = regexp.MustCompile(strings.TrimSuffix(strings.TrimPrefix(untrustedVarsRegex, ".*"), ".*"))
+
+	envReference         = regexp.MustCompile(`\benv\.([A-Za-z_][A-Za-z0-9_]*)`)
+	stepOutputReference  = regexp.MustCompile(`\bsteps\.([A-Za-z0-9_-]+)\.outputs\.([A-Za-z0-9_-]+)`)
+	needsOutputReference = regexp.MustCompile(`\bneeds\.([A-Za-z0-9_-]+)\.outputs\.([A-Za-z0-9_-]+)`)
+	matrixReference      = regexp.MustCompile(`\bmatrix\.([A-Za-z0-9_-]+)`)
+	inputReference       = regexp.MustCompile(`\binputs\.([A-Za-z0-9_-]+)`)
+
+	// environmentFileWrite matches a script appending NAME=value to the files that set step outputs
+	// and environment variables for later steps
+	environmentFileWrite = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_-]*)=(.*?)["']?\s*>>\s*"?\$\{?(GITHUB_OUTPUT|GITHUB_ENV)\b`)
+	// setOutputCommand matches the deprecated ::set-output workflow command
+	setOutputCommand = regexp.MustCompile(`::set-output\s+name=([A-Za-z0-9_-]+)::(.*)`)
+)
+
+// taintPath is the route untrusted data takes from its source, one hop per entry
+type taintPath []string
+
+func (p taintPath) then(hop string, line int) taintPath {
+	return append(slices.Clone(p), fmt.Sprintf("%s (line %d)", hop, line))
+}
+
+func (p taintPath) String() string {
+	return strings.Join(p, " -> ")
+}
+
+// taintScope holds the values known to carry untrusted data where an expression is evaluated
+type taintScope struct {
+	env    map[string]taintPath
+	matrix map[string]taintPath
+	// stepOutputs and jobOutputs are keyed by the step or job ID and the output name, joined by a dot
+	stepOutputs map[string]taintPath
+	jobOutputs  map[string]taintPath
+	// inputs are the inputs of a composite action or reusable workflow, keyed in lower case
+	inputs map[string]taintPath
+}
+
+func newTaintScope(inputs map[string]taintPath) taintScope {
+	return taintScope{
+		env:         make(map[string]taintPath),
+		matrix:      make(map[string]taintPath),
+		stepOutputs: make(map[string]taintPath),
+		jobOutputs:  make(map[string]taintPath),
+		inputs:      inputs,
+	}
+}
+
+func (s taintScope) clone() taintScope {
+	return taintScope{
+		env:         maps.Clone(s.env),
+		matrix:      maps.Clone(s.matrix),
+		stepOutputs: maps.Clone(s.stepOutputs),
+		jobOutputs:  s.jobOutputs,
+		inputs:      s.inputs,
+	}
+}
+
+// taintOf returns the path by which an expression carries untrusted data, or nil when it doesn't
+func (s taintScope) taintOf(expression string) taintPath {
+	if match := untrustedContext.FindStringSubmatch(expression); match != nil {
+		return taintPath{match[1]}
+	}
+	for _, match := range envReference.FindAllStringSubmatch(expression, -1) {
+		// contexts are case insensitive in expressions
+		for name, path := range s.env {
+			if strings.EqualFold(name, match[1]) {
+				return path
+			}
+		}
+	}
+	for _, match := range stepOutputReference.FindAllStringSubmatch(expression, -1) {
+		if path, ok := s.stepOutputs[strings.ToLower(match[1]+"."+match[2])]; ok {
+			return path
+		}
+	}
+	for _, match := range needsOutputReference.FindAllStringSubmatch(expression, -1) {
+		if path, ok := s.jobOutputs[strings.ToLower(match[1]+"."+match[2])]; ok {
+			return path
+		}
+	}
+	for _, match := range matrixReference.FindAllStringSubmatch(expression, -1) {
+		if path, ok := s.matrix[strings.ToLower(match[1])]; ok {
+			return path
+		}
+		if path, ok := s.matrix["*"]; ok {
+			return path
+		}
+	}
+	for _, match := range inputReference.FindAllStringSubmatch(expression, -1) {
+		if path, ok := s.inputs[strings.ToLower(match[1])]; ok {
+			return path
+		}
+	}
+	return nil
+}
+
+// valueTaint returns the path by which the expressions in a value carry untrusted data, or nil
+func (s taintScope) valueTaint(value string) taintPath {
+	for _, expression := range pullVariablesFromScript(value) {
+		if path := s.taintOf(expression); path != nil {
+			return path
+		}
+	}
+	return nil
+}
+
+// shellTaint returns the path by which the environment variables a shell value expands carry
+// untrusted data, or nil
+func (s taintScope) shellTaint(value string) taintPath {
+	for i := range value {
+		if value[i] != '$' {
+			continue
+		}
+		if match := shellVariable.FindStringSubmatch(value[i:]); match != nil {
+			if path, ok := s.env[match[1]]; ok {
+				return path
+			}
+		}
+	}
+	return nil
+}
+
+// addEnv adds the variables of an env: section, which replace any inherited variables of the same name
+func (s taintScope) addEnv(env *actionlint.Env) {
+	if env == nil {
+		return
+	}
+	for _, key := range slices.Sorted(maps.Keys(env.Vars)) {
+		variable := env.Vars[key]
+		if variable == nil || variable.Name == nil || variable.Value == nil {
+			continue
+		}
+		name := variable.Name.Value
+		if path := s.valueTaint(variable.Value.Value); path != nil {
+			s.env[name] = path.then("env."+name, variable.Value.Pos.Line)
+		} else {
+			delete(s.env, name)
+		}
+	}
+}
+
+// addMatrix adds the matrix values of a job that are set from untrusted data. A matrix built by a
+// single expression is tainted as a whole.
+func (s taintScope) addMatrix(job *actionlint.Job) {
+	if job.Strategy == nil || job.Strategy.Matrix == nil {
+		return
+	}
+	matrix := job.Strategy.Matrix
+	if matrix.Expression != nil {
+		if path := s.valueTaint(matrix.Expression.Value); path != nil {
+			s.matrix["*"] = path.then("matrix", matrix.Expression.Pos.Line)
+		}
+		return
+	}
+	for _, key := range slices.Sorted(maps.Keys(matrix.Rows)) {
+		row := matrix.Rows[key]
+		if row == nil {
+			continue
+		}
+		if row.Expression != nil {
+			if path := s.valueTaint(row.Expression.Value); path != nil {
+				s.matrix[key] = path.then("matrix."+key, row.Expression.Pos.Line)
+			}
+			continue
+		}
+		for _, value := range row.Values {
+			if path, line := s.rawValueTaint(value); path != nil {
+				s.matrix[key] = path.then("matrix."+key, line)
+				break
+			}
+		}
+	}
+	if matrix.Include == nil {
+		return
+	}
+	if matrix.Include.Expression != nil {
+		if path := s.valueTaint(matrix.Include.Expression.Value); path != nil {
+			s.matrix["*"] = path.then("matrix", matrix.Include.Expression.Pos.Line)
+		}
+		return
+	}
+	for _, combination := range matrix.Include.Combinations {
+		if combination == nil {
+			continue
+		}
+		for _, key := range slices.Sorted(maps.Keys(combination.Assigns)) {
+			assign := combination.Assigns[key]
+			if assign == nil || assign.Value == nil {
+				continue
+			}
+			if path, line := s.rawValueTaint(assign.Value); path != nil {
+				s.matrix[key] = path.then("matrix."+key, line)
+			}
+		}
+	}
+}
+
+// rawValueTaint returns the path by which a matrix value, or any value nested in it, carries untrusted data
+func (s taintScope) rawValueTaint(value actionlint.RawYAMLValue) (taintPath, int) {
+	switch value := value.(type) {
+	case *actionlint.RawYAMLString:
+		if path := s.valueTaint(value.Value); path != nil {
+			return path, value.Pos().Line
+		}
+	case *actionlint.RawYAMLArray:
+		for _, element := range value.Elems {
+			if path, line := s.rawValueTaint(element); path != nil {
+				return path, line
+			}
+		}
+	case *actionlint.RawYAMLObject:
+		for _, key := range slices.Sorted(maps.Keys(value.Props)) {
+			if path, line := s.rawValueTaint(value.Props[key]); path != nil {
+				return path, line
+			}
+		}
+	}
+	return nil, 0
+}
+
+// untrustedInputFlows follows untrusted inputs through env: sections, step and job outputs, and
+// matrix values, returning the path of each one that reaches a script. Scripts are the run: scripts
+// of steps and the scripts of actions/github-script, along with $GITHUB_ENV, as setting environment
+// variables such as BASH_ENV from untrusted data lets it run code in later steps. When graph is not
+// nil, inputs are also followed into the composite actions and reusable workflows the workflow calls.
+func untrustedInputFlows(workflow *actionlint.Workflow, graph *callGraph) (flows []taintPath) {
+	return workflowFlows(workflow, "", nil, graph)
+}
+
+// workflowFlows follows untrusted data through a workflow, which is called with the given inputs
+// when it is a reusable workflow. file names the workflow in findings, unless it is empty.
+func workflowFlows(workflow *actionlint.Workflow, file string, inputs map[string]taintPath, graph *callGraph) (flows []taintPath) {
+	workflowScope := newTaintScope(inputs)
+	workflowScope.addEnv(workflow.Env)
+
+	for _, jobID := range jobOrder(workflow) {
+		job := workflow.Jobs[jobID]
+		scope := workflowScope.clone()
+		scope.addMatrix(job)
+		scope.addEnv(job.Env)
+		place := strings.TrimSpace(file + " job " + jobID)
+
+		if job.WorkflowCall != nil {
+			flows = append(flows, graph.workflowCallFlows(job.WorkflowCall, scope, place)...)
+		}
+		flows = append(flows, stepFlows(scope, job.Steps, place, graph)...)
+
+		for _, key := range slices.Sorted(maps.Keys(job.Outputs)) {
+			output := job.Outputs[key]
+			if output == nil || output.Name == nil || output.Value == nil {
+				continue
+			}
+			if path := scope.valueTaint(output.Value.Value); path != nil {
+				name := output.Name.Value
+				workflowScope.jobOutputs[strings.ToLower(jobID+"."+name)] = path.then(fmt.Sprintf("needs.%s.outputs.%s", jobID, name), output.Value.Pos.Line)
+			}
+		}
+	}
+	return flows
+}
+
+// stepFlows follows untrusted data through the steps of a job or composite action, whose place
+// prefixes the step in findings. scope gains the environment variables and outputs the steps set.
+func stepFlows(scope taintScope, steps []*actionlint.Step, place string, graph *callGraph) (flows []taintPath) {
+	for i, step := range steps {
+		if step == nil {
+			continue
+		}
+		location := fmt.Sprintf("%s %s", place, stepLabel(step, i))
+		stepScope := scope.clone()
+		stepScope.addEnv(step.Env)
+
+		switch exec := step.Exec.(type) {
+		case *actionlint.ExecRun:
+			if exec.Run == nil {
+				continue
+			}
+			for _, scriptLine := range scriptLines(exec.Run) {
+				line, text := scriptLine.number, scriptLine.text
+				for _, expression := range pullVariablesFromScript(text) {
+					if path := stepScope.taintOf(expression); path != nil {
+						flows = append(flows, path.then("run script in "+location, line))
+					}
+				}
+				for _, write := range environmentFileWrite.FindAllStringSubmatch(text, -1) {
+					path := stepScope.valueTaint(write[2])
+					if path == nil {
+						path = stepScope.shellTaint(write[2])
+					}
+					if path == nil {
+						continue
+					}
+					if write[3] == "GITHUB_ENV" {
+						flows = append(flows, path.then("GITHUB_ENV in "+location, line))
+						scope.env[write[1]] = path.then("env."+write[1], line)
+					} else if step.ID != nil {
+						output := step.ID.Value + ".outputs." + write[1]
+						scope.stepOutputs[strings.ToLower(step.ID.Value+"."+write[1])] = path.then("steps."+output, line)
+					}
+				}
+				for _, command := range setOutputCommand.FindAllStringSubmatch(text, -1) {
+					path := stepScope.valueTaint(command[2])
+					if path == nil {
+						path = stepScope.shellTaint(command[2])
+					}
+					if path != nil && step.ID != nil {
+						output := step.ID.Value + ".outputs." + command[1]
+						scope.stepOutputs[strings.ToLower(step.ID.Value+"."+command[1])] = path.then("steps."+output, line)
+					}
+				}
+			}
+		case *actionlint.ExecAction:
+			if exec.Uses == nil {
+				continue
+			}
+			script := exec.Inputs["script"]
+			if !strings.HasPrefix(exec.Uses.Value, "actions/github-script@") {
+				flows = append(flows, graph.actionFlows(exec, stepScope, location)...)
+				continue
+			}
+			if script == nil || script.Value == nil {
+				continue
+			}
+			for _, scriptLine := range scriptLines(script.Value) {
+				for _, expression := range pullVariablesFromScript(scriptLine.text) {
+					if path := stepScope.taintOf(expression); path != nil {
+						flows = append(flows, path.then("github-script script in "+location, scriptLine.number))
+					}
+				}
+			}
+		}
+	}
+	return flows
+}
+
+// scriptLine is a line of a script with its line number in the workflow file
+type scriptLine struct {
+	number int
+	text   string
+}
+
+// scriptLines splits a script into lines numbered as in the workflow file
+func scriptLines(script *actionlint.String) (lines []scriptLine) {
+	first := 0
+	if script.Pos != nil {
+		first = script.Pos.Line
+	}
+	texts := strings.Split(strings.TrimSuffix(script.Value, "\n"), "\n")
+	// block scalars, which end in a newline or span several lines, start on the line after their indicator
+	if !script.Quoted && (len(texts) > 1 || strings.HasSuffix(script.Value, "\n")) {
+		first++
+	}
+	for i, text := range texts {
+		lines = append(lines, scriptLine{number: first + i, text: text})
+	}
+	return lines
+}
+
+// jobOrder returns the IDs of a workflow's jobs with each after the jobs it needs
+func jobOrder(workflow *actionlint.Workflow) (order []string) {
+	var ids []string
+	for _, id := range slices.Sorted(maps.Keys(workflow.Jobs)) {
+		if workflow.Jobs[id] != nil {
+			ids = append(ids, id)
+		}
+	}
+	done := make(map[string]bool)
+	for len(order) < len(ids) {
+		progress := false
+		for _, id := range ids {
+			if done[id] {
+				continue
+			}
+			ready := true
+			for _, need := range workflow.Jobs[id].Needs {
+				if need != nil && !done[strings.ToLower(need.Value)] && workflow.Jobs[strings.ToLower(need.Value)] != nil {
+					ready = false
+				}
+			}
+			if ready {
+				order = append(order, id)
+				done[id] = true
+				progress = true
+			}
+		}
+		// jobs that need each other can't run, but are still checked
+		if !progress {
+			for _, id := range ids {
+				if !done[id] {
+					order = append(order, id)
+					done[id] = true
+				}
+			}
+		}
+	}
+	return order
+}
+
+// stepLabel names a step in findings by its name, or by its position in the job when it has none
+func stepLabel(step *actionlint.Step, index int) string {
+	if step.Name != nil {
+		return fmt.Sprintf("step %q", step.Name.Value)
+	}
+	return fmt.Sprintf("step %d", index+1)
+}
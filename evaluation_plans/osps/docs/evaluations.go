@@ -2,12 +2,22 @@ package docs // not sure why, but 'documentation' was misbehaving as a package n
 
 import (
 	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/reusable_steps"
 )
 
 //
 // Documentation Control Family
 
+// DataSources names the data sources the documentation steps depend on
+var DataSources = map[string][]string{
+	"OSPS-DO-01.01": {data.ReleasesData},
+	"OSPS-DO-02.01": {data.ReleasesData, data.RepositorySettingsData},
+	"OSPS-DO-03.01": {data.ReleasesData},
+	"OSPS-DO-03.02": {data.ReleasesData},
+	"OSPS-DO-06.01": {data.ReleasesData},
+}
+
 func OSPS_DO_01() (evaluation *layer4.ControlEvaluation) {
 	evaluation = &layer4.ControlEvaluation{
 		ControlID: "OSPS-DO-01",
@@ -2,12 +2,18 @@ package governance
 
 import (
 	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/reusable_steps"
 )
 
 //
 // Governance Control Family
 
+// DataSources names the data sources the governance steps depend on
+var DataSources = map[string][]string{
+	"OSPS-GV-02.01": {data.RepositorySettingsData},
+}
+
 func OSPS_GV_01() (evaluation *layer4.ControlEvaluation) {
 	evaluation = &layer4.ControlEvaluation{
 		ControlID: "OSPS-GV-01",
@@ -2,12 +2,20 @@ package legal
 
 import (
 	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/reusable_steps"
 )
 
 //
 // Legal Control Family
 
+// DataSources names the data sources the legal steps depend on
+var DataSources = map[string][]string{
+	"OSPS-LE-01.01": {data.RepositorySettingsData},
+	"OSPS-LE-02.02": {data.ReleasesData},
+	"OSPS-LE-03.02": {data.ReleasesData},
+}
+
 func OSPS_LE_01() (evaluation *layer4.ControlEvaluation) {
 	evaluation = &layer4.ControlEvaluation{
 		ControlID: "OSPS-LE-01",
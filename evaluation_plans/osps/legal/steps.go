@@ -21,7 +21,7 @@ type License struct {
 	IsFsfLibre            bool   `json:"isFsfLibre"`
 }
 
-const spdxURL = "https://raw.githubusercontent.com/spdx/license-list-data/main/json/licenses.json"
+const spdxURL = data.SPDXLicenseListURL
 
 func getLicenseList(data data.Payload, makeApiCall func(string, bool) ([]byte, error)) (LicenseList, string) {
 	goodLicenseList := LicenseList{}
@@ -63,15 +63,18 @@ func foundLicense(payloadData any, _ map[string]*layer4.Change) (result layer4.R
 }
 
 func releasesLicensed(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.ReleasesData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
-	if len(data.Releases) == 0 {
+	if len(payload.Releases) == 0 {
 		return layer4.NotApplicable, "No releases found"
 	}
-	if data.Repository.LicenseInfo.Url == "" {
+	if payload.Repository.LicenseInfo.Url == "" {
 		return layer4.Failed, "License was not found in a well known location via the GitHub API"
 	}
 	return layer4.Passed, "GitHub releases include the license(s) in the released source code."
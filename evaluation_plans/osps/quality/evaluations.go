@@ -2,12 +2,23 @@ package quality
 
 import (
 	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/reusable_steps"
 )
 
 //
 // Quality Control Family
 
+// DataSources names the data sources each requirement's steps depend on, as Payload.Unavailable keys
+var DataSources = map[string][]string{
+	"OSPS-QA-01.01": {data.RepositorySettingsData},
+	"OSPS-QA-01.02": {data.RepositorySettingsData},
+	"OSPS-QA-02.01": {data.DependencyGraphData},
+	"OSPS-QA-03.01": {data.StatusChecksData, data.BranchProtectionData, data.RulesetsData},
+	"OSPS-QA-06.01": {data.StatusChecksData},
+	"OSPS-QA-07.01": {data.BranchProtectionData, data.RulesetsData},
+}
+
 func OSPS_QA_01() (evaluation *layer4.ControlEvaluation) {
 	evaluation = &layer4.ControlEvaluation{
 		ControlID: "OSPS-QA-01",
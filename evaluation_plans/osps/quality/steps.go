@@ -5,15 +5,19 @@ import (
 	"strings"
 
 	"github.com/ossf/gemara/layer4"
+	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/revanite-io/pvtr-github-repo/evaluation_plans/reusable_steps"
 )
 
 func repoIsPublic(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
-	if data.RepositoryMetadata.IsPublic() {
+	if reason, ok := payload.Unavailable[data.RepositorySettingsData]; ok {
+		return layer4.NeedsReview, reason
+	}
+	if payload.RepositoryMetadata.IsPublic() {
 		return layer4.Passed, "Repository is public"
 	}
 	return layer4.Failed, "Repository is private"
@@ -33,14 +37,17 @@ func insightsListsRepositories(payloadData any, _ map[string]*layer4.Change) (re
 }
 
 func statusChecksAreRequiredByRulesets(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.StatusChecksData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
 	// get the name of all status checks that were run
 	var statusChecks []string
-	for _, check := range data.Repository.DefaultBranchRef.Target.Commit.AssociatedPullRequests.Nodes {
+	for _, check := range payload.Repository.DefaultBranchRef.Target.Commit.AssociatedPullRequests.Nodes {
 		for _, run := range check.StatusCheckRollup.Commit.CheckSuites.Nodes {
 			for _, checkRun := range run.CheckRuns.Nodes {
 				statusChecks = append(statusChecks, checkRun.Name)
@@ -48,15 +55,21 @@ func statusChecksAreRequiredByRulesets(payloadData any, _ map[string]*layer4.Cha
 		}
 	}
 
-	// get the rules that apply to the default branch
-	rules := data.GetRulesets(data.Repository.DefaultBranchRef.Name)
+	for _, source := range []string{data.BranchProtectionData, data.RulesetsData} {
+		if reason, ok := payload.Unavailable[source]; ok {
+			return layer4.NeedsReview, reason
+		}
+	}
+
+	// get the status check rules of the active rulesets targeting the default branch
+	rules := payload.BranchProtection.EnforcedRules(data.RuleRequiredStatusChecks)
 	if len(rules) == 0 {
-		return layer4.Passed, "No rulesets found for default branch, continuing to evaluate branch protection"
+		return layer4.Passed, "No ruleset requires status checks on the default branch, continuing to evaluate branch protection"
 	}
 
 	// get the name of all required status checks
 	var requiredChecks []string
-	for _, rule := range data.Rulesets {
+	for _, rule := range rules {
 		for _, requiredCheck := range rule.Parameters.RequiredChecks {
 			requiredChecks = append(requiredChecks, requiredCheck.Context)
 		}
@@ -85,14 +98,17 @@ func statusChecksAreRequiredByRulesets(payloadData any, _ map[string]*layer4.Cha
 }
 
 func statusChecksAreRequiredByBranchProtection(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.StatusChecksData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
 	// get the name of all status checks that were run
 	var statusChecks []string
-	for _, check := range data.Repository.DefaultBranchRef.Target.Commit.AssociatedPullRequests.Nodes {
+	for _, check := range payload.Repository.DefaultBranchRef.Target.Commit.AssociatedPullRequests.Nodes {
 		for _, run := range check.StatusCheckRollup.Commit.CheckSuites.Nodes {
 			for _, checkRun := range run.CheckRuns.Nodes {
 				statusChecks = append(statusChecks, checkRun.Name)
@@ -100,7 +116,7 @@ func statusChecksAreRequiredByBranchProtection(payloadData any, _ map[string]*la
 		}
 	}
 
-	requiredChecks := data.Repository.DefaultBranchRef.BranchProtectionRule.RequiredStatusCheckContexts
+	requiredChecks := payload.BranchProtection.RequiredStatusChecks
 
 	// check whether all executed checks are required
 	missingChecks := []string{}
@@ -130,52 +146,105 @@ func noBinariesInRepo(payloadData any, _ map[string]*layer4.Change) (result laye
 		return layer4.Unknown, message
 	}
 
-	// TODO: This only checks the top 3 levels of the repository tree
-	// for common binary file extensions and it fails on very large repositories.
 	suspectedBinaries, err := data.GetSuspectedBinaries()
 	if err != nil {
 		data.Config.Logger.Trace(fmt.Sprintf("unexpected response while checking for binaries: %s", err.Error()))
-		return layer4.Unknown, "Error while scanning repository for binaries, potentially due to repo size. See logs for details."
+		return layer4.Unknown, "Error while scanning repository for binaries. See logs for details."
 	}
 
-	if len(suspectedBinaries) == 0 {
-		return layer4.Passed, "No common binary file extensions were found in the repository"
+	// allowed binaries are still listed, so suppressions stay visible in the results
+	var found, allowed, unread []string
+	for _, binary := range suspectedBinaries {
+		switch {
+		case binary.Allowed != "":
+			allowed = append(allowed, binary.String())
+		case binary.Type == "":
+			unread = append(unread, binary.String())
+		default:
+			found = append(found, binary.String())
+		}
+	}
+	unreadMessage := ""
+	if len(unread) > 0 {
+		unreadMessage = fmt.Sprintf("; files that could not be read: %s", strings.Join(unread, ", "))
+	}
+	switch {
+	case len(found) > 0 && len(allowed) > 0:
+		return layer4.Failed, fmt.Sprintf("Suspected binaries found in the repository: %s; allowed binaries: %s%s", strings.Join(found, ", "), strings.Join(allowed, ", "), unreadMessage)
+	case len(found) > 0:
+		return layer4.Failed, fmt.Sprintf("Suspected binaries found in the repository: %s%s", strings.Join(found, ", "), unreadMessage)
+	case len(unread) > 0:
+		return layer4.NeedsReview, fmt.Sprintf("Files that may be binaries could not be read while scanning the repository, review them manually: %s", strings.Join(unread, ", "))
+	case len(allowed) > 0:
+		return layer4.Passed, fmt.Sprintf("Only allowed binaries were found in the repository: %s", strings.Join(allowed, ", "))
+	default:
+		return layer4.Passed, "No binary artifacts were found in the repository"
 	}
-	return layer4.Failed, fmt.Sprintf("Suspected binaries found in the repository: %s", strings.Join(suspectedBinaries, ", "))
 }
 
 func requiresNonAuthorApproval(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
-	protection := data.Repository.DefaultBranchRef.BranchProtectionRule
-
-	if !protection.RequiresApprovingReviews {
-		return layer4.Failed, "Branch protection rule does not require reviews"
+	if reason, ok := payload.Unavailable[data.BranchProtectionData]; ok {
+		return layer4.NeedsReview, reason
 	}
-
-	reviewCount := data.Repository.DefaultBranchRef.RefUpdateRule.RequiredApprovingReviewCount
-	if reviewCount < 1 {
-		return layer4.Failed, "Branch protection rule requires 0 approving reviews"
+	protection := payload.BranchProtection
+
+	// the branch protection rule and active rulesets are combined, and the strictest requirement applies
+	requiresReviews := protection.RequiresApprovingReviews
+	reviewCount := protection.RequiredApprovingReviewCount
+	requiresLastPushApproval := protection.RequiresLastPushApproval
+	for _, rule := range protection.EnforcedRules(data.RulePullRequest) {
+		requiresReviews = true
+		reviewCount = max(reviewCount, rule.Parameters.RequiredApprovingReviewCount)
+		requiresLastPushApproval = requiresLastPushApproval || rule.Parameters.RequireLastPushApproval
 	}
-
-	if !protection.RequireLastPushApproval {
-		return layer4.Failed, "Branch protection does not require re-approval after new commits"
+	rulesets := protection.RulesetsWith(data.EnforcementActive, data.RulePullRequest)
+	evaluating := protection.RulesetsWith(data.EnforcementEvaluate, data.RulePullRequest)
+
+	failure := ""
+	switch {
+	case !requiresReviews:
+		failure = "Neither the branch protection rule nor any ruleset requires reviews"
+	case reviewCount < 1:
+		failure = "Branch protection and rulesets require 0 approving reviews"
+	case !requiresLastPushApproval:
+		failure = "Neither branch protection nor rulesets require re-approval after new commits"
+	}
+	if reason, ok := payload.Unavailable[data.RulesetsData]; ok && failure != "" {
+		return layer4.NeedsReview, fmt.Sprintf("%s, but rulesets could not be checked: %s", failure, reason)
+	} else if failure != "" && len(evaluating) > 0 {
+		return layer4.Failed, fmt.Sprintf("%s; rulesets in evaluate mode would require reviews but are not enforced: %s", failure, data.DescribeRulesets(evaluating))
+	} else if failure != "" {
+		return layer4.Failed, failure
 	}
 
+	// when the branch protection rule doesn't require the reviews on its own, anyone bypassing the
+	// rulesets, even only in pull requests, can merge without them
+	protectionRequires := protection.RequiresApprovingReviews && protection.RequiredApprovingReviewCount >= 1 && protection.RequiresLastPushApproval
+	if bypassing := data.MergeBypassActors(rulesets); !protectionRequires && len(bypassing) > 0 {
+		return layer4.NeedsReview, fmt.Sprintf("Rulesets require %d approving reviews and re-approval after new commits, but %s can merge pull requests without them: %s", reviewCount, data.DescribeBypassActors(bypassing), data.DescribeRulesets(rulesets))
+	}
+	if len(rulesets) > 0 {
+		return layer4.Passed, fmt.Sprintf("Branch protection and rulesets require %d approving reviews and re-approval after new commits; rulesets: %s", reviewCount, data.DescribeRulesets(rulesets))
+	}
 	return layer4.Passed, fmt.Sprintf("Branch protection requires %d approving reviews and re-approval after new commits", reviewCount)
 }
 
 func hasOneOrMoreStatusChecks(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.StatusChecksData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
 	// get the name of all status checks that were run
 	var statusChecks []string
-	for _, check := range data.Repository.DefaultBranchRef.Target.Commit.AssociatedPullRequests.Nodes {
+	for _, check := range payload.Repository.DefaultBranchRef.Target.Commit.AssociatedPullRequests.Nodes {
 		for _, run := range check.StatusCheckRollup.Commit.CheckSuites.Nodes {
 			for _, checkRun := range run.CheckRuns.Nodes {
 				statusChecks = append(statusChecks, checkRun.Name)
@@ -191,29 +260,31 @@ func hasOneOrMoreStatusChecks(payloadData any, _ map[string]*layer4.Change) (res
 }
 
 func verifyDependencyManagement(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.DependencyGraphData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
 	// Validate required fields
-	if data.Repository.Name == "" || data.Repository.DefaultBranchRef.Name == "" ||
-		data.Repository.DefaultBranchRef.Target.OID == "" {
+	if payload.Repository.Name == "" || payload.Repository.DefaultBranchRef.Name == "" ||
+		payload.Repository.DefaultBranchRef.Target.OID == "" {
 		return layer4.Unknown, "Missing required repository data"
 	}
 
 	// Check dependency manifests
 	// TODO: Do a quality check on the dependency manifests
-	return countDependencyManifests(data)
+	return countDependencyManifests(payload)
 }
 
 func countDependencyManifests(payloadData any) (result layer4.Result, message string) {
-	data, message := reusable_steps.VerifyPayload(payloadData)
+	payload, message := reusable_steps.VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
-
-	manifestsCount := data.DependencyManifestsCount
+	manifestsCount := payload.DependencyManifestsCount
 	if manifestsCount > 0 {
 		return layer4.Passed, fmt.Sprintf("Found %d dependency manifests from GitHub API", manifestsCount)
 	}
@@ -1,6 +1,7 @@
 package quality
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/ossf/gemara/layer4"
@@ -71,3 +72,310 @@ func Test_insightsListsRepositories(t *testing.T) {
 		})
 	}
 }
+
+func Test_statusChecksAreRequiredByRulesets(t *testing.T) {
+	// the latest pull request ran the build and lint checks
+	graphql := &data.GraphqlRepoData{}
+	err := json.Unmarshal([]byte(`{"Repository": {"DefaultBranchRef": {"Name": "main", "Target": {"Commit": {"AssociatedPullRequests": {"Nodes": [
+		{"StatusCheckRollup": {"Commit": {"CheckSuites": {"Nodes": [{"CheckRuns": {"Nodes": [{"Name": "build"}, {"Name": "lint"}]}}]}}}}
+	]}}}}}}`), graphql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusChecksRuleset := func(enforcement string, checks ...string) data.BranchRuleset {
+		rule := data.Ruleset{Type: data.RuleRequiredStatusChecks}
+		for _, check := range checks {
+			rule.Parameters.RequiredChecks = append(rule.Parameters.RequiredChecks, struct {
+				Context string `json:"context"`
+			}{Context: check})
+		}
+		return data.BranchRuleset{RulesetPolicy: data.RulesetPolicy{Name: "checks", Enforcement: enforcement}, Rules: []data.Ruleset{rule}}
+	}
+	tests := []struct {
+		name        string
+		rulesets    []data.BranchRuleset
+		unavailable map[string]string
+		wantResult  layer4.Result
+		wantMsg     string
+	}{
+		{
+			name:       "all checks required",
+			rulesets:   []data.BranchRuleset{statusChecksRuleset(data.EnforcementActive, "build", "lint")},
+			wantResult: layer4.Passed,
+			wantMsg:    "No status checks were run that are not required by the rules",
+		},
+		{
+			name:       "some checks not required",
+			rulesets:   []data.BranchRuleset{statusChecksRuleset(data.EnforcementActive, "build")},
+			wantResult: layer4.Failed,
+			wantMsg:    "Some executed status checks are not mandatory but all should be: lint (NOTE: Not continuing to evaluate branch protection: combining requirements in rulesets and branch protection is not recommended)",
+		},
+		{
+			name:       "no rulesets",
+			wantResult: layer4.Passed,
+			wantMsg:    "No ruleset requires status checks on the default branch, continuing to evaluate branch protection",
+		},
+		{
+			name:       "ruleset in evaluate mode is not enforced",
+			rulesets:   []data.BranchRuleset{statusChecksRuleset(data.EnforcementEvaluate, "build", "lint")},
+			wantResult: layer4.Passed,
+			wantMsg:    "No ruleset requires status checks on the default branch, continuing to evaluate branch protection",
+		},
+		{
+			name:        "rulesets unavailable",
+			unavailable: map[string]string{data.RulesetsData: "the rulesets targeting the branch are unavailable"},
+			wantResult:  layer4.NeedsReview,
+			wantMsg:     "the rulesets targeting the branch are unavailable",
+		},
+		{
+			name:        "status checks unavailable",
+			unavailable: map[string]string{data.StatusChecksData: "status checks are not available"},
+			wantResult:  layer4.NeedsReview,
+			wantMsg:     "status checks are not available",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := data.Payload{
+				GraphqlRepoData:  graphql,
+				RestData:         &data.RestData{},
+				BranchProtection: data.BranchProtection{Rulesets: tt.rulesets},
+				Unavailable:      tt.unavailable,
+			}
+			gotResult, gotMsg := statusChecksAreRequiredByRulesets(payload, nil)
+			if gotResult != tt.wantResult {
+				t.Errorf("result = %v, want %v", gotResult, tt.wantResult)
+			}
+			if gotMsg != tt.wantMsg {
+				t.Errorf("message = %q, want %q", gotMsg, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func Test_noBinariesInRepo(t *testing.T) {
+	fixture := data.SuspectedBinary{Path: "test/fixtures/sample.zip", Type: "ZIP archive", SHA256: "abc"}
+	tool := data.SuspectedBinary{Path: "bin/tool", Type: "ELF executable", SHA256: "def"}
+	unread := data.SuspectedBinary{Path: "firmware.dat", Unread: "40 MiB is over the 32 MiB read limit"}
+	allowlist := []data.BinaryAllowlistEntry{
+		{Path: "test/fixtures/**", Justification: "Archive reader fixtures"},
+		{Path: "bin/*", Justification: "Prebuilt helper", Expires: "2020-01-01"},
+	}
+	tests := []struct {
+		name       string
+		binaries   []data.SuspectedBinary
+		wantResult layer4.Result
+		wantMsg    string
+	}{
+		{
+			name:       "no binaries",
+			wantResult: layer4.Passed,
+			wantMsg:    "No binary artifacts were found in the repository",
+		},
+		{
+			name:       "only allowed binaries",
+			binaries:   []data.SuspectedBinary{fixture},
+			wantResult: layer4.Passed,
+			wantMsg:    "Only allowed binaries were found in the repository: test/fixtures/sample.zip (ZIP archive, allowed: Archive reader fixtures)",
+		},
+		{
+			name:       "expired allowlist entry",
+			binaries:   []data.SuspectedBinary{fixture, tool},
+			wantResult: layer4.Failed,
+			wantMsg:    "Suspected binaries found in the repository: bin/tool (ELF executable, allowlist entry expired on 2020-01-01); allowed binaries: test/fixtures/sample.zip (ZIP archive, allowed: Archive reader fixtures)",
+		},
+		{
+			name:       "unreadable files",
+			binaries:   []data.SuspectedBinary{fixture, unread},
+			wantResult: layer4.NeedsReview,
+			wantMsg:    "Files that may be binaries could not be read while scanning the repository, review them manually: firmware.dat (not read: 40 MiB is over the 32 MiB read limit)",
+		},
+		{
+			name:       "binaries and unreadable files",
+			binaries:   []data.SuspectedBinary{tool, unread},
+			wantResult: layer4.Failed,
+			wantMsg:    "Suspected binaries found in the repository: bin/tool (ELF executable, allowlist entry expired on 2020-01-01); files that could not be read: firmware.dat (not read: 40 MiB is over the 32 MiB read limit)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := data.Payload{
+				RestData:          &data.RestData{},
+				SuspectedBinaries: tt.binaries,
+				BinaryAllowlist:   allowlist,
+			}
+			gotResult, gotMsg := noBinariesInRepo(payload, nil)
+			if gotResult != tt.wantResult {
+				t.Errorf("result = %v, want %v", gotResult, tt.wantResult)
+			}
+			if gotMsg != tt.wantMsg {
+				t.Errorf("message = %q, want %q", gotMsg, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func Test_requiresNonAuthorApproval(t *testing.T) {
+	pullRequestRuleset := func(enforcement string, parameters data.RuleParameters) data.BranchRuleset {
+		return data.BranchRuleset{
+			RulesetPolicy: data.RulesetPolicy{Name: "reviews", Enforcement: enforcement},
+			Rules:         []data.Ruleset{{Type: data.RulePullRequest, Parameters: parameters}},
+		}
+	}
+	tests := []struct {
+		name        string
+		protection  data.BranchProtection
+		unavailable map[string]string
+		wantResult  layer4.Result
+		wantMsg     string
+	}{
+		{
+			name: "branch protection requires reviews",
+			protection: data.BranchProtection{
+				RequiresApprovingReviews:     true,
+				RequiredApprovingReviewCount: 2,
+				RequiresLastPushApproval:     true,
+			},
+			wantResult: layer4.Passed,
+			wantMsg:    "Branch protection requires 2 approving reviews and re-approval after new commits",
+		},
+		{
+			name:       "no reviews required",
+			wantResult: layer4.Failed,
+			wantMsg:    "Neither the branch protection rule nor any ruleset requires reviews",
+		},
+		{
+			name: "ruleset requires reviews",
+			protection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+				pullRequestRuleset(data.EnforcementActive, data.RuleParameters{RequiredApprovingReviewCount: 1, RequireLastPushApproval: true}),
+			}},
+			wantResult: layer4.Passed,
+			wantMsg:    `Branch protection and rulesets require 1 approving reviews and re-approval after new commits; rulesets: "reviews"`,
+		},
+		{
+			name: "ruleset requires 0 approving reviews",
+			protection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+				pullRequestRuleset(data.EnforcementActive, data.RuleParameters{RequireLastPushApproval: true}),
+			}},
+			wantResult: layer4.Failed,
+			wantMsg:    "Branch protection and rulesets require 0 approving reviews",
+		},
+		{
+			name: "re-approval required only by branch protection",
+			protection: data.BranchProtection{
+				RequiresApprovingReviews:     true,
+				RequiredApprovingReviewCount: 0,
+				RequiresLastPushApproval:     true,
+				Rulesets: []data.BranchRuleset{
+					pullRequestRuleset(data.EnforcementActive, data.RuleParameters{RequiredApprovingReviewCount: 3}),
+				},
+			},
+			wantResult: layer4.Passed,
+			wantMsg:    `Branch protection and rulesets require 3 approving reviews and re-approval after new commits; rulesets: "reviews"`,
+		},
+		{
+			name: "ruleset in evaluate mode is not enforced",
+			protection: data.BranchProtection{Rulesets: []data.BranchRuleset{
+				pullRequestRuleset(data.EnforcementEvaluate, data.RuleParameters{RequiredApprovingReviewCount: 1, RequireLastPushApproval: true}),
+			}},
+			wantResult: layer4.Failed,
+			wantMsg:    `Neither the branch protection rule nor any ruleset requires reviews; rulesets in evaluate mode would require reviews but are not enforced: "reviews" (evaluate mode)`,
+		},
+		{
+			name: "ruleset bypassed in pull requests",
+			protection: data.BranchProtection{Rulesets: []data.BranchRuleset{{
+				RulesetPolicy: data.RulesetPolicy{Name: "reviews", Enforcement: data.EnforcementActive, BypassActors: []data.BypassActor{
+					{ActorType: "Integration", ActorID: 7, BypassMode: data.BypassModePullRequest, Name: "app merge-bot"},
+				}},
+				Rules: []data.Ruleset{{Type: data.RulePullRequest, Parameters: data.RuleParameters{RequiredApprovingReviewCount: 1, RequireLastPushApproval: true}}},
+			}}},
+			wantResult: layer4.NeedsReview,
+			wantMsg:    `Rulesets require 1 approving reviews and re-approval after new commits, but app merge-bot (pull_request) can merge pull requests without them: "reviews" (bypassable by app merge-bot (pull_request))`,
+		},
+		{
+			name: "ruleset bypassed but branch protection requires reviews",
+			protection: data.BranchProtection{
+				RequiresApprovingReviews:     true,
+				RequiredApprovingReviewCount: 1,
+				RequiresLastPushApproval:     true,
+				Rulesets: []data.BranchRuleset{{
+					RulesetPolicy: data.RulesetPolicy{Name: "reviews", Enforcement: data.EnforcementActive, BypassActors: []data.BypassActor{
+						{ActorType: "OrganizationAdmin", BypassMode: data.BypassModeAlways},
+					}},
+					Rules: []data.Ruleset{{Type: data.RulePullRequest, Parameters: data.RuleParameters{RequiredApprovingReviewCount: 2}}},
+				}},
+			},
+			wantResult: layer4.Passed,
+			wantMsg:    `Branch protection and rulesets require 2 approving reviews and re-approval after new commits; rulesets: "reviews" (bypassable by OrganizationAdmin (always))`,
+		},
+		{
+			name:        "rulesets unavailable",
+			unavailable: map[string]string{data.RulesetsData: "the rulesets targeting the branch are unavailable"},
+			wantResult:  layer4.NeedsReview,
+			wantMsg:     "Neither the branch protection rule nor any ruleset requires reviews, but rulesets could not be checked: the rulesets targeting the branch are unavailable",
+		},
+		{
+			name: "rulesets unavailable but branch protection requires reviews",
+			protection: data.BranchProtection{
+				RequiresApprovingReviews:     true,
+				RequiredApprovingReviewCount: 1,
+				RequiresLastPushApproval:     true,
+			},
+			unavailable: map[string]string{data.RulesetsData: "the rulesets targeting the branch are unavailable"},
+			wantResult:  layer4.Passed,
+			wantMsg:     "Branch protection requires 1 approving reviews and re-approval after new commits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := data.Payload{RestData: &data.RestData{}, BranchProtection: tt.protection, Unavailable: tt.unavailable}
+			gotResult, gotMsg := requiresNonAuthorApproval(payload, nil)
+			if gotResult != tt.wantResult {
+				t.Errorf("result = %v, want %v", gotResult, tt.wantResult)
+			}
+			if gotMsg != tt.wantMsg {
+				t.Errorf("message = %q, want %q", gotMsg, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func Test_verifyDependencyManagement(t *testing.T) {
+	tests := []struct {
+		name       string
+		payload    data.Payload
+		wantResult layer4.Result
+		wantMsg    string
+	}{
+		{
+			name: "dependency graph unavailable",
+			payload: data.Payload{
+				GraphqlRepoData: &data.GraphqlRepoData{},
+				Unavailable:     map[string]string{data.DependencyGraphData: "The dependency graph is not available"},
+			},
+			wantResult: layer4.NeedsReview,
+			wantMsg:    "The dependency graph is not available",
+		},
+		{
+			name:       "repository data missing",
+			payload:    data.Payload{GraphqlRepoData: &data.GraphqlRepoData{}},
+			wantResult: layer4.Unknown,
+			wantMsg:    "Missing required repository data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, gotMsg := verifyDependencyManagement(tt.payload, nil)
+			if gotResult != tt.wantResult {
+				t.Errorf("result = %v, want %v", gotResult, tt.wantResult)
+			}
+			if gotMsg != tt.wantMsg {
+				t.Errorf("message = %q, want %q", gotMsg, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package reusable_steps
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/ossf/gemara/layer4"
 
@@ -20,16 +21,80 @@ func NotImplemented(payloadData any, changes map[string]*layer4.Change) (result
 	return layer4.NeedsReview, "Not implemented"
 }
 
+// CombineSteps runs steps as a single step, so that no step's findings hide another's: gemara takes
+// an assessment's message from the last step run alone. Steps that don't apply are left out,
+// unless none apply, and the results of the rest are aggregated as gemara would.
+func CombineSteps(steps ...layer4.AssessmentStep) layer4.AssessmentStep {
+	return func(payloadData any, changes map[string]*layer4.Change) (result layer4.Result, message string) {
+		var applicable, notApplicable []string
+		result = layer4.NotRun
+		for _, step := range steps {
+			stepResult, stepMessage := step(payloadData, changes)
+			stepMessage = strings.TrimSpace(stepMessage)
+			if stepResult == layer4.NotApplicable {
+				notApplicable = append(notApplicable, stepMessage)
+				continue
+			}
+			result = layer4.UpdateAggregateResult(result, stepResult)
+			applicable = append(applicable, stepMessage)
+		}
+		if len(applicable) == 0 {
+			return layer4.NotApplicable, strings.Join(notApplicable, "\n")
+		}
+		return result, strings.Join(applicable, "\n")
+	}
+}
+
+// forgeNames are the display names of the forges other than GitHub that a payload can be loaded from
+var forgeNames = map[string]string{
+	"gitlab":  "GitLab",
+	"gitea":   "Gitea",
+	"forgejo": "Forgejo",
+}
+
+// otherForge returns the name of the forge hosting the repository when it isn't GitHub, whose
+// guarantees then can't be relied on
+func otherForge(payload data.Payload) string {
+	if payload.Config == nil {
+		return ""
+	}
+	forge := payload.Config.GetString("forge")
+	if forge == "" || forge == "github" {
+		return ""
+	}
+	if name, ok := forgeNames[forge]; ok {
+		return name
+	}
+	return forge
+}
+
 func GithubBuiltIn(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	_, message = VerifyPayload(payloadData)
+	payload, message := VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.RepositorySettingsData]; ok {
+		return layer4.NeedsReview, reason
+	}
+	if forge := otherForge(payload); forge != "" {
+		return layer4.NeedsReview, fmt.Sprintf("This control is enforced by GitHub for all projects, but the repository is hosted on %s; manual review required", forge)
+	}
 
 	return layer4.Passed, "This control is enforced by GitHub for all projects"
 }
 
 func GithubTermsOfService(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
+	payload, message := VerifyPayload(payloadData)
+	if message != "" {
+		return layer4.Unknown, message
+	}
+	if reason, ok := payload.Unavailable[data.RepositorySettingsData]; ok {
+		return layer4.NeedsReview, reason
+	}
+	if forge := otherForge(payload); forge != "" {
+		return layer4.NeedsReview, fmt.Sprintf("This control is satisfied by the GitHub Terms of Service, but the repository is hosted on %s, whose terms must be reviewed", forge)
+	}
+
 	return layer4.Passed, "This control is satisfied by the GitHub Terms of Service"
 }
 
@@ -51,6 +116,9 @@ func HasMadeReleases(payloadData any, _ map[string]*layer4.Change) (result layer
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.ReleasesData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
 	if len(payload.Releases) == 0 {
 		return layer4.NotApplicable, "No releases found"
@@ -75,18 +143,21 @@ func IsActive(payloadData any, _ map[string]*layer4.Change) (result layer4.Resul
 }
 
 func HasIssuesOrDiscussionsEnabled(payloadData any, _ map[string]*layer4.Change) (result layer4.Result, message string) {
-	data, message := VerifyPayload(payloadData)
+	payload, message := VerifyPayload(payloadData)
 	if message != "" {
 		return layer4.Unknown, message
 	}
+	if reason, ok := payload.Unavailable[data.RepositorySettingsData]; ok {
+		return layer4.NeedsReview, reason
+	}
 
-	if data.Repository.HasDiscussionsEnabled && data.Repository.HasIssuesEnabled {
+	if payload.Repository.HasDiscussionsEnabled && payload.Repository.HasIssuesEnabled {
 		return layer4.Passed, "Both issues and discussions are enabled for the repository"
 	}
-	if data.Repository.HasDiscussionsEnabled {
+	if payload.Repository.HasDiscussionsEnabled {
 		return layer4.Passed, "Discussions are enabled for the repository"
 	}
-	if data.Repository.HasIssuesEnabled {
+	if payload.Repository.HasIssuesEnabled {
 		return layer4.Passed, "Issues are enabled for the repository"
 	}
 	return layer4.Failed, "Both issues and discussions are disabled for the repository"
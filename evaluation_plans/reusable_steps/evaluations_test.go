@@ -5,6 +5,7 @@ import (
 
 	"github.com/ossf/gemara/layer4"
 	"github.com/ossf/si-tooling/v2/si"
+	"github.com/privateerproj/privateer-sdk/config"
 	"github.com/revanite-io/pvtr-github-repo/data"
 	"github.com/stretchr/testify/assert"
 )
@@ -189,6 +190,49 @@ func TestHasSecurityInsightsFile(t *testing.T) {
 		assert.Equal(t, tt.expectedMessage, message, tt.assertionMessage)
 	}
 }
+func TestHasMadeReleases(t *testing.T) {
+	tests := []struct {
+		name             string
+		payloadData      any
+		expectedResult   layer4.Result
+		expectedMessage  string
+		assertionMessage string
+	}{
+		{
+			name: "Releases found",
+			payloadData: data.Payload{
+				RestData: &data.RestData{Releases: []data.ReleaseData{{TagName: "v1.0.0"}}},
+			},
+			expectedResult:   layer4.Passed,
+			expectedMessage:  "Found 1 releases",
+			assertionMessage: "Should pass when the repository has releases",
+		},
+		{
+			name:             "No releases",
+			payloadData:      data.Payload{RestData: &data.RestData{}},
+			expectedResult:   layer4.NotApplicable,
+			expectedMessage:  "No releases found",
+			assertionMessage: "Should not apply when the repository has no releases",
+		},
+		{
+			name: "Releases unavailable",
+			payloadData: data.Payload{
+				RestData:    &data.RestData{},
+				Unavailable: map[string]string{data.ReleasesData: "Failed to list releases: unexpected response: 403 Forbidden; manual review required"},
+			},
+			expectedResult:   layer4.NeedsReview,
+			expectedMessage:  "Failed to list releases: unexpected response: 403 Forbidden; manual review required",
+			assertionMessage: "Should need review rather than report no releases when they couldn't be listed",
+		},
+	}
+
+	for _, tt := range tests {
+		result, message := HasMadeReleases(tt.payloadData, nil)
+		assert.Equal(t, tt.expectedResult, result, tt.assertionMessage)
+		assert.Equal(t, tt.expectedMessage, message, tt.assertionMessage)
+	}
+}
+
 func TestIsActive(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -257,3 +301,158 @@ func TestIsActive(t *testing.T) {
 		assert.Equal(t, tt.expectedMessage, message, tt.assertionMessage)
 	}
 }
+
+func TestGithubTermsOfService(t *testing.T) {
+	tests := []struct {
+		name            string
+		payloadData     any
+		expectedResult  layer4.Result
+		expectedMessage string
+	}{
+		{
+			name:            "GitHub repository",
+			payloadData:     data.Payload{},
+			expectedResult:  layer4.Passed,
+			expectedMessage: "This control is satisfied by the GitHub Terms of Service",
+		},
+		{
+			name: "Local checkout",
+			payloadData: data.Payload{
+				Unavailable: map[string]string{data.RepositorySettingsData: "Repository settings are configured on the forge"},
+			},
+			expectedResult:  layer4.NeedsReview,
+			expectedMessage: "Repository settings are configured on the forge",
+		},
+		{
+			name:            "GitLab repository",
+			payloadData:     data.Payload{Config: forgeConfig("gitlab")},
+			expectedResult:  layer4.NeedsReview,
+			expectedMessage: "This control is satisfied by the GitHub Terms of Service, but the repository is hosted on GitLab, whose terms must be reviewed",
+		},
+		{
+			name:            "Forgejo repository",
+			payloadData:     data.Payload{Config: forgeConfig("forgejo")},
+			expectedResult:  layer4.NeedsReview,
+			expectedMessage: "This control is satisfied by the GitHub Terms of Service, but the repository is hosted on Forgejo, whose terms must be reviewed",
+		},
+		{
+			name:            "Malformed payload type",
+			payloadData:     "not a payload",
+			expectedResult:  layer4.Unknown,
+			expectedMessage: "Malformed assessment: expected payload type data.Payload, got string (not a payload)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := GithubTermsOfService(tt.payloadData, nil)
+			assert.Equal(t, tt.expectedResult, result)
+			assert.Equal(t, tt.expectedMessage, message)
+		})
+	}
+}
+
+func forgeConfig(forge string) *config.Config {
+	return &config.Config{Vars: map[string]interface{}{"forge": forge}}
+}
+
+func TestGithubBuiltIn(t *testing.T) {
+	tests := []struct {
+		name            string
+		payloadData     any
+		expectedResult  layer4.Result
+		expectedMessage string
+	}{
+		{
+			name:            "GitHub repository",
+			payloadData:     data.Payload{Config: forgeConfig("github")},
+			expectedResult:  layer4.Passed,
+			expectedMessage: "This control is enforced by GitHub for all projects",
+		},
+		{
+			name:            "Forge left to its default",
+			payloadData:     data.Payload{Config: &config.Config{}},
+			expectedResult:  layer4.Passed,
+			expectedMessage: "This control is enforced by GitHub for all projects",
+		},
+		{
+			name:            "GitLab repository",
+			payloadData:     data.Payload{Config: forgeConfig("gitlab")},
+			expectedResult:  layer4.NeedsReview,
+			expectedMessage: "This control is enforced by GitHub for all projects, but the repository is hosted on GitLab; manual review required",
+		},
+		{
+			name:            "Forgejo repository",
+			payloadData:     data.Payload{Config: forgeConfig("forgejo")},
+			expectedResult:  layer4.NeedsReview,
+			expectedMessage: "This control is enforced by GitHub for all projects, but the repository is hosted on Forgejo; manual review required",
+		},
+		{
+			name:            "Gitea repository",
+			payloadData:     data.Payload{Config: forgeConfig("gitea")},
+			expectedResult:  layer4.NeedsReview,
+			expectedMessage: "This control is enforced by GitHub for all projects, but the repository is hosted on Gitea; manual review required",
+		},
+		{
+			name: "Local checkout",
+			payloadData: data.Payload{
+				Unavailable: map[string]string{data.RepositorySettingsData: "Repository settings are configured on the forge"},
+			},
+			expectedResult:  layer4.NeedsReview,
+			expectedMessage: "Repository settings are configured on the forge",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := GithubBuiltIn(tt.payloadData, nil)
+			assert.Equal(t, tt.expectedResult, result)
+			assert.Equal(t, tt.expectedMessage, message)
+		})
+	}
+}
+
+func TestCombineSteps(t *testing.T) {
+	step := func(result layer4.Result, message string) layer4.AssessmentStep {
+		return func(any, map[string]*layer4.Change) (layer4.Result, string) { return result, message }
+	}
+	tests := []struct {
+		name            string
+		steps           []layer4.AssessmentStep
+		expectedResult  layer4.Result
+		expectedMessage string
+	}{
+		{
+			name:            "Both steps pass",
+			steps:           []layer4.AssessmentStep{step(layer4.Passed, "first passed"), step(layer4.Passed, "second passed")},
+			expectedResult:  layer4.Passed,
+			expectedMessage: "first passed\nsecond passed",
+		},
+		{
+			name:            "First step fails",
+			steps:           []layer4.AssessmentStep{step(layer4.Failed, "first failed"), step(layer4.NeedsReview, "second needs review")},
+			expectedResult:  layer4.Failed,
+			expectedMessage: "first failed\nsecond needs review",
+		},
+		{
+			name:            "Later step doesn't apply",
+			steps:           []layer4.AssessmentStep{step(layer4.NeedsReview, "first needs review"), step(layer4.NotApplicable, "second doesn't apply")},
+			expectedResult:  layer4.NeedsReview,
+			expectedMessage: "first needs review",
+		},
+		{
+			name:            "No step applies",
+			steps:           []layer4.AssessmentStep{step(layer4.NotApplicable, "first doesn't apply"), step(layer4.NotApplicable, "second doesn't apply")},
+			expectedResult:  layer4.NotApplicable,
+			expectedMessage: "first doesn't apply\nsecond doesn't apply",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := CombineSteps(tt.steps...)(data.Payload{}, nil)
+			assert.Equal(t, tt.expectedResult, result)
+			assert.Equal(t, tt.expectedMessage, message)
+		})
+	}
+}
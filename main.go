@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 
 	"os"
@@ -23,11 +24,11 @@ var (
 	// BuiltAt is the actual build datetime
 	BuiltAt = ""
 
-	PluginName   = "github-repo"
+	PluginName = "github-repo"
+	// token is also required for GitHub, unless authenticating as a GitHub App via app-id or evaluating a local checkout via local-path
 	RequiredVars = []string{
 		"owner",
 		"repo",
-		"token",
 	}
 )
 
@@ -46,7 +47,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	pvtrVessel.AddEvaluationSuite("OSPS_B", data.Loader, evaluation_plans.OSPS_B, requirements)
+	pvtrVessel.AddEvaluationSuite("OSPS_B", data.NewLoader(evaluation_plans.OSPS_B_DataSources), evaluation_plans.OSPS_B, requirements)
 
 	runCmd := command.NewPluginCommands(
 		PluginName,
@@ -57,8 +58,17 @@ func main() {
 	)
 
 	err = runCmd.Execute()
+	// the API budget covers the requests made by the evaluation steps too, so it is logged once they have run
+	data.LogAPIUsage()
+	closeErr := errors.Join(data.CloseCassettes(), data.WriteSnapshots())
+	if closeErr != nil {
+		fmt.Printf("Error writing cassette or snapshot: %v\n", closeErr)
+	}
 	if err != nil {
 		fmt.Printf("Error during runCmd.Execute(): %v\n", err)
 		os.Exit(1)
 	}
+	if closeErr != nil {
+		os.Exit(1)
+	}
 }